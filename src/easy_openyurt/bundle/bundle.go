@@ -0,0 +1,425 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	knative "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/knative"
+	kube "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/kube"
+	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
+	system "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/system"
+	yurt "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/yurt"
+)
+
+var (
+	manifestImageRegexp = regexp.MustCompile(`(?m)^[\s-]*image:\s*["']?([^\s"'#]+)`) // Extract images from Kubernetes manifests
+)
+
+// Values of a flag which may be repeated
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// Parse parameters for subcommand `bundle`
+func ParseSubcommandBundle(args []string) {
+	if len(args) < 1 || args[0] != "create" {
+		logs.InfoPrintf("Usage: %s %s create -file <bundle.tar.gz> [parameters...]\n", os.Args[0], os.Args[1])
+		logs.FatalPrintf("Invalid operation: <operation> -> %s\n", strings.Join(args, " "))
+	}
+
+	// Parse parameters for `bundle create`
+	var help bool
+	var bundlePath string
+	var extraImages stringList
+	bundleFlagsName := fmt.Sprintf("%s bundle create", os.Args[0])
+	bundleFlags := flag.NewFlagSet(bundleFlagsName, flag.ExitOnError)
+	bundleFlags.StringVar(&bundlePath, "file", "", "Bundle to create, compressed if it ends with .gz or .tgz (**REQUIRED**)")
+	bundleFlags.Var(&extraImages, "image", "Additional container image to bundle (can be repeated)")
+	bundleFlags.StringVar(&configs.System.GoVersion, "go-version", configs.System.GoVersion, "Golang version")
+	bundleFlags.StringVar(&configs.System.ContainerdVersion, "containerd-version", configs.System.ContainerdVersion, "Containerd version")
+	bundleFlags.StringVar(&configs.System.RuncVersion, "runc-version", configs.System.RuncVersion, "Runc version")
+	bundleFlags.StringVar(&configs.System.CniPluginsVersion, "cni-plugins-version", configs.System.CniPluginsVersion, "CNI plugins version")
+	bundleFlags.StringVar(&configs.System.KubeInstallMethod, "k8s-install-method", configs.System.KubeInstallMethod, "Bundle kubeadm, kubelet, kubectl as packages (package) or as release binaries (binary), as installed by `system init`")
+	bundleFlags.StringVar(&configs.System.CrictlVersion, "crictl-version", configs.System.CrictlVersion, "Crictl version, bundled with -k8s-install-method=binary (default <Kubernetes minor version>.0)")
+	bundleFlags.StringVar(&configs.System.KubectlVersion, "kubectl-version", configs.System.KubectlVersion, "Kubectl version (default -k8s-version)")
+	bundleFlags.StringVar(&configs.System.KubeadmVersion, "kubeadm-version", configs.System.KubeadmVersion, "Kubeadm version (default -k8s-version)")
+	bundleFlags.StringVar(&configs.System.KubeletVersion, "kubelet-version", configs.System.KubeletVersion, "Kubelet version (default -k8s-version)")
+	bundleFlags.StringVar(&configs.Kube.K8sVersion, "k8s-version", configs.Kube.K8sVersion, "Kubernetes version")
+	bundleFlags.StringVar(&configs.Kube.AlternativeImageRepo, "alternative-image-repo", configs.Kube.AlternativeImageRepo, "Alternative image repository")
+	bundleFlags.StringVar(&configs.Knative.KnativeVersion, "knative-version", configs.Knative.KnativeVersion, "Knative version")
+	bundleFlags.StringVar(&configs.Knative.IstioVersion, "istio-version", configs.Knative.IstioVersion, "Istio version")
+	bundleFlags.StringVar(&configs.Knative.MetalLBVersion, "metalLB-version", configs.Knative.MetalLBVersion, "MetalLB version")
+	bundleFlags.BoolVar(&help, "help", false, "Show help")
+	bundleFlags.BoolVar(&help, "h", false, "Show help")
+	system.AddGlobalFlags(bundleFlags)
+	bundleFlags.Parse(args[1:])
+	// Show help
+	if help {
+		bundleFlags.Usage()
+		os.Exit(0)
+	}
+	// Check parameters
+	if len(bundlePath) == 0 {
+		bundleFlags.Usage()
+		logs.FatalPrintf("Parameter -file needed!\n")
+	}
+	if len(configs.System.BundlePath) > 0 {
+		logs.FatalPrintf("Parameter -bundle can not be used with `bundle create`!\n")
+	}
+	system.ApplyGlobalFlags()
+	err := errors.Join(
+		system.ValidateVersion("go-version", configs.System.GoVersion),
+		system.ValidateVersion("containerd-version", configs.System.ContainerdVersion),
+		system.ValidateVersion("runc-version", configs.System.RuncVersion),
+		system.ValidateVersion("cni-plugins-version", configs.System.CniPluginsVersion),
+		system.ValidateVersion("kubectl-version", system.KubePackageVersion(configs.System.KubectlVersion)),
+		system.ValidateVersion("kubeadm-version", system.KubePackageVersion(configs.System.KubeadmVersion)),
+		system.ValidateVersion("kubelet-version", system.KubePackageVersion(configs.System.KubeletVersion)),
+		system.ValidateVersion("k8s-version", configs.Kube.K8sVersion),
+		system.ValidateChoice("k8s-install-method", configs.System.KubeInstallMethod, system.KubeInstallPackage, system.KubeInstallBinary),
+		system.ResolveKubeVersions(system.IsFlagSet(bundleFlags, "k8s-version")),
+		system.ValidateVersion("knative-version", configs.Knative.KnativeVersion),
+		system.ValidateVersion("istio-version", configs.Knative.IstioVersion),
+		system.ValidateVersion("metalLB-version", configs.Knative.MetalLBVersion))
+	if len(configs.Kube.AlternativeImageRepo) > 0 {
+		err = errors.Join(err, system.ValidateImageRepo("alternative-image-repo", configs.Kube.AlternativeImageRepo))
+	}
+	logs.CheckErrorWithMsg(err, "Invalid parameters!\n")
+	// Packages are bundled as a local apt repository
+	if packageManager, err := system.GetPackageManager(); err != nil || packageManager.Name() != "apt" {
+		logs.FatalPrintf("Bundles can only be created on Ubuntu (apt), not on %s!\n", configs.System.CurrentOS)
+	}
+
+	// Resolve artifacts of all subcommands
+	logs.WaitPrintf("Resolving artifacts")
+	var artifacts []*system.Artifact
+	for _, bundleArtifacts := range []func() ([]*system.Artifact, error){
+		system.BundleArtifacts, kube.BundleArtifacts, yurt.BundleArtifacts, knative.BundleArtifacts} {
+		subcommandArtifacts, err := bundleArtifacts()
+		logs.CheckErrorWithMsg(err, "Failed to resolve artifacts!\n")
+		artifacts = append(artifacts, subcommandArtifacts...)
+	}
+	for _, image := range extraImages {
+		artifacts = append(artifacts, &system.Artifact{Kind: system.ArtifactImage, Source: image})
+	}
+	logs.SuccessPrintf("\n")
+
+	CreateBundle(bundlePath, artifacts)
+	logs.SuccessPrintf("Bundle has been written to %s! Install with `-bundle %s` on nodes without network access.\n", bundlePath, bundlePath)
+}
+
+// Fetch artifacts and write them with their manifest into a bundle
+func CreateBundle(bundlePath string, artifacts []*system.Artifact) {
+	// Initialize
+	var err error
+	system.CreateTmpDir()
+	defer system.CleanUpTmpDir()
+	stagingDir := configs.System.TmpDir + "/bundle"
+	for _, subDir := range []string{"files", "git", "images", "packages"} {
+		err = os.MkdirAll(stagingDir+"/"+subDir, 0755)
+		logs.CheckErrorWithMsg(err, "Failed to create staging directory!\n")
+	}
+	artifacts = uniqueArtifacts(artifacts)
+
+	// Files
+	var images []string
+	for _, artifact := range filterArtifacts(artifacts, system.ArtifactFile) {
+		logs.WaitPrintf("Bundling %s", artifact.Source)
+		filePath, err := system.DownloadToTmpDirWithChecksum(artifact.Sha256Url, "%s", artifact.Source)
+		logs.CheckErrorWithMsg(err, "Failed to download %s!\n", artifact.Source)
+		if extension := path.Ext(artifact.Source); extension == ".yaml" || extension == ".yml" {
+			content, err := os.ReadFile(filePath)
+			logs.CheckErrorWithMsg(err, "Failed to read %s!\n", filePath)
+			images = append(images, ImagesInManifest(string(content))...)
+		}
+		artifact.Path, artifact.Sha256, err = stageFile(stagingDir, filePath, "files/")
+		logs.CheckErrorWithTagAndMsg(err, "Failed to bundle %s!\n", artifact.Source)
+	}
+
+	// Git repositories
+	for i, artifact := range filterArtifacts(artifacts, system.ArtifactGitRepo) {
+		logs.WaitPrintf("Bundling %s", artifact.Source)
+		mirrorDir := fmt.Sprintf("%s/git-%d.git", configs.System.TmpDir, i)
+		_, err = system.ExecCmd("git", "clone", "--quiet", "--mirror", system.MirrorUrl(artifact.Source), mirrorDir)
+		logs.CheckErrorWithMsg(err, "Failed to clone %s!\n", artifact.Source)
+		gitBundlePath := fmt.Sprintf("%s/git-%d.bundle", configs.System.TmpDir, i)
+		_, err = system.ExecCmd("git", "-C", mirrorDir, "bundle", "create", gitBundlePath, "--all")
+		logs.CheckErrorWithMsg(err, "Failed to bundle %s!\n", artifact.Source)
+		artifact.Path, artifact.Sha256, err = stageFile(stagingDir, gitBundlePath, "git/")
+		logs.CheckErrorWithMsg(err, "Failed to bundle %s!\n", artifact.Source)
+		// Images deployed by Helm charts & generated manifests
+		if len(artifact.Charts) > 0 || len(artifact.Manifests) > 0 {
+			workDir := fmt.Sprintf("%s/git-%d", configs.System.TmpDir, i)
+			_, err = system.ExecCmd("git", "clone", "--quiet", mirrorDir, workDir)
+			logs.CheckErrorWithMsg(err, "Failed to check out %s!\n", artifact.Source)
+			_, err = system.ExecCmd("git", "-C", workDir, "checkout", "--quiet", artifact.GitRef)
+			logs.CheckErrorWithMsg(err, "Failed to check out %s!\n", artifact.Source)
+			for _, chart := range artifact.Charts {
+				renderedChart, err := system.ExecCmd("helm", "template", path.Base(chart), workDir+"/"+chart)
+				logs.CheckErrorWithMsg(err, "Failed to render Helm chart %s (is helm installed?)!\n", chart)
+				images = append(images, ImagesInManifest(renderedChart)...)
+			}
+			// Generated with network access now, as make can not run offline
+			for _, manifest := range artifact.Manifests {
+				_, err = system.ExecCmd("make", append([]string{"-C", workDir}, manifest.MakeArgs...)...)
+				logs.CheckErrorWithMsg(err, "Failed to generate %s of %s!\n", manifest.Output, artifact.Source)
+				content, err := os.ReadFile(workDir + "/" + manifest.Output)
+				logs.CheckErrorWithMsg(err, "Failed to generate %s of %s!\n", manifest.Output, artifact.Source)
+				images = append(images, ImagesInManifest(string(content))...)
+				manifest.Path, manifest.Sha256, err = stageFile(stagingDir, workDir+"/"+manifest.Output, "files/")
+				logs.CheckErrorWithMsg(err, "Failed to bundle %s of %s!\n", manifest.Output, artifact.Source)
+			}
+		}
+		logs.SuccessPrintf("\n")
+	}
+
+	// Container images (including the ones referenced by manifests & charts)
+	for _, artifact := range filterArtifacts(artifacts, system.ArtifactImage) {
+		images = append(images, artifact.Source)
+	}
+	artifacts = filterArtifacts(artifacts, system.ArtifactFile, system.ArtifactGitRepo, system.ArtifactPackage)
+	platform := "linux/" + configs.System.CurrentArch
+	for _, image := range uniqueImages(images) {
+		logs.WaitPrintf("Bundling image %s", image)
+		artifact := &system.Artifact{Kind: system.ArtifactImage, Source: image}
+		imagePath := configs.System.TmpDir + "/image.tar"
+		// Proxy settings are dropped by sudo
+		_, err = system.ExecCmd("sudo", append(append([]string{"env"}, system.ProxyEnvironment()...), "ctr", "-n", "k8s.io", "images", "pull", "--platform", platform, image)...)
+		logs.CheckErrorWithMsg(err, "Failed to pull image %s!\n", image)
+		_, err = system.ExecCmd("sudo", "ctr", "-n", "k8s.io", "images", "export", "--platform", platform, imagePath, image)
+		logs.CheckErrorWithMsg(err, "Failed to export image %s!\n", image)
+		artifact.Path, artifact.Sha256, err = stageFile(stagingDir, imagePath, "images/")
+		logs.CheckErrorWithTagAndMsg(err, "Failed to bundle image %s!\n", image)
+		artifacts = append(artifacts, artifact)
+	}
+
+	// System packages
+	packageArtifacts := filterArtifacts(artifacts, system.ArtifactPackage)
+	if len(packageArtifacts) > 0 {
+		logs.WaitPrintf("Bundling system packages")
+		err = bundlePackages(stagingDir+"/packages", packageArtifacts)
+		logs.CheckErrorWithTagAndMsg(err, "Failed to bundle system packages!\n")
+	}
+
+	// Write manifest & bundle
+	logs.WaitPrintf("Writing bundle %s", bundlePath)
+	manifest := &system.BundleManifest{
+		Version:   configs.Version,
+		Created:   time.Now().UTC(),
+		OS:        configs.System.CurrentOS,
+		OSVersion: configs.System.CurrentOSVersion,
+		Arch:      configs.System.CurrentArch,
+		Artifacts: artifacts,
+	}
+	manifestContent, err := json.MarshalIndent(manifest, "", "  ")
+	logs.CheckErrorWithMsg(err, "Failed to write bundle %s!\n", bundlePath)
+	err = os.WriteFile(stagingDir+"/"+system.BundleManifestFileName, manifestContent, 0644)
+	logs.CheckErrorWithMsg(err, "Failed to write bundle %s!\n", bundlePath)
+	err = writeArchive(stagingDir, bundlePath)
+	logs.CheckErrorWithTagAndMsg(err, "Failed to write bundle %s!\n", bundlePath)
+}
+
+// Move file into the staging directory under its SHA256 sum, and get its path relative to the bundle root & its sum
+func stageFile(stagingDir string, filePath string, subDir string) (string, string, error) {
+	sha256, err := system.FileSha256(filePath)
+	if err != nil {
+		return "", "", err
+	}
+	return subDir + sha256, sha256, os.Rename(filePath, stagingDir+"/"+subDir+sha256)
+}
+
+// Get artifacts of the given kinds
+func filterArtifacts(artifacts []*system.Artifact, kinds ...string) []*system.Artifact {
+	var filteredArtifacts []*system.Artifact
+	for _, artifact := range artifacts {
+		for _, kind := range kinds {
+			if artifact.Kind == kind {
+				filteredArtifacts = append(filteredArtifacts, artifact)
+			}
+		}
+	}
+	return filteredArtifacts
+}
+
+// Remove duplicated artifacts, keeping the first one
+func uniqueArtifacts(artifacts []*system.Artifact) []*system.Artifact {
+	var result []*system.Artifact
+	seen := map[string]bool{}
+	for _, artifact := range artifacts {
+		if key := artifact.Kind + " " + artifact.Source; !seen[key] {
+			seen[key] = true
+			result = append(result, artifact)
+		}
+	}
+	return result
+}
+
+// Normalize, deduplicate and sort image references
+func uniqueImages(images []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, image := range images {
+		image = NormalizeImageRef(image)
+		if !seen[image] {
+			seen[image] = true
+			result = append(result, image)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Find images referenced in Kubernetes manifests (templated references are ignored)
+func ImagesInManifest(manifest string) []string {
+	var images []string
+	for _, match := range manifestImageRegexp.FindAllStringSubmatch(manifest, -1) {
+		if !strings.ContainsAny(match[1], "${}") {
+			images = append(images, match[1])
+		}
+	}
+	return images
+}
+
+// Expand image reference to the fully qualified form required by ctr (e.g. nginx => docker.io/library/nginx:latest)
+func NormalizeImageRef(image string) string {
+	firstSlash := strings.IndexByte(image, '/')
+	if firstSlash < 0 {
+		image = "docker.io/library/" + image
+	} else if domain := image[:firstSlash]; !strings.ContainsAny(domain, ".:") && domain != "localhost" {
+		image = "docker.io/" + image
+	}
+	if !strings.Contains(image, "@") && !strings.Contains(image[strings.LastIndexByte(image, '/'):], ":") {
+		image += ":latest"
+	}
+	return image
+}
+
+// Download packages with all their dependencies into dir, and write the index of a flat apt repository
+func bundlePackages(dir string, artifacts []*system.Artifact) error {
+	// Resolve dependencies
+	packageSpecs := map[string]string{}
+	for _, artifact := range artifacts {
+		packageName, _, _ := strings.Cut(artifact.Source, "=")
+		dependencies, err := system.ExecCmd("apt-cache", "depends", "--recurse", "--no-recommends", "--no-suggests",
+			"--no-conflicts", "--no-breaks", "--no-replaces", "--no-enhances", packageName)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(dependencies, "\n") {
+			// Dependencies are indented, virtual packages are enclosed in <>
+			if len(line) > 0 && line[0] != ' ' && line[0] != '<' {
+				if _, ok := packageSpecs[line]; !ok {
+					packageSpecs[line] = line
+				}
+			}
+		}
+		packageSpecs[packageName] = artifact.Source
+		artifact.Path = "packages"
+	}
+	var quotedSpecs []string
+	for _, packageSpec := range packageSpecs {
+		quotedSpecs = append(quotedSpecs, system.ShellQuote(packageSpec))
+	}
+	sort.Strings(quotedSpecs)
+	// `apt-get download` always writes to the working directory
+	_, err := system.ExecShellCmd("cd %s && apt-get download %s", system.ShellQuote(dir), strings.Join(quotedSpecs, " "))
+	if err != nil {
+		return err
+	}
+
+	// Write `Packages` index
+	debs, err := filepath.Glob(dir + "/*.deb")
+	if err != nil {
+		return err
+	}
+	packagesIndex := new(strings.Builder)
+	for _, deb := range debs {
+		control, err := system.ExecCmd("dpkg-deb", "--field", deb)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(deb)
+		if err != nil {
+			return err
+		}
+		sha256, err := system.FileSha256(deb)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(packagesIndex, "%s\nFilename: ./%s\nSize: %d\nSHA256: %s\n\n", strings.TrimSpace(control), filepath.Base(deb), info.Size(), sha256)
+	}
+	return os.WriteFile(dir+"/Packages", []byte(packagesIndex.String()), 0644)
+}
+
+// Write the content of dir into a tar archive (gzip compressed if the name ends with .gz or .tgz)
+func writeArchive(dir string, archivePath string) error {
+	archiveFile, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+	defer archiveFile.Close()
+	var writer io.Writer = archiveFile
+	var gzipWriter *gzip.Writer
+	if strings.HasSuffix(archivePath, ".gz") || strings.HasSuffix(archivePath, ".tgz") {
+		gzipWriter = gzip.NewWriter(archiveFile)
+		writer = gzipWriter
+	}
+	tarWriter := tar.NewWriter(writer)
+	err = filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || filePath == dir {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relativePath)
+		header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+		if err := tarWriter.WriteHeader(header); err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		file, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tarWriter, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	if gzipWriter != nil {
+		if err := gzipWriter.Close(); err != nil {
+			return err
+		}
+	}
+	return archiveFile.Close()
+}
@@ -0,0 +1,143 @@
+package bundle
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	system "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/system"
+)
+
+// Runs commands locally, except that images are "exported" as placeholder files instead of being pulled by containerd
+type imageFakingRunner struct {
+	system.LocalRunner
+	images []string
+}
+
+func (runner *imageFakingRunner) Run(ctx context.Context, command *system.Command) (string, error) {
+	if len(command.Args) > 2 && command.Args[0] == "sudo" && strings.Contains(command.String(), " ctr ") {
+		if strings.Contains(command.String(), " export ") {
+			image := command.Args[len(command.Args)-1]
+			runner.images = append(runner.images, image)
+			return "", os.WriteFile(command.Args[len(command.Args)-2], []byte(image), 0644)
+		}
+		return "", nil
+	}
+	return runner.LocalRunner.Run(ctx, command)
+}
+
+func TestImagesInManifest(t *testing.T) {
+	manifest := `
+containers:
+  - name: controller
+    image: gcr.io/knative-releases/controller@sha256:abc
+  - image: "nginx"
+    name: web
+initContainers:
+  - image: {{ .Values.image }}
+    imagePullPolicy: IfNotPresent
+env:
+  - name: IMAGE
+    value: $IMAGE
+`
+	want := []string{"gcr.io/knative-releases/controller@sha256:abc", "nginx"}
+	if images := ImagesInManifest(manifest); !reflect.DeepEqual(images, want) {
+		t.Errorf("ImagesInManifest() = %q, want %q", images, want)
+	}
+}
+
+func TestNormalizeImageRef(t *testing.T) {
+	for image, want := range map[string]string{
+		"nginx":                                "docker.io/library/nginx:latest",
+		"istio/pilot:1.16.3":                   "docker.io/istio/pilot:1.16.3",
+		"registry.k8s.io/pause:3.9":            "registry.k8s.io/pause:3.9",
+		"localhost:5000/app":                   "localhost:5000/app:latest",
+		"gcr.io/knative/controller@sha256:abc": "gcr.io/knative/controller@sha256:abc",
+	} {
+		if normalized := NormalizeImageRef(image); normalized != want {
+			t.Errorf("NormalizeImageRef(%q) = %q, want %q", image, normalized, want)
+		}
+	}
+}
+
+func TestCreateAndOpenBundle(t *testing.T) {
+	manifest := "spec:\n  containers:\n    - image: registry.k8s.io/pause:3.9\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(manifest))
+	}))
+	repoDir := t.TempDir()
+	// Generates a manifest of the image passed in IMG
+	os.WriteFile(repoDir+"/Makefile", []byte("gen:\n\tmkdir -p out && printf 'image: %s\\n' $(IMG) > out/app.yaml\n"), 0644)
+	for _, args := range [][]string{
+		{"init", "--quiet", repoDir},
+		{"-C", repoDir, "add", "Makefile"},
+		{"-C", repoDir, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "init"},
+	} {
+		if _, err := system.ExecCmd("git", args...); err != nil {
+			t.Fatalf("git %v error = %v", args, err)
+		}
+	}
+	runner := &imageFakingRunner{}
+	defer system.SetRunner(system.SetRunner(runner))
+	configs.System.CacheDir = t.TempDir()
+	defer func() { configs.System.CacheDir = "" }()
+
+	generatedManifest := &system.GeneratedManifest{MakeArgs: []string{"gen", "IMG=example.com/app:v1"}, Output: "out/app.yaml"}
+	bundlePath := t.TempDir() + "/bundle.tar.gz"
+	CreateBundle(bundlePath, []*system.Artifact{
+		{Kind: system.ArtifactFile, Source: server.URL + "/canal.yaml"},
+		{Kind: system.ArtifactGitRepo, Source: repoDir, GitRef: "HEAD", Manifests: []*system.GeneratedManifest{generatedManifest}},
+		{Kind: system.ArtifactImage, Source: "nginx"},
+		{Kind: system.ArtifactImage, Source: "registry.k8s.io/pause:3.9"},
+	})
+	wantImages := []string{"docker.io/library/nginx:latest", "example.com/app:v1", "registry.k8s.io/pause:3.9"}
+	if !reflect.DeepEqual(runner.images, wantImages) {
+		t.Errorf("CreateBundle() exported images %q, want %q", runner.images, wantImages)
+	}
+
+	// Everything is served from the bundle once the network is gone
+	server.Close()
+	if err := system.OpenBundle(bundlePath); err != nil {
+		t.Fatalf("OpenBundle() error = %v", err)
+	}
+	defer system.CloseBundle()
+	if !system.IsBundleMode() {
+		t.Fatalf("IsBundleMode() = false after OpenBundle()")
+	}
+	manifestPath, err := system.ResolveUrl(server.URL + "/canal.yaml")
+	if content, _ := os.ReadFile(manifestPath); err != nil || string(content) != manifest {
+		t.Errorf("ResolveUrl(canal.yaml) = %q, %v", content, err)
+	}
+	if _, err := system.ResolveUrl(server.URL + "/missing.yaml"); err == nil {
+		t.Errorf("ResolveUrl(missing.yaml) should fail")
+	}
+	cloneDir := t.TempDir() + "/clone"
+	if err := system.GitClone(repoDir, cloneDir); err != nil {
+		t.Fatalf("GitClone() error = %v", err)
+	}
+	if log, err := system.ExecCmd("git", "-C", cloneDir, "log", "--format=%s"); err != nil || log != "init" {
+		t.Errorf("git log of the clone = %q, %v", log, err)
+	}
+	// Generated manifests are taken from the bundle instead of running make
+	generatedPath, err := system.GenerateManifest(repoDir, cloneDir, generatedManifest)
+	if content, _ := os.ReadFile(generatedPath); err != nil || string(content) != "image: example.com/app:v1\n" || strings.HasPrefix(generatedPath, cloneDir) {
+		t.Errorf("GenerateManifest() = %q (%q), %v", generatedPath, content, err)
+	}
+	configs.System.TmpDir = t.TempDir()
+	defer func() { configs.System.TmpDir = "" }()
+	filePath, err := system.DownloadToTmpDir(server.URL + "/canal.yaml")
+	if content, _ := os.ReadFile(filePath); err != nil || string(content) != manifest {
+		t.Errorf("DownloadToTmpDir(canal.yaml) = %q, %v", content, err)
+	}
+	if err := system.ImportBundleImages(); err != nil {
+		t.Errorf("ImportBundleImages() error = %v", err)
+	}
+	if !strings.HasSuffix(filePath, "/canal.yaml") {
+		t.Errorf("DownloadToTmpDir(canal.yaml) = %q", filePath)
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/bundle
+
+go 1.20
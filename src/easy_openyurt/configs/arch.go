@@ -0,0 +1,26 @@
+package configs
+
+// Names of architectures (as runtime.GOARCH) in the releases of each component
+// Architectures missing from a component have no release of it
+var ArchNames = map[string]map[string]string{
+	"go":                  {"amd64": "amd64", "arm64": "arm64", "arm": "armv6l", "386": "386", "ppc64le": "ppc64le", "s390x": "s390x"},
+	"containerd":          {"amd64": "amd64", "arm64": "arm64", "ppc64le": "ppc64le", "riscv64": "riscv64", "s390x": "s390x"},
+	"runc":                {"amd64": "amd64", "arm64": "arm64", "arm": "armhf", "ppc64le": "ppc64le", "riscv64": "riscv64", "s390x": "s390x"},
+	"cni-plugins":         {"amd64": "amd64", "arm64": "arm64", "arm": "arm", "ppc64le": "ppc64le", "riscv64": "riscv64", "s390x": "s390x", "mips64le": "mips64le"},
+	"kubernetes-packages": {"amd64": "amd64", "arm64": "arm64", "ppc64le": "ppc64le", "s390x": "s390x"},
+	"cri-o-packages":      {"amd64": "amd64", "arm64": "arm64", "ppc64le": "ppc64le", "s390x": "s390x"},
+	"kubernetes-binaries": {"amd64": "amd64", "arm64": "arm64", "arm": "arm", "ppc64le": "ppc64le", "s390x": "s390x"},
+	"crictl":              {"amd64": "amd64", "arm64": "arm64", "arm": "arm", "ppc64le": "ppc64le", "s390x": "s390x"},
+	"cosign":              {"amd64": "amd64", "arm64": "arm64", "arm": "arm", "ppc64le": "ppc64le", "riscv64": "riscv64", "s390x": "s390x"},
+	"helm":                {"amd64": "amd64", "arm64": "arm64", "arm": "arm", "386": "386", "ppc64le": "ppc64le", "s390x": "s390x"},
+	"kustomize":           {"amd64": "amd64", "arm64": "arm64", "ppc64le": "ppc64le", "s390x": "s390x"},
+	"istio":               {"amd64": "amd64", "arm64": "arm64", "arm": "armv7"},
+}
+
+// Get the name of the current architecture in the releases of component
+func ArchName(component string) string {
+	if archName, ok := ArchNames[component][System.CurrentArch]; ok {
+		return archName
+	}
+	return System.CurrentArch
+}
@@ -0,0 +1,42 @@
+package configs
+
+// Runtime of containerd CRI, besides the default runc
+type ContainerdRuntime struct {
+	Type    string         // e.g. "io.containerd.kata.v2"
+	Options map[string]any // Options table of the runtime (strings, numbers, booleans & lists of them)
+}
+
+type ContainerdConfigStruct struct {
+	ConfigPath         string
+	RegistryConfigDir  string              // hosts.toml of each registry is written to <dir>/<host>/hosts.toml
+	ConfigFilePath     string              // JSON file overriding the fields below
+	SandboxImage       string              // Pause image, the one of the Kubernetes version from -alternative-image-repo (or registry.k8s.io) if empty
+	Snapshotter        string              // e.g. "overlayfs", "native" or "zfs"
+	SystemdCgroup      bool                // Use the systemd cgroup driver for runc
+	RegistryMirrors    map[string][]string // Registry host => mirror URLs, tried in order before the registry
+	InsecureRegistries []string            // Registry hosts (host[:port]) reached over plain HTTP or TLS without verification
+	Runtimes           map[string]*ContainerdRuntime
+	PauseVersions      map[string]string // Kubernetes minor version => pause image version used by kubeadm
+}
+
+var Containerd = ContainerdConfigStruct{
+	ConfigPath:         "/etc/containerd/config.toml",
+	RegistryConfigDir:  "/etc/containerd/certs.d",
+	ConfigFilePath:     "",
+	SandboxImage:       "",
+	Snapshotter:        "overlayfs",
+	SystemdCgroup:      true,
+	RegistryMirrors:    map[string][]string{},
+	InsecureRegistries: []string{},
+	Runtimes:           map[string]*ContainerdRuntime{},
+	PauseVersions: map[string]string{
+		"1.25": "3.8",
+		"1.26": "3.9",
+		"1.27": "3.9",
+		"1.28": "3.9",
+		"1.29": "3.9",
+		"1.30": "3.9",
+		"1.31": "3.10",
+		"1.32": "3.10",
+	},
+}
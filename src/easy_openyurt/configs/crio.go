@@ -0,0 +1,15 @@
+package configs
+
+type CrioConfigStruct struct {
+	ConfigFilePath     string              // JSON file overriding the fields below
+	PauseImage         string              // Pause image, the one of the Kubernetes version from -alternative-image-repo (or registry.k8s.io) if empty
+	RegistryMirrors    map[string][]string // Registry prefix => mirror URLs, tried in order before the registry
+	InsecureRegistries []string            // Registries (host[:port]) reached over plain HTTP or TLS without verification
+}
+
+var Crio = CrioConfigStruct{
+	ConfigFilePath:     "",
+	PauseImage:         "",
+	RegistryMirrors:    map[string][]string{},
+	InsecureRegistries: []string{},
+}
@@ -6,8 +6,14 @@ type KnativeConfigStruct struct {
 	KnativeVersion                       string
 	IstioVersion                         string
 	IstioDownloadUrlTemplate             string
+	IstioChecksumUrlTemplate             string
 	IstioOperatorConfigUrl               string
 	MetalLBVersion                       string
+	MetalLBManifestUrlTemplate           string
+	ServingManifestUrlTemplate           string
+	EventingManifestUrlTemplate          string
+	NetIstioManifestUrlTemplate          string
+	IstioImages                          []string
 	MetalLBConfigURLArray                []string
 	LocalRegistryRepoVolumeSize          string
 	LocalRegistryVolumeConfigUrl         string
@@ -18,11 +24,17 @@ type KnativeConfigStruct struct {
 }
 
 var Knative = KnativeConfigStruct{
-	KnativeVersion:           "1.9.2",
-	IstioVersion:             "1.16.3",
-	IstioOperatorConfigUrl:   "https://raw.githubusercontent.com/vhive-serverless/vHive/main/configs/istio/istio-minimal-operator.yaml",
-	IstioDownloadUrlTemplate: "https://github.com/istio/istio/releases/download/%s/istio-%s-linux-%s.tar.gz",
-	MetalLBVersion:           "0.13.9",
+	KnativeVersion:              "1.9.2",
+	IstioVersion:                "1.16.3",
+	IstioOperatorConfigUrl:      "https://raw.githubusercontent.com/vhive-serverless/vHive/main/configs/istio/istio-minimal-operator.yaml",
+	IstioDownloadUrlTemplate:    "https://github.com/istio/istio/releases/download/%s/istio-%s-linux-%s.tar.gz",
+	IstioChecksumUrlTemplate:    "https://github.com/istio/istio/releases/download/%s/istio-%s-linux-%s.tar.gz.sha256",
+	MetalLBVersion:              "0.13.9",
+	MetalLBManifestUrlTemplate:  "https://raw.githubusercontent.com/metallb/metallb/v%s/config/manifests/metallb-native.yaml",
+	ServingManifestUrlTemplate:  "https://github.com/knative/serving/releases/download/knative-v%s/%s",
+	EventingManifestUrlTemplate: "https://github.com/knative/eventing/releases/download/knative-v%s/%s",
+	NetIstioManifestUrlTemplate: "https://github.com/knative/net-istio/releases/download/knative-v%s/net-istio.yaml",
+	IstioImages:                 []string{"docker.io/istio/pilot:%s", "docker.io/istio/proxyv2:%s"},
 	MetalLBConfigURLArray: []string{
 		"https://raw.githubusercontent.com/vhive-serverless/vHive/main/configs/metallb/metallb-ipaddresspool.yaml",
 		"https://raw.githubusercontent.com/vhive-serverless/vHive/main/configs/metallb/metallb-l2advertisement.yaml"},
@@ -35,5 +47,25 @@ var Knative = KnativeConfigStruct{
 }
 
 func (knative *KnativeConfigStruct) GetIstioDownloadUrl() string {
-	return fmt.Sprintf(knative.IstioDownloadUrlTemplate, knative.IstioVersion, knative.IstioVersion, System.CurrentArch)
+	return fmt.Sprintf(knative.IstioDownloadUrlTemplate, knative.IstioVersion, knative.IstioVersion, ArchName("istio"))
+}
+
+func (knative *KnativeConfigStruct) GetIstioChecksumUrl() string {
+	return fmt.Sprintf(knative.IstioChecksumUrlTemplate, knative.IstioVersion, knative.IstioVersion, ArchName("istio"))
+}
+
+func (knative *KnativeConfigStruct) GetMetalLBManifestUrl() string {
+	return fmt.Sprintf(knative.MetalLBManifestUrlTemplate, knative.MetalLBVersion)
+}
+
+func (knative *KnativeConfigStruct) GetServingManifestUrl(fileName string) string {
+	return fmt.Sprintf(knative.ServingManifestUrlTemplate, knative.KnativeVersion, fileName)
+}
+
+func (knative *KnativeConfigStruct) GetEventingManifestUrl(fileName string) string {
+	return fmt.Sprintf(knative.EventingManifestUrlTemplate, knative.KnativeVersion, fileName)
+}
+
+func (knative *KnativeConfigStruct) GetNetIstioManifestUrl() string {
+	return fmt.Sprintf(knative.NetIstioManifestUrlTemplate, knative.KnativeVersion)
 }
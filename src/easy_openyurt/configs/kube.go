@@ -9,6 +9,7 @@ type KubeConfigStruct struct {
 	ApiserverPort             string
 	ApiserverToken            string
 	ApiserverTokenHash        string
+	KubeadmPatchesDir         string // kubeadm patches recorded by `system init` (e.g. the cgroup driver of kubelet)
 }
 
 var Kube = KubeConfigStruct{
@@ -20,4 +21,5 @@ var Kube = KubeConfigStruct{
 	ApiserverPort:             "6443",
 	ApiserverToken:            "",
 	ApiserverTokenHash:        "",
+	KubeadmPatchesDir:         "/etc/easy_openyurt/kubeadm-patches",
 }
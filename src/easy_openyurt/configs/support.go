@@ -0,0 +1,19 @@
+package configs
+
+// Tested combination of a Linux distribution release & Kubernetes minor versions
+type SupportedPlatform struct {
+	OS           string   // ID of os-release
+	OSVersions   []string // VERSION_ID of os-release ("*" matches any version, e.g. of rolling releases)
+	KubeVersions []string // Kubernetes minor versions, e.g. "1.25"
+}
+
+// Combinations of OS & component versions known to work, others are refused unless forced
+// Kubernetes 1.25 is the minimum, older kubeadm releases ignore the patch setting the cgroup driver of kubelet
+var SupportMatrix = []SupportedPlatform{
+	{OS: "ubuntu", OSVersions: []string{"20.04", "22.04"}, KubeVersions: []string{"1.25", "1.26", "1.27", "1.28", "1.29"}},
+	{OS: "rocky", OSVersions: []string{"8", "9"}, KubeVersions: []string{"1.25", "1.26", "1.27", "1.28", "1.29"}},
+	{OS: "centos", OSVersions: []string{"7"}, KubeVersions: []string{"1.25"}},
+	{OS: "centos", OSVersions: []string{"8", "9"}, KubeVersions: []string{"1.25", "1.26", "1.27", "1.28", "1.29"}},
+	{OS: "opensuse-leap", OSVersions: []string{"15.4", "15.5"}, KubeVersions: []string{"1.25", "1.26", "1.27", "1.28", "1.29"}},
+	{OS: "opensuse-tumbleweed", OSVersions: []string{"*"}, KubeVersions: []string{"1.25", "1.26", "1.27", "1.28", "1.29"}},
+}
@@ -2,56 +2,156 @@ package configs
 
 import (
 	"runtime"
+	"time"
 )
 
 // System environment struct
 type SystemEnvironmentStruct struct {
-	GoInstalled                         bool
-	ContainerdInstalled                 bool
-	RuncInstalled                       bool
-	CniPluginsInstalled                 bool
-	SystemdStartUp                      bool
-	GoVersion                           string
-	GoDownloadUrlTemplate               string
-	ContainerdVersion                   string
-	ContainerdDownloadUrlTemplate       string
-	ContainerdSystemdProfileDownloadUrl string
-	RuncVersion                         string
-	RuncDownloadUrlTemplate             string
-	CniPluginsVersion                   string
-	CniPluginsDownloadUrlTemplate       string
-	KubectlVersion                      string
-	KubeadmVersion                      string
-	KubeletVersion                      string
-	Dependencies                        string
-	TmpDir                              string
-	CurrentOS                           string
-	CurrentArch                         string
-	CurrentDir                          string
-	UserHomeDir                         string
+	GoInstalled                          bool
+	ContainerdInstalled                  bool
+	RuncInstalled                        bool
+	CniPluginsInstalled                  bool
+	UpgradePolicy                        string // "keep", "upgrade" or "exact" on components installed before
+	SystemdStartUp                       bool
+	GoVersion                            string
+	GoDownloadUrlTemplate                string
+	GoChecksumUrlTemplate                string
+	ContainerdVersion                    string
+	ContainerdDownloadUrlTemplate        string
+	ContainerdChecksumUrlTemplate        string
+	ContainerdSignatureBundleUrlTemplate string
+	ContainerdSignatureIdentityRegexp    string
+	ContainerdSignatureOidcIssuer        string
+	ContainerdSystemdProfileDownloadUrl  string
+	RuncVersion                          string
+	RuncDownloadUrlTemplate              string
+	RuncChecksumUrlTemplate              string
+	CniPluginsVersion                    string
+	CniPluginsDownloadUrlTemplate        string
+	CniPluginsChecksumUrlTemplate        string
+	ArtifactSha256                       map[string]string // Pinned SHA256 sums by artifact file name, preferred over published checksum files
+	VerifySignatures                     bool
+	KubeSignatureIdentity                string
+	KubeSignatureOidcIssuer              string
+	CosignVersion                        string // Installed to verify cosign signatures unless cosign is found
+	CosignDownloadUrlTemplate            string
+	CosignChecksumUrlTemplate            string
+	DownloadRetries                      int
+	CacheDir                             string
+	BundlePath                           string
+	KubeRepoUrlTemplate                  string // pkgs.k8s.io repository of a Kubernetes minor version, with deb/ & rpm/ below
+	ContainerRuntime                     string // "containerd" (from release binaries) or "crio" (from packages)
+	CrioVersion                          string // Minor version of CRI-O, follows the Kubernetes minor version if empty
+	CgroupVersion                        string // Detected by `SystemInit()`: "v1", "v2" or "hybrid"
+	CgroupDriver                         string // Detected by `SystemInit()`: "systemd" or "cgroupfs"
+	StatePath                            string // State journal recording completed steps
+	Resume                               bool
+	PathMode                             string            // How installed tools are added to PATH: "profile" or "symlink"
+	ProfilePath                          string            // Shell profile listing the directories of installed tools
+	CrioRepoUrlTemplate                  string            // pkgs.k8s.io repository of a CRI-O minor version, with deb/ & rpm/ below
+	Mirrors                              map[string]string // Mirror URLs by host, applied to every download, git clone & apt repository
+	HttpProxy                            string
+	HttpsProxy                           string
+	NoProxy                              string
+	NetworkConfigPath                    string
+	KubeInstallMethod                    string // "package" (from pkgs.k8s.io) or "binary" (from the release server)
+	KubeBinaryDownloadUrlTemplate        string // Checksums are published at the URL with ".sha256" appended
+	KubeletSystemdProfileDownloadUrl     string
+	KubeadmSystemdDropInDownloadUrl      string
+	CrictlVersion                        string // Follows the Kubernetes minor version if empty
+	CrictlDownloadUrlTemplate            string // Checksums are published at the URL with ".sha256" appended
+	KubectlVersion                       string
+	KubeadmVersion                       string
+	KubeletVersion                       string
+	Dependencies                         string
+	MinCpus                              int // Minimum CPUs of the control plane, checked by `system check`
+	MinMemoryMiB                         int // Minimum memory of the control plane, checked by `system check`
+	TmpDir                               string
+	CurrentOS                            string   // ID of os-release on Linux, e.g. "ubuntu"
+	CurrentOSVersion                     string   // VERSION_ID of os-release, e.g. "22.04"
+	CurrentOSCodename                    string   // VERSION_CODENAME of os-release, e.g. "jammy"
+	CurrentOSLike                        []string // ID_LIKE of os-release, e.g. ["rhel", "centos", "fedora"]
+	CurrentArch                          string
+	CurrentDir                           string
+	UserHomeDir                          string
+	Force                                bool // Proceed on combinations of OS & component versions missing from SupportMatrix
+	DryRun                               bool
+	PlanScriptPath                       string
+	Timeout                              time.Duration
+	StepTimeout                          time.Duration
+	StreamOutput                         bool
+	Verbose                              bool
 }
 
 // Current system environment
 var System = SystemEnvironmentStruct{
-	GoInstalled:                         false,
-	ContainerdInstalled:                 false,
-	RuncInstalled:                       false,
-	CniPluginsInstalled:                 false,
-	SystemdStartUp:                      true,
-	GoVersion:                           "1.18.10",
-	GoDownloadUrlTemplate:               "https://go.dev/dl/go%s.linux-%s.tar.gz",
-	ContainerdVersion:                   "1.6.18",
-	ContainerdDownloadUrlTemplate:       "https://github.com/containerd/containerd/releases/download/v%s/containerd-%s-linux-%s.tar.gz",
-	ContainerdSystemdProfileDownloadUrl: "https://raw.githubusercontent.com/containerd/containerd/main/containerd.service",
-	RuncVersion:                         "1.1.4",
-	RuncDownloadUrlTemplate:             "https://github.com/opencontainers/runc/releases/download/v%s/runc.%s",
-	CniPluginsVersion:                   "1.2.0",
-	CniPluginsDownloadUrlTemplate:       "https://github.com/containernetworking/plugins/releases/download/v%s/cni-plugins-linux-%s-v%s.tgz",
-	KubectlVersion:                      "1.25.9-00",
-	KubeadmVersion:                      "1.25.9-00",
-	KubeletVersion:                      "1.25.9-00",
-	CurrentOS:                           runtime.GOOS,
-	CurrentArch:                         runtime.GOARCH,
-	CurrentDir:                          "",
-	UserHomeDir:                         "",
+	GoInstalled:                          false,
+	ContainerdInstalled:                  false,
+	RuncInstalled:                        false,
+	CniPluginsInstalled:                  false,
+	UpgradePolicy:                        "keep",
+	SystemdStartUp:                       true,
+	GoVersion:                            "1.18.10",
+	GoDownloadUrlTemplate:                "https://go.dev/dl/go%s.linux-%s.tar.gz",
+	GoChecksumUrlTemplate:                "https://dl.google.com/go/go%s.linux-%s.tar.gz.sha256",
+	ContainerdVersion:                    "1.6.18",
+	ContainerdDownloadUrlTemplate:        "https://github.com/containerd/containerd/releases/download/v%s/containerd-%s-linux-%s.tar.gz",
+	ContainerdChecksumUrlTemplate:        "https://github.com/containerd/containerd/releases/download/v%s/containerd-%s-linux-%s.tar.gz.sha256sum",
+	ContainerdSignatureBundleUrlTemplate: "", // Not verified: releases before containerd 2.0 are not signed with sigstore, only their SHA256 sums are checked
+	ContainerdSignatureIdentityRegexp:    `^https://github\.com/containerd/containerd/\.github/workflows/release\.yml@refs/tags/v`,
+	ContainerdSignatureOidcIssuer:        "https://token.actions.githubusercontent.com",
+	ContainerdSystemdProfileDownloadUrl:  "https://raw.githubusercontent.com/containerd/containerd/main/containerd.service",
+	RuncVersion:                          "1.1.4",
+	RuncDownloadUrlTemplate:              "https://github.com/opencontainers/runc/releases/download/v%s/runc.%s",
+	RuncChecksumUrlTemplate:              "https://github.com/opencontainers/runc/releases/download/v%s/runc.sha256sum",
+	CniPluginsVersion:                    "1.2.0",
+	CniPluginsDownloadUrlTemplate:        "https://github.com/containernetworking/plugins/releases/download/v%s/cni-plugins-linux-%s-v%s.tgz",
+	CniPluginsChecksumUrlTemplate:        "https://github.com/containernetworking/plugins/releases/download/v%s/cni-plugins-linux-%s-v%s.tgz.sha256",
+	ArtifactSha256:                       map[string]string{},
+	VerifySignatures:                     true,
+	KubeSignatureIdentity:                "krel-staging@k8s-releng-prod.iam.gserviceaccount.com",
+	KubeSignatureOidcIssuer:              "https://accounts.google.com",
+	CosignVersion:                        "2.2.4",
+	CosignDownloadUrlTemplate:            "https://github.com/sigstore/cosign/releases/download/v%s/cosign-linux-%s",
+	CosignChecksumUrlTemplate:            "https://github.com/sigstore/cosign/releases/download/v%s/cosign_checksums.txt",
+	DownloadRetries:                      3,
+	CacheDir:                             "",
+	BundlePath:                           "",
+	KubeRepoUrlTemplate:                  "https://pkgs.k8s.io/core:/stable:/v%s/",
+	ContainerRuntime:                     "containerd",
+	CrioVersion:                          "",
+	CgroupVersion:                        "",
+	CgroupDriver:                         "",
+	StatePath:                            "/var/lib/easy_openyurt/state.json",
+	Resume:                               false,
+	PathMode:                             "profile",
+	ProfilePath:                          "/etc/profile.d/easy_openyurt.sh",
+	CrioRepoUrlTemplate:                  "https://pkgs.k8s.io/addons:/cri-o:/stable:/v%s/",
+	Mirrors:                              map[string]string{},
+	HttpProxy:                            "",
+	HttpsProxy:                           "",
+	NoProxy:                              "",
+	NetworkConfigPath:                    "",
+	KubeInstallMethod:                    "package",
+	KubeBinaryDownloadUrlTemplate:        "https://dl.k8s.io/release/v%s/bin/linux/%s/%s",
+	KubeletSystemdProfileDownloadUrl:     "https://raw.githubusercontent.com/kubernetes/release/v0.16.2/cmd/krel/templates/latest/kubelet/kubelet.service",
+	KubeadmSystemdDropInDownloadUrl:      "https://raw.githubusercontent.com/kubernetes/release/v0.16.2/cmd/krel/templates/latest/kubeadm/10-kubeadm.conf",
+	CrictlVersion:                        "",
+	CrictlDownloadUrlTemplate:            "https://github.com/kubernetes-sigs/cri-tools/releases/download/v%s/crictl-v%s-linux-%s.tar.gz",
+	KubectlVersion:                       "",
+	KubeadmVersion:                       "",
+	KubeletVersion:                       "",
+	MinCpus:                              2,
+	MinMemoryMiB:                         1700,
+	CurrentOS:                            runtime.GOOS,
+	CurrentArch:                          runtime.GOARCH,
+	CurrentDir:                           "",
+	UserHomeDir:                          "",
+	Force:                                false,
+	DryRun:                               false,
+	PlanScriptPath:                       "",
+	Timeout:                              0,
+	StepTimeout:                          30 * time.Minute,
+	StreamOutput:                         false,
+	Verbose:                              false,
 }
@@ -1,25 +1,57 @@
 package configs
 
 type YurtEnvironment struct {
-	HelmInstalled                   bool
-	HelmPublicSigningKeyDownloadUrl string
-	KustomizeInstalled              bool
-	KustomizeScriptDownloadUrl      string
-	MasterAsCloud                   bool
-	WorkerNodeName                  string
-	WorkerAsEdge                    bool
-	Dependencies                    string
-	YurtVersion                     string
+	HelmInstalled                       bool
+	HelmPublicSigningKeyDownloadUrl     string
+	HelmAptRepoUrl                      string
+	HelmSigningKeyFingerprints          []string
+	HelmVersion                         string // Installed from the release tarball where the Helm apt repository is unavailable
+	HelmDownloadUrlTemplate             string
+	HelmChecksumUrlTemplate             string
+	HelmSignatureUrlTemplate            string
+	HelmKeysUrlTemplate                 string // Public keys of the Helm release signers
+	KustomizeInstalled                  bool
+	KustomizeVersion                    string
+	KustomizeDownloadUrlTemplate        string
+	KustomizeChecksumUrlTemplate        string
+	HelmChartsRepoUrl                   string
+	RavenControllerManagerRepoUrl       string
+	RavenAgentRepoUrl                   string
+	RavenVersion                        string
+	YurthubImageTemplate                string
+	RavenControllerManagerImageTemplate string
+	RavenAgentImageTemplate             string
+	MasterAsCloud                       bool
+	WorkerNodeName                      string
+	WorkerAsEdge                        bool
+	Dependencies                        string
+	YurtVersion                         string
 }
 
 var Yurt = YurtEnvironment{
-	HelmInstalled:                   false,
-	HelmPublicSigningKeyDownloadUrl: "https://baltocdn.com/helm/signing.asc",
-	KustomizeInstalled:              false,
-	KustomizeScriptDownloadUrl:      "https://raw.githubusercontent.com/kubernetes-sigs/kustomize/master/hack/install_kustomize.sh",
-	MasterAsCloud:                   true,
-	WorkerNodeName:                  "",
-	WorkerAsEdge:                    true,
-	Dependencies:                    "",
-	YurtVersion:                     "1.2.1",
+	HelmInstalled:                       false,
+	HelmPublicSigningKeyDownloadUrl:     "https://baltocdn.com/helm/signing.asc",
+	HelmAptRepoUrl:                      "https://baltocdn.com/helm/stable/debian/",
+	HelmSigningKeyFingerprints:          []string{"81BF832E2F19CD2AA0471959294AC4827C1A168A"},
+	HelmVersion:                         "3.12.0",
+	HelmDownloadUrlTemplate:             "https://get.helm.sh/helm-v%s-linux-%s.tar.gz",
+	HelmChecksumUrlTemplate:             "https://get.helm.sh/helm-v%s-linux-%s.tar.gz.sha256sum",
+	HelmSignatureUrlTemplate:            "https://github.com/helm/helm/releases/download/v%s/helm-v%s-linux-%s.tar.gz.asc",
+	HelmKeysUrlTemplate:                 "https://raw.githubusercontent.com/helm/helm/v%s/KEYS",
+	KustomizeInstalled:                  false,
+	KustomizeVersion:                    "5.0.1",
+	KustomizeDownloadUrlTemplate:        "https://github.com/kubernetes-sigs/kustomize/releases/download/kustomize%%2Fv%s/kustomize_v%s_linux_%s.tar.gz",
+	KustomizeChecksumUrlTemplate:        "https://github.com/kubernetes-sigs/kustomize/releases/download/kustomize%%2Fv%s/checksums.txt",
+	HelmChartsRepoUrl:                   "https://github.com/openyurtio/openyurt-helm.git",
+	RavenControllerManagerRepoUrl:       "https://github.com/openyurtio/raven-controller-manager.git",
+	RavenAgentRepoUrl:                   "https://github.com/openyurtio/raven.git",
+	RavenVersion:                        "0.3.0",
+	YurthubImageTemplate:                "openyurt/yurthub:v%s",
+	RavenControllerManagerImageTemplate: "openyurt/raven-controller-manager:v%s",
+	RavenAgentImageTemplate:             "openyurt/raven-agent:v%s",
+	MasterAsCloud:                       true,
+	WorkerNodeName:                      "",
+	WorkerAsEdge:                        true,
+	Dependencies:                        "",
+	YurtVersion:                         "1.2.1",
 }
@@ -1,9 +1,11 @@
 package knative
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
 	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
@@ -36,12 +38,25 @@ func ParseSubcommandKnative(args []string) {
 	knativeFlags.StringVar(&configs.Knative.IstioVersion, "istio-version", configs.Knative.IstioVersion, "Istio version")
 	knativeFlags.StringVar(&configs.Knative.MetalLBVersion, "metalLB-version", configs.Knative.MetalLBVersion, "MetalLB version")
 	knativeFlags.BoolVar(&configs.Knative.VHiveMode, "vhive-mode", configs.Knative.VHiveMode, "vHive mode")
-	knativeFlags.Parse(args[2:])
+	system.AddGlobalFlags(knativeFlags)
+	system.AddStateFlags(knativeFlags)
+	system.AddPathFlags(knativeFlags)
+	subcommand := fmt.Sprintf("knative %s %s", nodeRole, operation)
+	err := system.ParseStateFlags(knativeFlags, subcommand, args[2:])
 	// Show help
 	if help {
 		knativeFlags.Usage()
 		os.Exit(0)
 	}
+	logs.CheckErrorWithMsg(err, "Failed to resume `%s`!\n", subcommand)
+	system.ApplyGlobalFlags()
+	// Check parameters
+	err = errors.Join(
+		system.ValidateVersion("knative-version", configs.Knative.KnativeVersion),
+		system.ValidateVersion("istio-version", configs.Knative.IstioVersion),
+		system.ValidateVersion("metalLB-version", configs.Knative.MetalLBVersion),
+		system.ValidatePathFlags())
+	logs.CheckErrorWithMsg(err, "Invalid parameters!\n")
 
 	var vHiveMode string
 	if configs.Knative.VHiveMode {
@@ -50,8 +65,12 @@ func ParseSubcommandKnative(args []string) {
 		vHiveMode = "false"
 	}
 
+	err = system.StartStateJournal(subcommand)
+	logs.CheckErrorWithMsg(err, "Failed to open the state journal %s!\n", configs.System.StatePath)
 	InstallKnativeServing()
 	InstallKnativeEventing()
+	err = system.FinishStateJournal()
+	logs.CheckErrorWithMsg(err, "Failed to update the state journal %s!\n", configs.System.StatePath)
 
 	logs.SuccessPrintf("Init Knative Successfully! (vHive mode: %s)\n", vHiveMode)
 }
@@ -60,72 +79,93 @@ func ParseSubcommandKnative(args []string) {
 func InstallKnativeServing() {
 	var err error
 
+	// Check releases for the current architecture, before anything is modified
+	err = system.CheckArchSupport("istio")
+	logs.CheckErrorWithMsg(err, "Unsupported architecture %s!\n", configs.System.CurrentArch)
+
 	system.CreateTmpDir()
 	defer system.CleanUpTmpDir()
 
+	// Steps on the cluster are journaled per cluster, a new cluster installs everything again
+	cluster := clusterUid()
+
 	// Install and configure MetalLB
-	logs.WaitPrintf("Installing and configuring MetalLB")
-	_, err = system.ExecShellCmd(`kubectl get configmap kube-proxy -n kube-system -o yaml | sed -e "s/strictARP: false/strictARP: true/" | kubectl apply -f - -n kube-system`)
-	logs.CheckErrorWithMsg(err, "Failed to install and configure MetalLB!")
-	_, err = system.ExecShellCmd("kubectl apply -f https://raw.githubusercontent.com/metallb/metallb/v%s/config/manifests/metallb-native.yaml", configs.Knative.MetalLBVersion)
-	logs.CheckErrorWithMsg(err, "Failed to install and configure MetalLB!")
-	_, err = system.ExecShellCmd("kubectl -n metallb-system wait deploy controller --timeout=90s --for=condition=Available")
-	logs.CheckErrorWithMsg(err, "Failed to install and configure MetalLB!")
-	for _, value := range configs.Knative.MetalLBConfigURLArray {
-		_, err = system.ExecShellCmd("kubectl apply -f %s", value)
+	system.RunStep("knative/install-metallb", []any{cluster, configs.Knative.MetalLBVersion, configs.Knative.MetalLBConfigURLArray}, func() {
+		logs.WaitPrintf("Installing and configuring MetalLB")
+		_, err := system.ExecShellCmd(`kubectl get configmap kube-proxy -n kube-system -o yaml | sed -e "s/strictARP: false/strictARP: true/" | kubectl apply -f - -n kube-system`) // Constant pipeline
 		logs.CheckErrorWithMsg(err, "Failed to install and configure MetalLB!")
-	}
-	logs.SuccessPrintf("\n")
+		err = kubectlRemoteManifest("apply", configs.Knative.GetMetalLBManifestUrl())
+		logs.CheckErrorWithMsg(err, "Failed to install and configure MetalLB!")
+		_, err = system.ExecCmd("kubectl", "-n", "metallb-system", "wait", "deploy", "controller", "--timeout=90s", "--for=condition=Available")
+		logs.CheckErrorWithMsg(err, "Failed to install and configure MetalLB!")
+		for _, value := range configs.Knative.MetalLBConfigURLArray {
+			err = kubectlRemoteManifest("apply", value)
+			logs.CheckErrorWithMsg(err, "Failed to install and configure MetalLB!")
+		}
+		logs.SuccessPrintf("\n")
+	})
 
 	// Install istio
-	// Download istio
-	logs.WaitPrintf("Downloading istio")
-	istioFilePath, err := system.DownloadToTmpDir(configs.Knative.GetIstioDownloadUrl())
-	logs.CheckErrorWithTagAndMsg(err, "Failed to download istio!")
-	// Extract istio
-	logs.WaitPrintf("Extracting istio")
-	err = system.ExtractToDir(istioFilePath, "/usr/local", true)
-	logs.CheckErrorWithTagAndMsg(err, "Failed to extract istio!")
-	// Update PATH
-	err = system.AppendDirToPath("/usr/local/istio-%s/bin", configs.Knative.IstioVersion)
-	logs.CheckErrorWithMsg(err, "Failed to update PATH!")
-	// Deploy istio operator
-	logs.WaitPrintf("Deploying istio operator")
-	operatorConfigPath, err := system.DownloadToTmpDir(configs.Knative.IstioOperatorConfigUrl)
-	logs.CheckErrorWithMsg(err, "Failed to deploy istio operator!")
-	_, err = system.ExecShellCmd("/usr/local/istio-%s/bin/istioctl install -y -f %s", configs.Knative.IstioVersion, operatorConfigPath)
-	logs.CheckErrorWithTagAndMsg(err, "Failed to deploy istio operator!")
+	system.RunStep("knative/install-istio", []any{cluster, configs.Knative.IstioVersion, configs.Knative.IstioOperatorConfigUrl}, func() {
+		// Download istio
+		logs.WaitPrintf("Downloading istio")
+		istioFilePath, err := system.DownloadToTmpDirWithChecksum(configs.Knative.GetIstioChecksumUrl(), "%s", configs.Knative.GetIstioDownloadUrl())
+		logs.CheckErrorWithTagAndMsg(err, "Failed to download istio!")
+		// Extract istio
+		logs.WaitPrintf("Extracting istio")
+		err = system.ExtractToDir(istioFilePath, "/usr/local", true)
+		logs.CheckErrorWithTagAndMsg(err, "Failed to extract istio!")
+		// Update PATH
+		err = system.AppendDirToPath("/usr/local/istio-%s/bin", configs.Knative.IstioVersion)
+		logs.CheckErrorWithMsg(err, "Failed to update PATH!")
+		// Deploy istio operator
+		logs.WaitPrintf("Deploying istio operator")
+		operatorConfigPath, err := system.DownloadToTmpDir(configs.Knative.IstioOperatorConfigUrl)
+		logs.CheckErrorWithMsg(err, "Failed to deploy istio operator!")
+		_, err = system.ExecCmd(fmt.Sprintf("/usr/local/istio-%s/bin/istioctl", configs.Knative.IstioVersion), "install", "-y", "-f", operatorConfigPath)
+		logs.CheckErrorWithTagAndMsg(err, "Failed to deploy istio operator!")
+	})
 
 	// Install Knative Serving component
-	logs.WaitPrintf("Installing Knative Serving component")
-	_, err = system.ExecShellCmd("kubectl apply -f https://github.com/knative/serving/releases/download/knative-v%s/serving-crds.yaml", configs.Knative.KnativeVersion)
-	logs.CheckErrorWithMsg(err, "Failed to install Knative Serving component!")
-	_, err = system.ExecShellCmd("kubectl apply -f https://github.com/knative/serving/releases/download/knative-v%s/serving-core.yaml", configs.Knative.KnativeVersion)
-	logs.CheckErrorWithTagAndMsg(err, "Failed to install Knative Serving component!")
-
-	// Install local cluster registry
-	logs.WaitPrintf("Installing local cluster registry")
-	_, err = system.ExecShellCmd("kubectl create namespace registry")
-	logs.CheckErrorWithMsg(err, "Failed to install local cluster registry!")
-	configFilePath, err := system.DownloadToTmpDir("%s", configs.Knative.LocalRegistryVolumeConfigUrl)
-	logs.CheckErrorWithMsg(err, "Failed to install local cluster registry!")
-	_, err = system.ExecShellCmd("REPO_VOL_SIZE=%s envsubst < %s | kubectl create --filename -", configs.Knative.LocalRegistryRepoVolumeSize, configFilePath)
-	logs.CheckErrorWithMsg(err, "Failed to install local cluster registry!")
-	_, err = system.ExecShellCmd("kubectl create -f %s && kubectl apply -f %s", configs.Knative.LocalRegistryDockerRegistryConfigUrl, configs.Knative.LocalRegistryHostUpdateConfigUrl)
-	logs.CheckErrorWithTagAndMsg(err, "Failed to install local cluster registry!")
+	system.RunStep("knative/install-serving", []any{cluster, configs.Knative.KnativeVersion}, func() {
+		logs.WaitPrintf("Installing Knative Serving component")
+		err := kubectlRemoteManifest("apply", configs.Knative.GetServingManifestUrl("serving-crds.yaml"))
+		logs.CheckErrorWithMsg(err, "Failed to install Knative Serving component!")
+		err = kubectlRemoteManifest("apply", configs.Knative.GetServingManifestUrl("serving-core.yaml"))
+		logs.CheckErrorWithTagAndMsg(err, "Failed to install Knative Serving component!")
+	})
+
+	// Install local cluster registry (applied rather than created, so that it may exist already)
+	system.RunStep("knative/install-local-registry", []any{cluster, configs.Knative.LocalRegistryRepoVolumeSize}, func() {
+		logs.WaitPrintf("Installing local cluster registry")
+		_, err := system.ExecShellCmd("kubectl create namespace registry --dry-run=client -o yaml | kubectl apply -f -") // Constant pipeline
+		logs.CheckErrorWithMsg(err, "Failed to install local cluster registry!")
+		configFilePath, err := system.DownloadToTmpDir("%s", configs.Knative.LocalRegistryVolumeConfigUrl)
+		logs.CheckErrorWithMsg(err, "Failed to install local cluster registry!")
+		_, err = system.ExecShellCmd("REPO_VOL_SIZE=%s envsubst < %s | kubectl apply --filename -", system.ShellQuote(configs.Knative.LocalRegistryRepoVolumeSize), system.ShellQuote(configFilePath))
+		logs.CheckErrorWithMsg(err, "Failed to install local cluster registry!")
+		err = kubectlRemoteManifest("apply", configs.Knative.LocalRegistryDockerRegistryConfigUrl)
+		logs.CheckErrorWithMsg(err, "Failed to install local cluster registry!")
+		err = kubectlRemoteManifest("apply", configs.Knative.LocalRegistryHostUpdateConfigUrl)
+		logs.CheckErrorWithTagAndMsg(err, "Failed to install local cluster registry!")
+	})
 
 	// Configure Magic DNS
-	logs.WaitPrintf("Configuring Magic DNS")
-	_, err = system.ExecShellCmd("kubectl apply -f %s", configs.Knative.MagicDNSConfigUrl)
-	logs.CheckErrorWithTagAndMsg(err, "Failed to configure Magic DNS!")
+	system.RunStep("knative/configure-magic-dns", []any{cluster, configs.Knative.MagicDNSConfigUrl}, func() {
+		logs.WaitPrintf("Configuring Magic DNS")
+		err := kubectlRemoteManifest("apply", configs.Knative.MagicDNSConfigUrl)
+		logs.CheckErrorWithTagAndMsg(err, "Failed to configure Magic DNS!")
+	})
 
 	// Install networking layer
-	logs.WaitPrintf("Installing networking layer")
-	_, err = system.ExecShellCmd("kubectl apply -f https://github.com/knative/net-istio/releases/download/knative-v%s/net-istio.yaml", configs.Knative.KnativeVersion)
-	logs.CheckErrorWithTagAndMsg(err, "Failed to install networking layer!")
+	system.RunStep("knative/install-networking-layer", []any{cluster, configs.Knative.KnativeVersion}, func() {
+		logs.WaitPrintf("Installing networking layer")
+		err := kubectlRemoteManifest("apply", configs.Knative.GetNetIstioManifestUrl())
+		logs.CheckErrorWithTagAndMsg(err, "Failed to install networking layer!")
+	})
 
 	// Logs for verification
-	_, err = system.ExecShellCmd("kubectl get pods -n knative-serving")
+	_, err = system.ExecCmd("kubectl", "get", "pods", "-n", "knative-serving")
 	logs.CheckErrorWithMsg(err, "Verification Failed!")
 
 	// // Configure DNS
@@ -136,28 +176,83 @@ func InstallKnativeServing() {
 
 // Install Knative Eventing
 func InstallKnativeEventing() {
+	cluster := clusterUid()
+
 	// Install Knative Eventing component
-	logs.WaitPrintf("Installing Knative Eventing component")
-	_, err := system.ExecShellCmd("kubectl apply -f https://github.com/knative/eventing/releases/download/knative-v%s/eventing-crds.yaml", configs.Knative.KnativeVersion)
-	logs.CheckErrorWithMsg(err, "Failed to install Knative Eventing component!")
-	_, err = system.ExecShellCmd("kubectl apply -f https://github.com/knative/eventing/releases/download/knative-v%s/eventing-core.yaml", configs.Knative.KnativeVersion)
-	logs.CheckErrorWithTagAndMsg(err, "Failed to install Knative Eventing component!")
+	system.RunStep("knative/install-eventing", []any{cluster, configs.Knative.KnativeVersion}, func() {
+		logs.WaitPrintf("Installing Knative Eventing component")
+		err := kubectlRemoteManifest("apply", configs.Knative.GetEventingManifestUrl("eventing-crds.yaml"))
+		logs.CheckErrorWithMsg(err, "Failed to install Knative Eventing component!")
+		err = kubectlRemoteManifest("apply", configs.Knative.GetEventingManifestUrl("eventing-core.yaml"))
+		logs.CheckErrorWithTagAndMsg(err, "Failed to install Knative Eventing component!")
 
-	// Logs for verification
-	_, err = system.ExecShellCmd("kubectl get pods -n knative-eventing")
-	logs.CheckErrorWithMsg(err, "Verification Failed!")
+		// Logs for verification
+		_, err = system.ExecCmd("kubectl", "get", "pods", "-n", "knative-eventing")
+		logs.CheckErrorWithMsg(err, "Verification Failed!")
 
-	// Install a default Channel (messaging) layer
-	logs.WaitPrintf("Installing a default Channel (messaging) layer")
-	_, err = system.ExecShellCmd("kubectl apply -f https://github.com/knative/eventing/releases/download/knative-v%s/in-memory-channel.yaml", configs.Knative.KnativeVersion)
-	logs.CheckErrorWithTagAndMsg(err, "Failed to install a default Channel (messaging) layer!")
+		// Install a default Channel (messaging) layer
+		logs.WaitPrintf("Installing a default Channel (messaging) layer")
+		err = kubectlRemoteManifest("apply", configs.Knative.GetEventingManifestUrl("in-memory-channel.yaml"))
+		logs.CheckErrorWithTagAndMsg(err, "Failed to install a default Channel (messaging) layer!")
 
-	// Install a Broker layer
-	logs.WaitPrintf("Installing a Broker layer")
-	_, err = system.ExecShellCmd("kubectl apply -f https://github.com/knative/eventing/releases/download/knative-v%s/mt-channel-broker.yaml", configs.Knative.KnativeVersion)
-	logs.CheckErrorWithTagAndMsg(err, "Failed to install a Broker layer!")
+		// Install a Broker layer
+		logs.WaitPrintf("Installing a Broker layer")
+		err = kubectlRemoteManifest("apply", configs.Knative.GetEventingManifestUrl("mt-channel-broker.yaml"))
+		logs.CheckErrorWithTagAndMsg(err, "Failed to install a Broker layer!")
+	})
 
 	// Logs for verification
-	_, err = system.ExecShellCmd("kubectl --namespace istio-system get service istio-ingressgateway")
+	_, err := system.ExecCmd("kubectl", "--namespace", "istio-system", "get", "service", "istio-ingressgateway")
 	logs.CheckErrorWithMsg(err, "Verification Failed!")
 }
+
+// Get the UID of the kube-system namespace, which identifies the cluster
+func clusterUid() string {
+	uid, err := system.ExecCmd("kubectl", "get", "namespace", "kube-system", "-o", "jsonpath={.metadata.uid}")
+	if err != nil {
+		logs.WarnPrintf("Failed to identify the cluster, steps on it are not skipped: %v\n", err)
+		return time.Now().String()
+	}
+	return uid
+}
+
+// Run `kubectl <operation> -f` on a remote manifest (its bundled copy in bundle mode)
+func kubectlRemoteManifest(operation string, url string) error {
+	manifest, err := system.ResolveUrl(url)
+	if err != nil {
+		return err
+	}
+	_, err = system.ExecCmd("kubectl", operation, "-f", manifest)
+	return err
+}
+
+// Get artifacts needed by `knative` for the configured versions
+func BundleArtifacts() ([]*system.Artifact, error) {
+	if err := system.CheckArchSupport("istio"); err != nil {
+		return nil, err
+	}
+	artifacts := []*system.Artifact{
+		{Kind: system.ArtifactFile, Source: configs.Knative.GetIstioDownloadUrl(), Sha256Url: configs.Knative.GetIstioChecksumUrl()},
+		{Kind: system.ArtifactFile, Source: configs.Knative.IstioOperatorConfigUrl},
+		{Kind: system.ArtifactFile, Source: configs.Knative.GetMetalLBManifestUrl()},
+		{Kind: system.ArtifactFile, Source: configs.Knative.GetServingManifestUrl("serving-crds.yaml")},
+		{Kind: system.ArtifactFile, Source: configs.Knative.GetServingManifestUrl("serving-core.yaml")},
+		{Kind: system.ArtifactFile, Source: configs.Knative.LocalRegistryVolumeConfigUrl},
+		{Kind: system.ArtifactFile, Source: configs.Knative.LocalRegistryDockerRegistryConfigUrl},
+		{Kind: system.ArtifactFile, Source: configs.Knative.LocalRegistryHostUpdateConfigUrl},
+		{Kind: system.ArtifactFile, Source: configs.Knative.MagicDNSConfigUrl},
+		{Kind: system.ArtifactFile, Source: configs.Knative.GetNetIstioManifestUrl()},
+		{Kind: system.ArtifactFile, Source: configs.Knative.GetEventingManifestUrl("eventing-crds.yaml")},
+		{Kind: system.ArtifactFile, Source: configs.Knative.GetEventingManifestUrl("eventing-core.yaml")},
+		{Kind: system.ArtifactFile, Source: configs.Knative.GetEventingManifestUrl("in-memory-channel.yaml")},
+		{Kind: system.ArtifactFile, Source: configs.Knative.GetEventingManifestUrl("mt-channel-broker.yaml")},
+	}
+	for _, url := range configs.Knative.MetalLBConfigURLArray {
+		artifacts = append(artifacts, &system.Artifact{Kind: system.ArtifactFile, Source: url})
+	}
+	// Images deployed by istioctl are not listed in any manifest
+	for _, imageTemplate := range configs.Knative.IstioImages {
+		artifacts = append(artifacts, &system.Artifact{Kind: system.ArtifactImage, Source: fmt.Sprintf(imageTemplate, configs.Knative.IstioVersion)})
+	}
+	return artifacts, nil
+}
@@ -0,0 +1,62 @@
+package knative
+
+import (
+	"testing"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	system "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/system"
+)
+
+func TestInstallKnativeServing(t *testing.T) {
+	fakeRunner := system.NewFakeRunner()
+	defer system.SetRunner(system.SetRunner(fakeRunner))
+	configs.System.UserHomeDir = t.TempDir()
+
+	InstallKnativeServing()
+
+	for _, pattern := range []string{
+		"metallb/v" + configs.Knative.MetalLBVersion + "/config/manifests/metallb-native.yaml",
+		configs.Knative.GetIstioDownloadUrl(),
+		"/usr/local/istio-" + configs.Knative.IstioVersion + "/bin/istioctl install -y -f",
+		"knative-v" + configs.Knative.KnativeVersion + "/serving-core.yaml",
+		"knative-v" + configs.Knative.KnativeVersion + "/net-istio.yaml",
+		"kubectl create namespace registry --dry-run=client -o yaml | kubectl apply -f -",
+	} {
+		if !fakeRunner.Executed(pattern) {
+			t.Errorf("InstallKnativeServing() did not execute %q\n%v", pattern, fakeRunner)
+		}
+	}
+	if fakeRunner.Index("serving-crds.yaml") > fakeRunner.Index("serving-core.yaml") {
+		t.Errorf("InstallKnativeServing() should apply CRDs before the core components\n%v", fakeRunner)
+	}
+}
+
+func TestInstallKnativeServingTwice(t *testing.T) {
+	fakeRunner := system.NewFakeRunner()
+	fakeRunner.On("kubectl get namespace kube-system", system.FakeResponse{Stdout: "6a1e0c3b-5a4f-4a8e-9d63-1b0f4f6f2a10"})
+	defer system.SetRunner(system.SetRunner(fakeRunner))
+	configs.System.UserHomeDir = t.TempDir()
+	previousStatePath := configs.System.StatePath
+	configs.System.StatePath = t.TempDir() + "/state.json"
+	defer func() { configs.System.StatePath = previousStatePath }()
+
+	for run := 1; run <= 2; run++ {
+		if err := system.StartStateJournal("knative master init"); err != nil {
+			t.Fatal(err)
+		}
+		InstallKnativeServing()
+		if err := system.FinishStateJournal(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Steps of the second run are skipped, except verification
+	if count := fakeRunner.Count("istioctl install"); count != 1 {
+		t.Errorf("InstallKnativeServing() twice deployed istio %d times, want 1\n%v", count, fakeRunner)
+	}
+	if count := fakeRunner.Count("kubectl get pods -n knative-serving"); count != 2 {
+		t.Errorf("InstallKnativeServing() twice verified %d times, want 2\n%v", count, fakeRunner)
+	}
+	if fakeRunner.Executed("kubectl create -f") || fakeRunner.Executed("kubectl create --filename") {
+		t.Errorf("InstallKnativeServing() should apply manifests, which may exist already\n%v", fakeRunner)
+	}
+}
@@ -1,9 +1,11 @@
 package kube
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
 
 	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
@@ -11,16 +13,24 @@ import (
 	system "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/system"
 )
 
+var (
+	kubeadmJoinRegexp      = regexp.MustCompile(`kubeadm join (\S+):(\S+) --token (\S+)`) // Extract API server address, port and token from `kubeadm init` output
+	kubeadmTokenHashRegexp = regexp.MustCompile(`sha256:[a-f0-9]+`)                       // Extract discovery token CA cert hash from `kubeadm init` output
+)
+
 // Parse parameters for subcommand `kube`
 func ParseSubcommandKube(args []string) {
 	nodeRole := args[0]
 	operation := args[1]
 	var help bool
+	var runtime string
 	// Add parameters to flag set
 	kubeFlagsName := fmt.Sprintf("%s kube %s %s", os.Args[0], nodeRole, operation)
 	kubeFlags := flag.NewFlagSet(kubeFlagsName, flag.ExitOnError)
 	kubeFlags.BoolVar(&help, "help", false, "Show help")
 	kubeFlags.BoolVar(&help, "h", false, "Show help")
+	kubeFlags.StringVar(&runtime, "runtime", "", "Container runtime (containerd | crio), detected from the existing CRI sockets if not given")
+	system.AddGlobalFlags(kubeFlags)
 	switch nodeRole {
 	case "master":
 		// Parse parameters for `kube master init`
@@ -28,15 +38,35 @@ func ParseSubcommandKube(args []string) {
 			logs.InfoPrintf("Usage: %s %s %s init [parameters...]\n", os.Args[0], os.Args[1], nodeRole)
 			logs.FatalPrintf("Invalid operation: <operation> -> %s\n", operation)
 		}
-		kubeFlags.StringVar(&configs.Kube.K8sVersion, "k8s-version", configs.Kube.K8sVersion, "Kubernetes version")
+		kubeFlags.StringVar(&configs.Kube.K8sVersion, "k8s-version", configs.Kube.K8sVersion, "Kubernetes version (if not given, the version of the installed kubeadm)")
 		kubeFlags.StringVar(&configs.Kube.AlternativeImageRepo, "alternative-image-repo", configs.Kube.AlternativeImageRepo, "Alternative image repository")
 		kubeFlags.StringVar(&configs.Kube.ApiserverAdvertiseAddress, "apiserver-advertise-address", configs.Kube.ApiserverAdvertiseAddress, "Kubernetes API server advertise address")
+		kubeFlags.StringVar(&configs.Kube.PodNetworkCidr, "pod-network-cidr", configs.Kube.PodNetworkCidr, "Pod network CIDR")
 		kubeFlags.Parse(args[2:])
 		// Show help
 		if help {
 			kubeFlags.Usage()
 			os.Exit(0)
 		}
+		system.ApplyGlobalFlags()
+		// Deploy the version of the installed kubeadm by default
+		if !system.IsFlagSet(kubeFlags, "k8s-version") {
+			if kubeadmVersion, err := system.InstalledKubeadmVersion(); err == nil && len(kubeadmVersion) > 0 {
+				configs.Kube.K8sVersion = kubeadmVersion
+			}
+		}
+		// Check parameters
+		err := system.ValidateVersion("k8s-version", configs.Kube.K8sVersion)
+		if len(configs.Kube.AlternativeImageRepo) > 0 {
+			err = errors.Join(err, system.ValidateImageRepo("alternative-image-repo", configs.Kube.AlternativeImageRepo))
+		}
+		if len(configs.Kube.ApiserverAdvertiseAddress) > 0 {
+			err = errors.Join(err, system.ValidateAddress("apiserver-advertise-address", configs.Kube.ApiserverAdvertiseAddress))
+		}
+		err = errors.Join(err, system.ValidateCidr("pod-network-cidr", configs.Kube.PodNetworkCidr))
+		err = errors.Join(err, resolveContainerRuntime(runtime))
+		logs.CheckErrorWithMsg(err, "Invalid parameters!\n")
+		system.EnsureSupportedPlatform(configs.Kube.K8sVersion)
 		kube_master_init()
 		logs.SuccessPrintf("Master node key information has been written to %s/masterKey.yaml! Check for details.\n", configs.System.CurrentDir)
 	case "worker":
@@ -55,6 +85,7 @@ func ParseSubcommandKube(args []string) {
 			kubeFlags.Usage()
 			os.Exit(0)
 		}
+		system.ApplyGlobalFlags()
 		// Check required parameters
 		if len(configs.Kube.ApiserverAdvertiseAddress) == 0 {
 			kubeFlags.Usage()
@@ -68,6 +99,13 @@ func ParseSubcommandKube(args []string) {
 			kubeFlags.Usage()
 			logs.FatalPrintf("Parameter --apiserver-token-hash needed!\n")
 		}
+		err := errors.Join(
+			system.ValidateAddress("apiserver-advertise-address", configs.Kube.ApiserverAdvertiseAddress),
+			system.ValidatePort("apiserver-port", configs.Kube.ApiserverPort),
+			system.ValidateToken("apiserver-token", configs.Kube.ApiserverToken),
+			system.ValidateTokenHash("apiserver-token-hash", configs.Kube.ApiserverTokenHash),
+			resolveContainerRuntime(runtime))
+		logs.CheckErrorWithMsg(err, "Invalid parameters!\n")
 		kube_worker_join()
 		logs.SuccessPrintf("Successfully joined Kubernetes cluster!\n")
 	default:
@@ -86,51 +124,63 @@ func kube_master_init() {
 	defer system.CleanUpTmpDir()
 
 	// Pre-pull Image
-	logs.WaitPrintf("Pre-Pulling required images")
-	shellCmd := fmt.Sprintf("sudo kubeadm config images pull --kubernetes-version %s ", configs.Kube.K8sVersion)
-	if len(configs.Kube.AlternativeImageRepo) > 0 {
-		shellCmd = fmt.Sprintf(shellCmd+"--image-repository %s ", configs.Kube.AlternativeImageRepo)
+	if system.IsBundleMode() {
+		logs.WaitPrintf("Importing images from bundle")
+		err = system.ImportBundleImages()
+		logs.CheckErrorWithTagAndMsg(err, "Failed to import images from bundle!\n")
+	} else {
+		logs.WaitPrintf("Pre-Pulling required images")
+		_, err = system.ExecCmd("sudo", append(kubeadmImagesArgs("pull"), criSocketArgs()...)...)
+		logs.CheckErrorWithTagAndMsg(err, "Failed to pre-pull required images!\n")
 	}
-	_, err = system.ExecShellCmd(shellCmd)
-	logs.CheckErrorWithTagAndMsg(err, "Failed to pre-pull required images!\n")
 
 	// Deploy Kubernetes
 	logs.WaitPrintf("Deploying Kubernetes(version %s)", configs.Kube.K8sVersion)
-	shellCmd = fmt.Sprintf("sudo kubeadm init --kubernetes-version %s --pod-network-cidr=\"%s\" ", configs.Kube.K8sVersion, configs.Kube.PodNetworkCidr)
+	kubeadmArgs := []string{"kubeadm", "init", "--kubernetes-version", configs.Kube.K8sVersion, "--pod-network-cidr=" + configs.Kube.PodNetworkCidr}
 	if len(configs.Kube.AlternativeImageRepo) > 0 {
-		shellCmd = fmt.Sprintf(shellCmd+"--image-repository %s ", configs.Kube.AlternativeImageRepo)
+		kubeadmArgs = append(kubeadmArgs, "--image-repository", configs.Kube.AlternativeImageRepo)
 	}
 	if len(configs.Kube.ApiserverAdvertiseAddress) > 0 {
-		shellCmd = fmt.Sprintf(shellCmd+"--apiserver-advertise-address=%s ", configs.Kube.ApiserverAdvertiseAddress)
+		kubeadmArgs = append(kubeadmArgs, "--apiserver-advertise-address="+configs.Kube.ApiserverAdvertiseAddress)
 	}
-	shellCmd = fmt.Sprintf(shellCmd+"| tee %s/masterNodeInfo", configs.System.TmpDir)
-	_, err = system.ExecShellCmd(shellCmd)
+	kubeadmArgs = append(kubeadmArgs, criSocketArgs()...)
+	kubeadmArgs = append(kubeadmArgs, system.KubeadmPatchesArgs()...)
+	masterNodeInfo, err := system.ExecCmd("sudo", kubeadmArgs...)
 	logs.CheckErrorWithTagAndMsg(err, "Failed to deploy Kubernetes(version %s)!\n", configs.Kube.K8sVersion)
 
 	// Make kubectl work for non-root user
 	logs.WaitPrintf("Making kubectl work for non-root user")
-	_, err = system.ExecShellCmd("mkdir -p %s/.kube && sudo cp -i /etc/kubernetes/admin.conf %s/.kube/config && sudo chown $(id -u):$(id -g) %s/.kube/config",
-		configs.System.UserHomeDir,
-		configs.System.UserHomeDir,
-		configs.System.UserHomeDir)
+	kubeConfigPath := configs.System.UserHomeDir + "/.kube/config"
+	_, err = system.ExecCmd("mkdir", "-p", configs.System.UserHomeDir+"/.kube")
+	logs.CheckErrorWithMsg(err, "Failed to make kubectl work for non-root user!\n")
+	_, err = system.ExecCmd("sudo", "cp", "-i", "/etc/kubernetes/admin.conf", kubeConfigPath)
+	logs.CheckErrorWithMsg(err, "Failed to make kubectl work for non-root user!\n")
+	_, err = system.ExecCmd("sudo", "chown", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()), kubeConfigPath)
 	logs.CheckErrorWithTagAndMsg(err, "Failed to make kubectl work for non-root user!\n")
 
 	// Install Calico network add-on
 	logs.WaitPrintf("Installing pod network")
-	_, err = system.ExecShellCmd("kubectl apply -f %s", configs.Kube.PodNetworkAddonConfigURL)
+	podNetworkAddonConfig, err := system.ResolveUrl(configs.Kube.PodNetworkAddonConfigURL)
+	logs.CheckErrorWithMsg(err, "Failed to install pod network!\n")
+	_, err = system.ExecCmd("kubectl", "apply", "-f", podNetworkAddonConfig)
 	logs.CheckErrorWithTagAndMsg(err, "Failed to install pod network!\n")
 
 	// Extract master node information from logs
 	logs.WaitPrintf("Extracting master node information from logs")
-	shellOut, err := system.ExecShellCmd("sed -n '/.*kubeadm join.*/p' < %s/masterNodeInfo | sed -n 's/.*join \\(.*\\):\\(\\S*\\) --token \\(\\S*\\).*/\\1 \\2 \\3/p'", configs.System.TmpDir)
-	logs.CheckErrorWithMsg(err, "Failed to extract master node information from logs!\n")
-	splittedOut := strings.Split(shellOut, " ")
-	configs.Kube.ApiserverAdvertiseAddress = splittedOut[0]
-	configs.Kube.ApiserverPort = splittedOut[1]
-	configs.Kube.ApiserverToken = splittedOut[2]
-	shellOut, err = system.ExecShellCmd("sed -n '/.*sha256:.*/p' < %s/masterNodeInfo | sed -n 's/.*\\(sha256:\\S*\\).*/\\1/p'", configs.System.TmpDir)
-	logs.CheckErrorWithTagAndMsg(err, "Failed to extract master node information from logs!\n")
-	configs.Kube.ApiserverTokenHash = shellOut
+	joinInfo := kubeadmJoinRegexp.FindStringSubmatch(masterNodeInfo)
+	tokenHash := kubeadmTokenHashRegexp.FindString(masterNodeInfo)
+	if system.IsDryRun() {
+		joinInfo = []string{"", "<apiserver-advertise-address>", "<apiserver-port>", "<apiserver-token>"}
+		tokenHash = "<apiserver-token-hash>"
+	}
+	if joinInfo == nil || len(tokenHash) == 0 {
+		logs.FatalPrintf("Failed to extract master node information from logs!\n")
+	}
+	configs.Kube.ApiserverAdvertiseAddress = joinInfo[1]
+	configs.Kube.ApiserverPort = joinInfo[2]
+	configs.Kube.ApiserverToken = joinInfo[3]
+	configs.Kube.ApiserverTokenHash = tokenHash
+	logs.SuccessPrintf("\n")
 	masterKeyYamlTemplate := `ApiserverAdvertiseAddress: %s
 ApiserverPort: %s
 ApiserverToken: %s
@@ -138,16 +188,13 @@ ApiserverTokenHash: %s`
 
 	// Create masterKey.yaml with master node information
 	logs.WaitPrintf("Creating masterKey.yaml with master node information")
-	masterKeyYamlFile, err := os.OpenFile(configs.System.CurrentDir+"/masterKey.yaml", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
-	logs.CheckErrorWithMsg(err, "Failed to create masterKey.yaml with master node information!\n")
-	defer masterKeyYamlFile.Close()
 	masterKeyYaml := fmt.Sprintf(
 		masterKeyYamlTemplate,
 		configs.Kube.ApiserverAdvertiseAddress,
 		configs.Kube.ApiserverPort,
 		configs.Kube.ApiserverToken,
 		configs.Kube.ApiserverTokenHash)
-	_, err = masterKeyYamlFile.WriteString(masterKeyYaml)
+	err = system.WriteFile(configs.System.CurrentDir+"/masterKey.yaml", []byte(masterKeyYaml), 0666)
 	logs.CheckErrorWithTagAndMsg(err, "Failed to create masterKey.yaml with master node information!\n")
 
 }
@@ -158,12 +205,72 @@ func kube_worker_join() {
 	// Initialize
 	var err error
 
+	// Import images
+	if system.IsBundleMode() {
+		logs.WaitPrintf("Importing images from bundle")
+		err = system.ImportBundleImages()
+		logs.CheckErrorWithTagAndMsg(err, "Failed to import images from bundle!\n")
+	}
+
 	// Join Kubernetes cluster
 	logs.WaitPrintf("Joining Kubernetes cluster")
-	_, err = system.ExecShellCmd("sudo kubeadm join %s:%s --token %s --discovery-token-ca-cert-hash %s", configs.Kube.ApiserverAdvertiseAddress, configs.Kube.ApiserverPort, configs.Kube.ApiserverToken, configs.Kube.ApiserverTokenHash)
+	kubeadmArgs := []string{"kubeadm", "join",
+		configs.Kube.ApiserverAdvertiseAddress + ":" + configs.Kube.ApiserverPort,
+		"--token", configs.Kube.ApiserverToken,
+		"--discovery-token-ca-cert-hash", configs.Kube.ApiserverTokenHash}
+	kubeadmArgs = append(kubeadmArgs, criSocketArgs()...)
+	_, err = system.ExecCmd("sudo", append(kubeadmArgs, system.KubeadmPatchesArgs()...)...)
 	logs.CheckErrorWithTagAndMsg(err, "Failed to join Kubernetes cluster!\n")
 }
 
+// Get arguments of `kubeadm config images <operation>` for the configured version
+func kubeadmImagesArgs(operation string) []string {
+	kubeadmArgs := []string{"kubeadm", "config", "images", operation, "--kubernetes-version", configs.Kube.K8sVersion}
+	if len(configs.Kube.AlternativeImageRepo) > 0 {
+		kubeadmArgs = append(kubeadmArgs, "--image-repository", configs.Kube.AlternativeImageRepo)
+	}
+	return kubeadmArgs
+}
+
+// Use the given container runtime, or the one detected from the existing CRI sockets
+func resolveContainerRuntime(runtime string) error {
+	if len(runtime) == 0 {
+		detectedRuntime, err := system.DetectContainerRuntime()
+		if err != nil {
+			return err
+		}
+		runtime = detectedRuntime
+	}
+	if err := system.ValidateChoice("runtime", runtime, system.RuntimeContainerd, system.RuntimeCrio); err != nil {
+		return err
+	}
+	if runtime == system.RuntimeCrio && system.IsBundleMode() {
+		return errors.New("-runtime: images of a bundle can only be imported into containerd")
+	}
+	configs.System.ContainerRuntime = runtime
+	return nil
+}
+
+// Get the `--cri-socket` argument of kubeadm for the container runtime
+func criSocketArgs() []string {
+	return []string{"--cri-socket", system.CriSockets[configs.System.ContainerRuntime]}
+}
+
+// Get artifacts needed by `kube` for the configured versions
+// The list of control plane images is taken from the local kubeadm
+func BundleArtifacts() ([]*system.Artifact, error) {
+	artifacts := []*system.Artifact{{Kind: system.ArtifactFile, Source: configs.Kube.PodNetworkAddonConfigURL}}
+	kubeadmArgs := kubeadmImagesArgs("list")
+	images, err := system.ExecCmd(kubeadmArgs[0], kubeadmArgs[1:]...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images of Kubernetes %s (is kubeadm installed?): %w", configs.Kube.K8sVersion, err)
+	}
+	for _, image := range strings.Fields(images) {
+		artifacts = append(artifacts, &system.Artifact{Kind: system.ArtifactImage, Source: image})
+	}
+	return artifacts, nil
+}
+
 func check_kube_environment() {
 	// Temporarily unused
 }
@@ -0,0 +1,66 @@
+package kube
+
+import (
+	"os"
+	"testing"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	system "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/system"
+)
+
+func TestKubeMasterInit(t *testing.T) {
+	fakeRunner := system.NewFakeRunner()
+	fakeRunner.On("kubeadm init", system.FakeResponse{Stdout: `Your Kubernetes control-plane has initialized successfully!
+Then you can join any number of worker nodes by running the following on each as root:
+
+kubeadm join 10.0.0.1:6443 --token abcdef.0123456789abcdef \
+	--discovery-token-ca-cert-hash sha256:0123456789abcdef`})
+	defer system.SetRunner(system.SetRunner(fakeRunner))
+	configs.System.CurrentDir = t.TempDir()
+	configs.System.UserHomeDir = t.TempDir()
+	configs.Kube.AlternativeImageRepo = "registry.example.com/k8s"
+	defer func() { configs.Kube.AlternativeImageRepo = "" }()
+
+	kube_master_init()
+
+	for _, pattern := range []string{
+		"sudo kubeadm config images pull --kubernetes-version 1.25.9 --image-repository registry.example.com/k8s",
+		"sudo kubeadm init --kubernetes-version 1.25.9 --pod-network-cidr=192.168.0.0/16 --image-repository registry.example.com/k8s --cri-socket unix:///run/containerd/containerd.sock",
+		"kubectl apply -f " + configs.Kube.PodNetworkAddonConfigURL,
+	} {
+		if !fakeRunner.Executed(pattern) {
+			t.Errorf("kube_master_init() did not execute %q\n%v", pattern, fakeRunner)
+		}
+	}
+	masterKey, err := os.ReadFile(configs.System.CurrentDir + "/masterKey.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read masterKey.yaml: %v", err)
+	}
+	want := "ApiserverAdvertiseAddress: 10.0.0.1\nApiserverPort: 6443\nApiserverToken: abcdef.0123456789abcdef\nApiserverTokenHash: sha256:0123456789abcdef"
+	if string(masterKey) != want {
+		t.Errorf("masterKey.yaml = %q, want %q", masterKey, want)
+	}
+}
+
+func TestKubeWorkerJoinWithCrio(t *testing.T) {
+	fakeRunner := system.NewFakeRunner()
+	defer system.SetRunner(system.SetRunner(fakeRunner))
+	configs.Kube.ApiserverAdvertiseAddress, configs.Kube.ApiserverToken, configs.Kube.ApiserverTokenHash = "10.0.0.1", "abcdef.0123456789abcdef", "sha256:0123456789abcdef"
+	defer func() {
+		configs.Kube.ApiserverAdvertiseAddress, configs.Kube.ApiserverToken, configs.Kube.ApiserverTokenHash = "", "", ""
+		configs.System.ContainerRuntime = system.RuntimeContainerd
+	}()
+	if err := resolveContainerRuntime(system.RuntimeCrio); err != nil {
+		t.Fatalf("resolveContainerRuntime(crio) error = %v", err)
+	}
+
+	kube_worker_join()
+
+	want := "sudo kubeadm join 10.0.0.1:6443 --token abcdef.0123456789abcdef --discovery-token-ca-cert-hash sha256:0123456789abcdef --cri-socket unix:///var/run/crio/crio.sock"
+	if !fakeRunner.Executed(want) {
+		t.Errorf("kube_worker_join() did not execute %q\n%v", want, fakeRunner)
+	}
+	if err := resolveContainerRuntime("docker"); err == nil {
+		t.Errorf("resolveContainerRuntime(docker) should fail")
+	}
+}
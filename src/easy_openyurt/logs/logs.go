@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
@@ -16,9 +17,9 @@ var (
 	_colorGreen  = "\033[32m"
 	_colorYellow = "\033[33m"
 	_colorBlue   = "\033[34m"
+	_colorCyan   = "\033[36m"
+	_colorGray   = "\033[37m"
 	// _colorPurple = "\033[35m"
-	// _colorCyan   = "\033[36m"
-	// _colorGray   = "\033[37m"
 	// _colorWhite  = "\033[97m"
 )
 
@@ -27,6 +28,14 @@ var (
 	ErrorLog  *log.Logger = nil // Error logs
 )
 
+var (
+	currentStep    = ""    // Step announced by the latest `WaitPrintf()`
+	stepBannerOpen = false // Whether the banner of the latest `WaitPrintf()` still waits for its result on the same line
+	outputMutex    sync.Mutex
+)
+
+var exitHooks []func() // Hooks run by `FatalPrintf()` before exiting
+
 // Print colored text in terminal
 func coloredPrintf(color string, format string, pars ...any) {
 	fmt.Print(color)
@@ -83,16 +92,64 @@ func InfoPrintf(format string, pars ...any) {
 }
 
 // Print information (blue) with waiting symbol in terminal and send it to the common logs(if exist)
+// The message is also remembered as the current step
 func WaitPrintf(format string, pars ...any) {
+	currentStep = fmt.Sprintf(format, pars...)
 	InfoPrintf(format+" >>>>> ", pars...)
+	stepBannerOpen = true
+}
+
+// Move to a new line if the step banner is still open, so that following lines are printed under it
+func breakStepBanner() {
+	if stepBannerOpen {
+		fmt.Print("\n")
+		stepBannerOpen = false
+	}
+}
+
+// Print a line of command output (gray) under the current step banner in terminal
+func EchoOutputLine(line string) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	breakStepBanner()
+	coloredPrintf(_colorGray, "    | %s\n", line)
+}
+
+// Get the step announced by the latest `WaitPrintf()`
+func CurrentStep() string {
+	return currentStep
 }
 
-// Call `ErrorPrintf()` and then exit with code 1
+// Print planned action (cyan) in terminal and send it to the common logs(if exist)
+func PlanPrintf(format string, pars ...any) {
+	breakStepBanner()
+	currentTime := time.Now().Local()
+	// For output
+	coloredPrintf(_colorCyan, "[%02d:%02d:%02d] [Plan] ", currentTime.Hour(), currentTime.Minute(), currentTime.Second())
+	coloredPrintf(_colorCyan, format, pars...)
+	// For logs
+	if CommonLog != nil {
+		CommonLog.Printf(format, pars...)
+	}
+}
+
+// Call `ErrorPrintf()`, run exit hooks, and then exit with code 1
 func FatalPrintf(format string, pars ...any) {
 	ErrorPrintf(format, pars...)
+	// Take the hooks first, so that a failing hook cannot run them again
+	hooks := exitHooks
+	exitHooks = nil
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
 	os.Exit(1)
 }
 
+// Register hook to be run by `FatalPrintf()` before exiting (hooks run in reverse order of registration)
+func RegisterExitHook(hook func()) {
+	exitHooks = append(exitHooks, hook)
+}
+
 // If err is not nil, print the error message, send it to the error logs, and then exit
 func CheckErrorWithMsg(err error, format string, pars ...any) {
 	if err != nil {
@@ -110,7 +167,9 @@ func CheckErrorWithTagAndMsg(err error, format string, pars ...any) {
 
 // Print general usage tips
 func PrintGeneralUsage() {
-	InfoPrintf("Usage: %s <object: system | kube | yurt> <nodeRole: master | worker> <operation: init | join | expand> [Parameters...]\n", os.Args[0])
+	InfoPrintf("Usage: %s <object: system | kube | yurt> <nodeRole: master | worker> <operation: init | check | reset | join | expand> [Parameters...]\n", os.Args[0])
+	InfoPrintf("       %s cache <operation: list | prune | export | import> [Parameters...]\n", os.Args[0])
+	InfoPrintf("       %s bundle create -file <bundle.tar.gz> [Parameters...]\n", os.Args[0])
 }
 
 // Print welcome information
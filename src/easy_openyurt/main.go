@@ -4,6 +4,7 @@ package main
 import (
 	"os"
 
+	bundle "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/bundle"
 	knative "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/knative"
 	kube "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/kube"
 	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
@@ -26,7 +27,7 @@ func init() {
 func main() {
 	// Check Arguments number
 	argc := len(os.Args)
-	if argc < 4 {
+	if argc < 4 && !(argc == 3 && (os.Args[1] == "cache" || os.Args[1] == "bundle")) {
 		logs.PrintGeneralUsage()
 		logs.FatalPrintf("Invalid arguments: too few arguments!\n")
 	}
@@ -48,8 +49,15 @@ func main() {
 	case "vhive":
 		// `vHive` subcommand
 		vhive.ParseSubcommandVHive(os.Args[2:])
+	case "cache":
+		// `cache` subcommand
+		system.ParseSubcommandCache(os.Args[2:])
+	case "bundle":
+		// `bundle` subcommand
+		bundle.ParseSubcommandBundle(os.Args[2:])
 	default:
 		logs.PrintGeneralUsage()
 		logs.FatalPrintf("Invalid object: <object> -> %s\n", operationObject)
 	}
+	system.FinishGlobal()
 }
@@ -0,0 +1,61 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+// Check that every component has a release for the current architecture
+func CheckArchSupport(components ...string) error {
+	var err error
+	for _, component := range components {
+		archNames, ok := configs.ArchNames[component]
+		if !ok {
+			err = errors.Join(err, fmt.Errorf("no architecture table for %s", component))
+			continue
+		}
+		if _, ok := archNames[configs.System.CurrentArch]; !ok {
+			var supportedArchs []string
+			for arch := range archNames {
+				supportedArchs = append(supportedArchs, arch)
+			}
+			sort.Strings(supportedArchs)
+			err = errors.Join(err, fmt.Errorf("%s has no release for %s (only for %s)", component, configs.System.CurrentArch, strings.Join(supportedArchs, ", ")))
+		}
+	}
+	return err
+}
+
+// Get the components `SystemInit()` is going to install
+func systemComponents() []string {
+	var components []string
+	if !configs.System.GoInstalled {
+		components = append(components, "go")
+	}
+	if configs.System.ContainerRuntime == RuntimeCrio {
+		components = append(components, "cri-o-packages")
+	} else {
+		if !configs.System.ContainerdInstalled {
+			components = append(components, "containerd")
+		}
+		if !configs.System.RuncInstalled {
+			components = append(components, "runc")
+		}
+	}
+	if !configs.System.CniPluginsInstalled {
+		components = append(components, "cni-plugins")
+	}
+	if configs.System.KubeInstallMethod == KubeInstallBinary {
+		components = append(components, "kubernetes-binaries", "crictl")
+	} else {
+		components = append(components, "kubernetes-packages")
+	}
+	if cosignNeeded() {
+		components = append(components, "cosign")
+	}
+	return components
+}
@@ -0,0 +1,54 @@
+package system
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+func TestArchMapping(t *testing.T) {
+	defer func(arch string) { configs.System.CurrentArch = arch }(configs.System.CurrentArch)
+	configs.System.CurrentArch = "arm"
+
+	if err := CheckArchSupport("go", "runc", "cni-plugins", "kubernetes-binaries"); err != nil {
+		t.Errorf("CheckArchSupport(arm) error = %v", err)
+	}
+	err := CheckArchSupport("runc", "containerd", "kubernetes-packages")
+	if err == nil || !strings.Contains(err.Error(), "containerd has no release for arm (only for amd64, arm64, ppc64le, riscv64, s390x)") ||
+		!strings.Contains(err.Error(), "kubernetes-packages has no release for arm") || strings.Contains(err.Error(), "runc") {
+		t.Errorf("CheckArchSupport(arm) error = %v", err)
+	}
+
+	configs.System.ContainerdInstalled = true
+	defer func() { configs.System.ContainerdInstalled = false }()
+	configs.System.KubeInstallMethod = KubeInstallBinary
+	defer func() { configs.System.KubeInstallMethod = KubeInstallPackage }()
+	if err := CheckArchSupport(systemComponents()...); err != nil {
+		t.Errorf("CheckArchSupport(arm, containerd installed, binary method) error = %v", err)
+	}
+
+	artifacts, err := BundleArtifacts()
+	if err == nil {
+		t.Fatalf("BundleArtifacts(arm) should fail, as containerd has no release for arm")
+	}
+	configs.ArchNames["containerd"]["arm"] = "armhf"
+	defer delete(configs.ArchNames["containerd"], "arm")
+	if artifacts, err = BundleArtifacts(); err != nil {
+		t.Fatalf("BundleArtifacts(arm) error = %v", err)
+	}
+	for _, want := range []string{
+		"https://go.dev/dl/go" + configs.System.GoVersion + ".linux-armv6l.tar.gz",
+		"https://github.com/opencontainers/runc/releases/download/v" + configs.System.RuncVersion + "/runc.armhf",
+		"-linux-armhf.tar.gz",
+		"/bin/linux/arm/kubeadm",
+	} {
+		found := false
+		for _, artifact := range artifacts {
+			found = found || strings.HasSuffix(artifact.Source, want)
+		}
+		if !found {
+			t.Errorf("BundleArtifacts(arm) does not contain %s", want)
+		}
+	}
+}
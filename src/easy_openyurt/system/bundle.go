@@ -0,0 +1,222 @@
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
+)
+
+// Kinds of artifacts
+const (
+	ArtifactFile    = "file"    // File downloaded from URL Source
+	ArtifactGitRepo = "git"     // Git repository cloned from URL Source, with all branches & tags
+	ArtifactImage   = "image"   // Container image referenced by Source
+	ArtifactPackage = "package" // System package Source (`name` or `name=version`), with its dependencies
+)
+
+// Artifact fetched from the network at install time
+type Artifact struct {
+	Kind      string
+	Source    string
+	Sha256Url string               `json:",omitempty"` // Published checksum file (file only, optional)
+	GitRef    string               `json:",omitempty"` // Ref checked out at install time (git only, optional)
+	Charts    []string             `json:",omitempty"` // Helm charts in the repository, whose images are bundled too (git only, optional)
+	Manifests []*GeneratedManifest `json:",omitempty"` // Manifests generated by make at GitRef, bundled with their images (git only, optional)
+	Path      string               `json:",omitempty"` // Path relative to the bundle root, filled by `bundle create`
+	Sha256    string               `json:",omitempty"` // SHA256 sum of the bundled file, filled by `bundle create`
+}
+
+// Manifest generated by a make target of a git repository, which needs network access (e.g. for Go modules)
+type GeneratedManifest struct {
+	MakeArgs []string // Target & variables passed to `make`
+	Output   string   // Generated manifest, relative to the repository
+	Path     string   `json:",omitempty"` // Path relative to the bundle root, filled by `bundle create`
+	Sha256   string   `json:",omitempty"` // SHA256 sum of the bundled manifest, filled by `bundle create`
+}
+
+// Content of `bundle.json` in the root of a bundle
+type BundleManifest struct {
+	Version   string
+	Created   time.Time
+	OS        string
+	OSVersion string `json:",omitempty"` // VERSION_ID of os-release, packages are only installable on the same release
+	Arch      string
+	Artifacts []*Artifact
+}
+
+const BundleManifestFileName = "bundle.json"
+
+// Directory the bundle is extracted to, and its manifest (nil if not installing from a bundle)
+var bundleDir string
+var bundleManifest *BundleManifest
+
+// Whether artifacts are installed from a bundle instead of the network
+func IsBundleMode() bool {
+	return bundleManifest != nil
+}
+
+// Extract bundle and install every artifact from it afterwards
+func OpenBundle(bundlePath string) error {
+	dir, err := os.MkdirTemp("", "easy_openyurt_bundle")
+	if err != nil {
+		return err
+	}
+	logs.RegisterExitHook(CloseBundle)
+	bundleDir = dir
+	// Readable by apt, which reads bundled packages as an unprivileged user
+	if err := os.Chmod(dir, 0755); err != nil {
+		return err
+	}
+	if err := extractArchive(context.Background(), bundlePath, dir, 0); err != nil {
+		return fmt.Errorf("failed to extract bundle %s: %w", bundlePath, err)
+	}
+	content, err := os.ReadFile(dir + "/" + BundleManifestFileName)
+	if err != nil {
+		return fmt.Errorf("%s is not a bundle: %w", bundlePath, err)
+	}
+	manifest := &BundleManifest{}
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return fmt.Errorf("corrupted bundle manifest in %s: %w", bundlePath, err)
+	}
+	if manifest.OS != configs.System.CurrentOS || manifest.Arch != configs.System.CurrentArch {
+		return fmt.Errorf("bundle %s was created for %s/%s, but this node runs %s/%s",
+			bundlePath, manifest.OS, manifest.Arch, configs.System.CurrentOS, configs.System.CurrentArch)
+	}
+	if len(manifest.OSVersion) > 0 && manifest.OSVersion != configs.System.CurrentOSVersion {
+		return fmt.Errorf("bundle %s was created for %s %s, but this node runs %s %s",
+			bundlePath, manifest.OS, manifest.OSVersion, configs.System.CurrentOS, configs.System.CurrentOSVersion)
+	}
+	bundleManifest = manifest
+	return nil
+}
+
+// Remove the extracted bundle
+func CloseBundle() {
+	if len(bundleDir) > 0 {
+		os.RemoveAll(bundleDir)
+	}
+	bundleDir = ""
+	bundleManifest = nil
+}
+
+// Get the bundled artifact and its absolute path
+func findBundleArtifact(kind string, source string) (*Artifact, string, error) {
+	for _, artifact := range bundleManifest.Artifacts {
+		if artifact.Kind == kind && artifact.Source == source {
+			return artifact, bundleDir + "/" + artifact.Path, nil
+		}
+	}
+	return nil, "", fmt.Errorf("%s %s is not in bundle %s", kind, source, configs.System.BundlePath)
+}
+
+// Get the bundled copy of a file, verified against the SHA256 sum recorded when bundling
+func bundledFile(url string) (string, error) {
+	artifact, filePath, err := findBundleArtifact(ArtifactFile, url)
+	if err != nil {
+		return "", err
+	}
+	actualSha256, err := FileSha256(filePath)
+	if err != nil {
+		return "", err
+	}
+	if actualSha256 != artifact.Sha256 {
+		return "", fmt.Errorf("bundled copy of %s is corrupted: expected sha256 %s, got %s", url, artifact.Sha256, actualSha256)
+	}
+	return filePath, nil
+}
+
+// Resolve URL of a remote file (e.g. a manifest for `kubectl apply -f`) to its bundled copy in bundle mode, or to its mirror
+func ResolveUrl(url string) (string, error) {
+	if !IsBundleMode() {
+		return MirrorUrl(url), nil
+	}
+	return bundledFile(url)
+}
+
+// Clone git repository (from the bundle in bundle mode, or from its mirror)
+func GitClone(url string, dirPath string) error {
+	source := MirrorUrl(url)
+	if IsBundleMode() {
+		var err error
+		_, source, err = findBundleArtifact(ArtifactGitRepo, url)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := ExecCmd("git", "clone", "--quiet", source, dirPath)
+	return err
+}
+
+// Generate manifest in the checked out repository dirPath cloned from url (or use the copy generated by `bundle create` in bundle mode), and get its path
+func GenerateManifest(url string, dirPath string, manifest *GeneratedManifest) (string, error) {
+	if !IsBundleMode() {
+		_, err := ExecCmd("make", append([]string{"-C", dirPath}, manifest.MakeArgs...)...)
+		return dirPath + "/" + manifest.Output, err
+	}
+	artifact, _, err := findBundleArtifact(ArtifactGitRepo, url)
+	if err != nil {
+		return "", err
+	}
+	for _, bundled := range artifact.Manifests {
+		if bundled.Output != manifest.Output || strings.Join(bundled.MakeArgs, " ") != strings.Join(manifest.MakeArgs, " ") {
+			continue
+		}
+		filePath := bundleDir + "/" + bundled.Path
+		actualSha256, err := FileSha256(filePath)
+		if err != nil {
+			return "", err
+		}
+		if actualSha256 != bundled.Sha256 {
+			return "", fmt.Errorf("bundled copy of %s is corrupted: expected sha256 %s, got %s", manifest.Output, bundled.Sha256, actualSha256)
+		}
+		return filePath, nil
+	}
+	return "", fmt.Errorf("manifest %s generated by `make %s` is not in bundle %s", manifest.Output, strings.Join(manifest.MakeArgs, " "), configs.System.BundlePath)
+}
+
+// Import all bundled container images into containerd, so that they are never pulled
+func ImportBundleImages() error {
+	if !IsBundleMode() {
+		return nil
+	}
+	for _, artifact := range bundleManifest.Artifacts {
+		if artifact.Kind != ArtifactImage {
+			continue
+		}
+		_, err := ExecCmd("sudo", "ctr", "-n", "k8s.io", "images", "import", bundleDir+"/"+artifact.Path)
+		if err != nil {
+			return fmt.Errorf("failed to import image %s: %w", artifact.Source, err)
+		}
+	}
+	return nil
+}
+
+// Install packages from the local apt repository in the bundle, ignoring all other sources
+func installBundlePackages(packages []string) error {
+	for _, packageName := range packages {
+		if _, _, err := findBundleArtifact(ArtifactPackage, packageName); err != nil {
+			return err
+		}
+	}
+	sourceListPath := bundleDir + "/packages/bundle.list"
+	err := os.WriteFile(sourceListPath, []byte(fmt.Sprintf("deb [trusted=yes] file:%s/packages ./\n", bundleDir)), 0644)
+	if err != nil {
+		return err
+	}
+	aptOptions := []string{
+		"-o", "Dir::Etc::SourceList=" + sourceListPath,
+		"-o", "Dir::Etc::SourceParts=-",
+		"-o", "APT::Get::List-Cleanup=0"}
+	_, err = ExecCmd("sudo", append(append([]string{"apt-get", "-qq"}, aptOptions...), "update")...)
+	if err != nil {
+		return err
+	}
+	_, err = ExecCmd("sudo", append(append(append([]string{"apt-get", "-qq"}, aptOptions...), "install", "-y", "--allow-downgrades"), packages...)...)
+	return err
+}
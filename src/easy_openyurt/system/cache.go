@@ -0,0 +1,518 @@
+package system
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
+)
+
+// Artifact stored in the cache
+// Blobs are content-addressed (`<cache dir>/sha256/<sum>`), entries map the URL an artifact was downloaded from to its blob
+type CacheEntry struct {
+	Url      string
+	FileName string
+	Sha256   string
+	Size     int64
+	Added    time.Time
+	LastUsed time.Time
+}
+
+const (
+	cacheIndexFileName = "index.json"
+	cacheLockFileName  = "index.lock"
+)
+
+// Get the cache directory (empty if caching is impossible)
+func CacheDir() string {
+	if len(configs.System.CacheDir) > 0 {
+		return configs.System.CacheDir
+	}
+	if xdgCacheHome := os.Getenv("XDG_CACHE_HOME"); len(xdgCacheHome) > 0 {
+		return xdgCacheHome + "/easy_openyurt"
+	}
+	if len(configs.System.UserHomeDir) > 0 {
+		return configs.System.UserHomeDir + "/.cache/easy_openyurt"
+	}
+	return ""
+}
+
+func cacheBlobPath(cacheDir string, sha256 string) string {
+	return cacheDir + "/sha256/" + sha256
+}
+
+// Read cache index (an empty index if the cache does not exist yet)
+func readCacheIndex(cacheDir string) (map[string]*CacheEntry, error) {
+	index := map[string]*CacheEntry{}
+	content, err := os.ReadFile(cacheDir + "/" + cacheIndexFileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var entries []*CacheEntry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, fmt.Errorf("corrupted cache index %s: %w", cacheDir+"/"+cacheIndexFileName, err)
+	}
+	for _, entry := range entries {
+		index[entry.Url] = entry
+	}
+	return index, nil
+}
+
+// Lock the cache against other processes (e.g. parallel runs sharing a cache), until unlock is called
+// Every update of the index or the blobs happens under the lock, readers rely on updates being atomic
+func lockCache(cacheDir string) (func(), error) {
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return nil, err
+	}
+	lockFile, err := os.OpenFile(cacheDir+"/"+cacheLockFileName, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		lockFile.Close()
+		return nil, fmt.Errorf("failed to lock cache %s: %w", cacheDir, err)
+	}
+	// Closing the file releases the lock
+	return func() { lockFile.Close() }, nil
+}
+
+// Write cache index atomically
+func writeCacheIndex(cacheDir string, index map[string]*CacheEntry) error {
+	content, err := json.MarshalIndent(sortedCacheEntries(index), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpIndexPath := cacheDir + "/" + cacheIndexFileName + ".tmp"
+	if err := os.WriteFile(tmpIndexPath, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpIndexPath, cacheDir+"/"+cacheIndexFileName)
+}
+
+func sortedCacheEntries(index map[string]*CacheEntry) []*CacheEntry {
+	entries := make([]*CacheEntry, 0, len(index))
+	for _, entry := range index {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].FileName != entries[j].FileName {
+			return entries[i].FileName < entries[j].FileName
+		}
+		return entries[i].Url < entries[j].Url
+	})
+	return entries
+}
+
+// Find a cached copy of download, and return the path of the blob (empty if not cached)
+// Blobs are only looked up by the expected (pinned or published) SHA256 sum, never by URL, as imported index entries may map URLs to any blob
+// The blob is hashed again, so that a corrupted cache is never used
+func lookUpCache(download *Download) string {
+	cacheDir := CacheDir()
+	expectedSha256 := strings.ToLower(download.Sha256)
+	if len(cacheDir) == 0 || !sha256Regexp.MatchString(expectedSha256) {
+		return ""
+	}
+	blobPath := cacheBlobPath(cacheDir, expectedSha256)
+	actualSha256, err := FileSha256(blobPath)
+	if err != nil || actualSha256 != expectedSha256 {
+		return ""
+	}
+	// Dry runs leave the cache alone
+	if !IsDryRun() {
+		touchCacheEntry(cacheDir, download.Url, expectedSha256)
+	}
+	return blobPath
+}
+
+// Update the last use of the entry of url (if it still maps to the blob sha256)
+func touchCacheEntry(cacheDir string, url string, sha256 string) {
+	unlock, err := lockCache(cacheDir)
+	if err != nil {
+		logs.WarnPrintf("Failed to update artifact cache: %v\n", err)
+		return
+	}
+	defer unlock()
+	index, err := readCacheIndex(cacheDir)
+	if err != nil {
+		return
+	}
+	if entry, ok := index[url]; ok && entry.Sha256 == sha256 {
+		entry.LastUsed = time.Now()
+		writeCacheIndex(cacheDir, index)
+	}
+}
+
+// Add a verified download to the cache
+func addToCache(download *Download) error {
+	cacheDir := CacheDir()
+	if len(cacheDir) == 0 {
+		return nil
+	}
+	unlock, err := lockCache(cacheDir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := os.MkdirAll(cacheDir+"/sha256", 0755); err != nil {
+		return err
+	}
+	index, err := readCacheIndex(cacheDir)
+	if err != nil {
+		return err
+	}
+	sha256, err := FileSha256(download.FilePath)
+	if err != nil {
+		return err
+	}
+	size, err := copyFile(download.FilePath, cacheBlobPath(cacheDir, sha256))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	index[download.Url] = &CacheEntry{
+		Url:      download.Url,
+		FileName: path.Base(download.Url),
+		Sha256:   sha256,
+		Size:     size,
+		Added:    now,
+		LastUsed: now,
+	}
+	return writeCacheIndex(cacheDir, index)
+}
+
+// Copy file through a temporary file in the destination directory, so that a partial copy is never visible
+func copyFile(srcPath string, dstPath string) (int64, error) {
+	srcFile, err := os.Open(srcPath)
+	if err != nil {
+		return 0, err
+	}
+	defer srcFile.Close()
+	tmpFile, err := os.CreateTemp(filepath.Dir(dstPath), ".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmpFile.Name())
+	size, err := io.Copy(tmpFile, srcFile)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Chmod(tmpFile.Name(), 0644); err != nil {
+		return 0, err
+	}
+	return size, os.Rename(tmpFile.Name(), dstPath)
+}
+
+// Remove entries last used before deadline (all entries if deadline is zero), then blobs no longer referenced
+// Return the number of removed entries and the bytes freed
+func PruneCache(cacheDir string, deadline time.Time) (int, int64, error) {
+	unlock, err := lockCache(cacheDir)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer unlock()
+	index, err := readCacheIndex(cacheDir)
+	if err != nil {
+		return 0, 0, err
+	}
+	removedEntries := 0
+	referencedBlobs := map[string]bool{}
+	for url, entry := range index {
+		if deadline.IsZero() || entry.LastUsed.Before(deadline) {
+			delete(index, url)
+			removedEntries++
+		} else {
+			referencedBlobs[entry.Sha256] = true
+		}
+	}
+	blobs, err := os.ReadDir(cacheDir + "/sha256")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, 0, err
+	}
+	var freedBytes int64
+	for _, blob := range blobs {
+		if referencedBlobs[blob.Name()] {
+			continue
+		}
+		if info, err := blob.Info(); err == nil {
+			freedBytes += info.Size()
+		}
+		if err := os.Remove(cacheDir + "/sha256/" + blob.Name()); err != nil {
+			return 0, 0, err
+		}
+	}
+	return removedEntries, freedBytes, writeCacheIndex(cacheDir, index)
+}
+
+// Export the cache as a tar.gz archive, which can be imported on other machines
+func ExportCache(cacheDir string, archivePath string) (int, error) {
+	index, err := readCacheIndex(cacheDir)
+	if err != nil {
+		return 0, err
+	}
+	archiveFile, err := os.Create(archivePath)
+	if err != nil {
+		return 0, err
+	}
+	defer archiveFile.Close()
+	gzipWriter := gzip.NewWriter(archiveFile)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	// Blobs first, each only once
+	var exportedEntries []*CacheEntry
+	exportedBlobs := map[string]bool{}
+	for _, entry := range sortedCacheEntries(index) {
+		if !exportedBlobs[entry.Sha256] {
+			if err := addFileToTar(tarWriter, cacheBlobPath(cacheDir, entry.Sha256), "sha256/"+entry.Sha256); errors.Is(err, os.ErrNotExist) {
+				logs.WarnPrintf("Skipping %s: blob is missing from the cache\n", entry.Url)
+				continue
+			} else if err != nil {
+				return 0, err
+			}
+			exportedBlobs[entry.Sha256] = true
+		}
+		exportedEntries = append(exportedEntries, entry)
+	}
+	indexContent, err := json.MarshalIndent(exportedEntries, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	err = tarWriter.WriteHeader(&tar.Header{Name: cacheIndexFileName, Mode: 0644, Size: int64(len(indexContent)), ModTime: time.Now()})
+	if err == nil {
+		_, err = tarWriter.Write(indexContent)
+	}
+	if err == nil {
+		err = tarWriter.Close()
+	}
+	if err == nil {
+		err = gzipWriter.Close()
+	}
+	if err == nil {
+		err = archiveFile.Close()
+	}
+	return len(exportedEntries), err
+}
+
+func addFileToTar(tarWriter *tar.Writer, filePath string, name string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	err = tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tarWriter, file)
+	return err
+}
+
+// Import an archive created by `ExportCache()` into the cache
+// Every blob is verified against its SHA256 sum, and entries without a valid blob are skipped
+// Imported entries only name blobs, downloads still find them by their own pinned or published sum
+func ImportCache(cacheDir string, archivePath string) (int, error) {
+	archiveFile, err := os.Open(archivePath)
+	if err != nil {
+		return 0, err
+	}
+	defer archiveFile.Close()
+	gzipReader, err := gzip.NewReader(archiveFile)
+	if err != nil {
+		return 0, err
+	}
+	unlock, err := lockCache(cacheDir)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	if err := os.MkdirAll(cacheDir+"/sha256", 0755); err != nil {
+		return 0, err
+	}
+	index, err := readCacheIndex(cacheDir)
+	if err != nil {
+		return 0, err
+	}
+
+	var importedEntries []*CacheEntry
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+		switch {
+		case header.Name == cacheIndexFileName:
+			if err := json.NewDecoder(tarReader).Decode(&importedEntries); err != nil {
+				return 0, fmt.Errorf("corrupted cache index in %s: %w", archivePath, err)
+			}
+		case strings.HasPrefix(header.Name, "sha256/") && sha256Regexp.MatchString(strings.TrimPrefix(header.Name, "sha256/")):
+			if err := importCacheBlob(cacheDir, strings.TrimPrefix(header.Name, "sha256/"), tarReader); err != nil {
+				return 0, err
+			}
+		default:
+			logs.WarnPrintf("Skipping unexpected file %s in %s\n", header.Name, archivePath)
+		}
+	}
+
+	imported := 0
+	for _, entry := range importedEntries {
+		if _, err := os.Stat(cacheBlobPath(cacheDir, entry.Sha256)); err != nil || !sha256Regexp.MatchString(entry.Sha256) {
+			logs.WarnPrintf("Skipping %s: blob is missing from %s\n", entry.Url, archivePath)
+			continue
+		}
+		index[entry.Url] = entry
+		imported++
+	}
+	return imported, writeCacheIndex(cacheDir, index)
+}
+
+// Write blob to the cache if its content matches sha256
+func importCacheBlob(cacheDir string, sha256 string, reader io.Reader) error {
+	tmpFile, err := os.CreateTemp(cacheDir+"/sha256", ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = io.Copy(tmpFile, reader)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	actualSha256, err := FileSha256(tmpFile.Name())
+	if err != nil {
+		return err
+	}
+	if actualSha256 != sha256 {
+		logs.WarnPrintf("Skipping corrupted blob %s (actual sha256 %s)\n", sha256, actualSha256)
+		return nil
+	}
+	if err := os.Chmod(tmpFile.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), cacheBlobPath(cacheDir, sha256))
+}
+
+// Print cached artifacts as a table
+func ListCache(cacheDir string, writer io.Writer) error {
+	index, err := readCacheIndex(cacheDir)
+	if err != nil {
+		return err
+	}
+	tableWriter := tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tableWriter, "FILE\tSIZE\tSHA256\tLAST USED\tURL\n")
+	for _, entry := range sortedCacheEntries(index) {
+		fmt.Fprintf(tableWriter, "%s\t%s\t%s\t%s\t%s\n",
+			entry.FileName, formatSize(entry.Size), entry.Sha256[:12], entry.LastUsed.Local().Format("2006-01-02 15:04"), entry.Url)
+	}
+	return tableWriter.Flush()
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1fG", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1fM", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1fK", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%dB", size)
+	}
+}
+
+// Parse parameters for subcommand `cache`
+func ParseSubcommandCache(args []string) {
+	if len(args) < 1 {
+		logs.InfoPrintf("Usage: %s %s <list | prune | export | import> [parameters...]\n", os.Args[0], os.Args[1])
+		logs.FatalPrintf("Invalid arguments: too few arguments!\n")
+	}
+	operation := args[0]
+
+	// Parse parameters for `cache <operation>`
+	var help bool
+	var olderThan time.Duration
+	var all bool
+	var archivePath string
+	cacheFlagsName := fmt.Sprintf("%s cache %s", os.Args[0], operation)
+	cacheFlags := flag.NewFlagSet(cacheFlagsName, flag.ExitOnError)
+	cacheFlags.StringVar(&configs.System.CacheDir, "cache-dir", configs.System.CacheDir, "Artifact cache directory (default $XDG_CACHE_HOME/easy_openyurt or ~/.cache/easy_openyurt)")
+	switch operation {
+	case "list":
+	case "prune":
+		cacheFlags.DurationVar(&olderThan, "older-than", 30*24*time.Hour, "Remove artifacts not used for this long")
+		cacheFlags.BoolVar(&all, "all", false, "Remove all artifacts")
+	case "export", "import":
+		cacheFlags.StringVar(&archivePath, "file", "", "Archive (.tar.gz) to "+operation+" (**REQUIRED**)")
+	default:
+		logs.InfoPrintf("Usage: %s %s <list | prune | export | import> [parameters...]\n", os.Args[0], os.Args[1])
+		logs.FatalPrintf("Invalid operation: <operation> -> %s\n", operation)
+	}
+	cacheFlags.BoolVar(&help, "help", false, "Show help")
+	cacheFlags.BoolVar(&help, "h", false, "Show help")
+	cacheFlags.Parse(args[1:])
+	// Show help
+	if help {
+		cacheFlags.Usage()
+		os.Exit(0)
+	}
+	// Check parameters
+	cacheDir := CacheDir()
+	if len(cacheDir) == 0 {
+		logs.FatalPrintf("Failed to determine the cache directory, please specify it with -cache-dir!\n")
+	}
+	if (operation == "export" || operation == "import") && len(archivePath) == 0 {
+		cacheFlags.Usage()
+		logs.FatalPrintf("Parameters missing: -file\n")
+	}
+
+	switch operation {
+	case "list":
+		err := ListCache(cacheDir, os.Stdout)
+		logs.CheckErrorWithMsg(err, "Failed to list cache %s!\n", cacheDir)
+	case "prune":
+		var deadline time.Time
+		if !all {
+			deadline = time.Now().Add(-olderThan)
+		}
+		logs.WaitPrintf("Pruning cache %s", cacheDir)
+		removedEntries, freedBytes, err := PruneCache(cacheDir, deadline)
+		logs.CheckErrorWithTagAndMsg(err, "Failed to prune cache %s!\n", cacheDir)
+		logs.SuccessPrintf("Removed %d artifacts, freed %s\n", removedEntries, formatSize(freedBytes))
+	case "export":
+		logs.WaitPrintf("Exporting cache %s to %s", cacheDir, archivePath)
+		exported, err := ExportCache(cacheDir, archivePath)
+		logs.CheckErrorWithTagAndMsg(err, "Failed to export cache!\n")
+		logs.SuccessPrintf("Exported %d artifacts to %s\n", exported, archivePath)
+	case "import":
+		logs.WaitPrintf("Importing %s into cache %s", archivePath, cacheDir)
+		imported, err := ImportCache(cacheDir, archivePath)
+		logs.CheckErrorWithTagAndMsg(err, "Failed to import cache!\n")
+		logs.SuccessPrintf("Imported %d artifacts into %s\n", imported, cacheDir)
+	}
+}
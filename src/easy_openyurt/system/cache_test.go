@@ -0,0 +1,163 @@
+package system
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+func TestCache(t *testing.T) {
+	content := []byte("cni plugins")
+	sum := sha256.Sum256(content)
+	contentSha256 := hex.EncodeToString(sum[:])
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	configs.System.CacheDir = t.TempDir()
+	configs.System.TmpDir = t.TempDir()
+	configs.System.ArtifactSha256["cni.tgz"] = contentSha256
+	defer func() {
+		configs.System.CacheDir = ""
+		configs.System.TmpDir = ""
+		delete(configs.System.ArtifactSha256, "cni.tgz")
+	}()
+
+	// Verified downloads are cached, mutable ones are not
+	if _, err := DownloadToTmpDir(server.URL + "/cni.tgz"); err != nil {
+		t.Fatalf("DownloadToTmpDir(cni.tgz) error = %v", err)
+	}
+	if _, err := DownloadToTmpDir(server.URL + "/containerd.service"); err != nil {
+		t.Fatalf("DownloadToTmpDir(containerd.service) error = %v", err)
+	}
+	index, err := readCacheIndex(configs.System.CacheDir)
+	if err != nil || len(index) != 1 || index[server.URL+"/cni.tgz"] == nil {
+		t.Fatalf("cache index = %v, %v, want only cni.tgz", index, err)
+	}
+
+	// Served from the cache once the server is gone
+	server.Close()
+	os.Remove(configs.System.TmpDir + "/cni.tgz")
+	filePath, err := DownloadToTmpDir(server.URL + "/cni.tgz")
+	if downloaded, _ := os.ReadFile(filePath); err != nil || !bytes.Equal(downloaded, content) {
+		t.Fatalf("DownloadToTmpDir(cached cni.tgz) = %q, %v", downloaded, err)
+	}
+
+	// Dry runs leave the cache alone
+	indexContent, _ := os.ReadFile(configs.System.CacheDir + "/" + cacheIndexFileName)
+	configs.System.DryRun = true
+	cachedFilePath := lookUpCache(&Download{Url: server.URL + "/cni.tgz", Sha256: contentSha256})
+	configs.System.DryRun = false
+	if newIndexContent, _ := os.ReadFile(configs.System.CacheDir + "/" + cacheIndexFileName); cachedFilePath == "" || !bytes.Equal(newIndexContent, indexContent) {
+		t.Errorf("lookUpCache() in dry-run mode = %q, should not update the cache index", cachedFilePath)
+	}
+
+	// Seed another machine
+	archivePath := t.TempDir() + "/cache.tar.gz"
+	if exported, err := ExportCache(configs.System.CacheDir, archivePath); err != nil || exported != 1 {
+		t.Fatalf("ExportCache() = %d, %v", exported, err)
+	}
+	otherCacheDir := t.TempDir()
+	if imported, err := ImportCache(otherCacheDir, archivePath); err != nil || imported != 1 {
+		t.Fatalf("ImportCache() = %d, %v", imported, err)
+	}
+	listing := new(bytes.Buffer)
+	if err := ListCache(otherCacheDir, listing); err != nil || !strings.Contains(listing.String(), "cni.tgz") || !strings.Contains(listing.String(), contentSha256[:12]) {
+		t.Errorf("ListCache() = %q, %v", listing, err)
+	}
+
+	// A corrupted blob is never used
+	os.WriteFile(cacheBlobPath(otherCacheDir, contentSha256), []byte("corrupted"), 0644)
+	configs.System.CacheDir = otherCacheDir
+	if cachedFilePath := lookUpCache(&Download{Url: server.URL + "/cni.tgz", Sha256: contentSha256}); cachedFilePath != "" {
+		t.Errorf("lookUpCache() = %q for a corrupted blob", cachedFilePath)
+	}
+
+	// Prune
+	if removed, _, err := PruneCache(otherCacheDir, time.Now().Add(-time.Hour)); err != nil || removed != 0 {
+		t.Errorf("PruneCache(1 hour ago) = %d, %v, want nothing removed", removed, err)
+	}
+	if removed, freed, err := PruneCache(otherCacheDir, time.Time{}); err != nil || removed != 1 || freed != int64(len("corrupted")) {
+		t.Errorf("PruneCache(all) = %d, %d, %v", removed, freed, err)
+	}
+	if _, err := os.Stat(cacheBlobPath(otherCacheDir, contentSha256)); !os.IsNotExist(err) {
+		t.Errorf("PruneCache(all) should remove blobs")
+	}
+}
+
+func TestCacheLooksUpPublishedChecksum(t *testing.T) {
+	content, evilContent := []byte("go release"), []byte("evil go release")
+	sum := sha256.Sum256(content)
+	contentSha256 := hex.EncodeToString(sum[:])
+	evilSum := sha256.Sum256(evilContent)
+	evilSha256 := hex.EncodeToString(evilSum[:])
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".sha256") {
+			fmt.Fprintf(w, "%s  go.tgz\n", contentSha256)
+			return
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+	configs.System.CacheDir = t.TempDir()
+	configs.System.TmpDir = t.TempDir()
+	defer func() { configs.System.CacheDir, configs.System.TmpDir = "", "" }()
+	download := func() []byte {
+		t.Helper()
+		filePath, err := DownloadToTmpDirWithChecksum(server.URL+"/go.tgz.sha256", server.URL+"/go.tgz")
+		if err != nil {
+			t.Fatalf("DownloadToTmpDirWithChecksum(go.tgz) error = %v", err)
+		}
+		downloaded, _ := os.ReadFile(filePath)
+		os.Remove(filePath)
+		return downloaded
+	}
+	download()
+
+	// An imported index maps the URL to another (self-consistent) blob
+	os.WriteFile(cacheBlobPath(configs.System.CacheDir, evilSha256), evilContent, 0644)
+	os.Remove(cacheBlobPath(configs.System.CacheDir, contentSha256))
+	index, _ := readCacheIndex(configs.System.CacheDir)
+	index[server.URL+"/go.tgz"].Sha256 = evilSha256
+	writeCacheIndex(configs.System.CacheDir, index)
+	if downloaded := download(); !bytes.Equal(downloaded, content) {
+		t.Errorf("DownloadToTmpDirWithChecksum(go.tgz) = %q, should only use blobs matching the published sum", downloaded)
+	}
+	// The download restored the genuine blob, which is used from now on
+	if cachedFilePath := lookUpCache(&Download{Url: server.URL + "/go.tgz", Sha256: contentSha256}); cachedFilePath == "" {
+		t.Errorf("DownloadToTmpDirWithChecksum(go.tgz) should cache the blob matching the published sum")
+	}
+}
+
+func TestCacheConcurrentUpdates(t *testing.T) {
+	configs.System.CacheDir = t.TempDir()
+	defer func() { configs.System.CacheDir = "" }()
+	fileDir := t.TempDir()
+
+	// Parallel runs sharing the cache do not lose each other's entries
+	var waitGroup sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		download := &Download{Url: fmt.Sprintf("https://example.com/%d.tgz", i), FilePath: fmt.Sprintf("%s/%d.tgz", fileDir, i)}
+		os.WriteFile(download.FilePath, []byte(download.Url), 0644)
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			if err := addToCache(download); err != nil {
+				t.Errorf("addToCache(%s) error = %v", download.Url, err)
+			}
+		}()
+	}
+	waitGroup.Wait()
+	if index, err := readCacheIndex(configs.System.CacheDir); err != nil || len(index) != 16 {
+		t.Errorf("cache index after parallel updates has %d entries, %v, want 16", len(index), err)
+	}
+}
@@ -0,0 +1,150 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
+)
+
+// Cgroup hierarchies
+const (
+	CgroupV1     = "v1"
+	CgroupV2     = "v2"
+	CgroupHybrid = "hybrid" // v1 controllers, with an empty v2 hierarchy at /sys/fs/cgroup/unified
+)
+
+// Cgroup drivers of the container runtime & kubelet, which must match
+const (
+	CgroupDriverSystemd  = "systemd"
+	CgroupDriverCgroupfs = "cgroupfs"
+)
+
+// Controllers needed by kubelet to enforce pod resources
+var requiredCgroupControllers = []string{"cpu", "cpuset", "memory", "pids"}
+
+// Name of the kubeadm patch setting the cgroup driver of kubelet
+const kubeletCgroupPatchName = "kubeletconfiguration+merge.yaml"
+
+// First kubeadm release applying kubeletconfiguration patches, older releases ignore them
+const kubeletCgroupPatchMinVersion = "1.25"
+
+// Cgroup setup of the node
+type CgroupSetup struct {
+	Version            string
+	InitSystem         string // Command name of PID 1, e.g. "systemd"
+	Driver             string
+	MissingControllers []string
+}
+
+// Get the controllers enabled on the hierarchy
+func cgroupControllers(version string) []string {
+	if version == CgroupV2 {
+		controllers, _ := readCheckFile("/sys/fs/cgroup/cgroup.controllers")
+		return strings.Fields(controllers)
+	}
+	// v1 & hybrid: "subsys_name hierarchy num_cgroups enabled" per line
+	var controllers []string
+	cgroups, _ := readCheckFile("/proc/cgroups")
+	for _, line := range strings.Split(cgroups, "\n") {
+		if fields := strings.Fields(line); len(fields) == 4 && !strings.HasPrefix(fields[0], "#") && fields[3] == "1" {
+			controllers = append(controllers, fields[0])
+		}
+	}
+	return controllers
+}
+
+// Detect the cgroup hierarchy & init system of the node, and the cgroup driver matching them
+func DetectCgroupSetup() (*CgroupSetup, error) {
+	setup := &CgroupSetup{}
+	if _, err := os.Stat(checkRootDir + "/sys/fs/cgroup/cgroup.controllers"); err == nil {
+		setup.Version = CgroupV2
+	} else if _, err := os.Stat(checkRootDir + "/sys/fs/cgroup/unified/cgroup.controllers"); err == nil {
+		setup.Version = CgroupHybrid
+	} else if _, err := os.Stat(checkRootDir + "/sys/fs/cgroup/memory"); err == nil {
+		setup.Version = CgroupV1
+	} else {
+		return nil, fmt.Errorf("no cgroup filesystem at /sys/fs/cgroup")
+	}
+
+	enabledControllers := map[string]bool{}
+	for _, controller := range cgroupControllers(setup.Version) {
+		enabledControllers[controller] = true
+	}
+	for _, controller := range requiredCgroupControllers {
+		if !enabledControllers[controller] {
+			setup.MissingControllers = append(setup.MissingControllers, controller)
+		}
+	}
+
+	// systemd owns the cgroup tree when it is the init system, a second manager (cgroupfs) would compete with it
+	setup.InitSystem, _ = readCheckFile("/proc/1/comm")
+	if setup.InitSystem == "systemd" {
+		setup.Driver = CgroupDriverSystemd
+	} else {
+		setup.Driver = CgroupDriverCgroupfs
+	}
+	return setup, nil
+}
+
+// Detect the cgroup setup and apply the matching driver to the container runtime & kubelet settings
+func ConfigureCgroupDriver() error {
+	setup, err := DetectCgroupSetup()
+	if err != nil {
+		return err
+	}
+	logs.InfoPrintf("Cgroup %s with init system %q, using the %s cgroup driver\n", setup.Version, setup.InitSystem, setup.Driver)
+	if setup.Version != CgroupV2 {
+		logs.WarnPrintf("Cgroup %s is in maintenance mode since Kubernetes 1.31, consider booting with systemd.unified_cgroup_hierarchy=1!\n", setup.Version)
+	}
+	if len(setup.MissingControllers) > 0 {
+		logs.WarnPrintf("Cgroup controllers %s are not enabled by the kernel, kubelet can not enforce the matching pod resources!\n", strings.Join(setup.MissingControllers, ", "))
+	}
+	systemdCgroup := setup.Driver == CgroupDriverSystemd
+	if len(configs.Containerd.ConfigFilePath) > 0 && configs.Containerd.SystemdCgroup != systemdCgroup {
+		logs.WarnPrintf("SystemdCgroup of %s is overridden by the %s cgroup driver of the node!\n", configs.Containerd.ConfigFilePath, setup.Driver)
+	}
+	configs.Containerd.SystemdCgroup = systemdCgroup
+	configs.System.SystemdStartUp = setup.InitSystem == "systemd"
+	configs.System.CgroupVersion = setup.Version
+	configs.System.CgroupDriver = setup.Driver
+	return nil
+}
+
+// Get the kubeadm patch setting the cgroup driver of kubelet
+func KubeletCgroupPatch() string {
+	return fmt.Sprintf("# Generated by easy_openyurt\napiVersion: kubelet.config.k8s.io/v1beta1\nkind: KubeletConfiguration\ncgroupDriver: %s\n", configs.System.CgroupDriver)
+}
+
+// Validate that kubeadm of -k8s-version applies the patch setting the cgroup driver of kubelet
+func ValidateKubeletCgroupPatch() error {
+	if compareVersions(kubeMinorVersion(configs.Kube.K8sVersion), kubeletCgroupPatchMinVersion) < 0 {
+		return fmt.Errorf("-k8s-version: kubeadm %s ignores the kubeletconfiguration patch setting the cgroup driver of kubelet, please choose %s+",
+			kubeMinorVersion(configs.Kube.K8sVersion), kubeletCgroupPatchMinVersion)
+	}
+	return nil
+}
+
+// Record the cgroup driver as a kubeadm patch, applied to kubelet by `kube` (kubeadm --patches)
+func WriteKubeletCgroupPatch() error {
+	patchPath := path.Join(configs.Kube.KubeadmPatchesDir, kubeletCgroupPatchName)
+	if err := RecordFileChange(patchPath); err != nil {
+		return err
+	}
+	if _, err := ExecCmd("sudo", "mkdir", "-p", configs.Kube.KubeadmPatchesDir); err != nil {
+		return err
+	}
+	_, err := ExecCmdWithInput(KubeletCgroupPatch(), "sudo", "tee", patchPath)
+	return err
+}
+
+// Get the `--patches` argument of kubeadm, if `system init` recorded any patch
+func KubeadmPatchesArgs() []string {
+	if _, err := os.Stat(path.Join(configs.Kube.KubeadmPatchesDir, kubeletCgroupPatchName)); err != nil {
+		return nil
+	}
+	return []string{"--patches", configs.Kube.KubeadmPatchesDir}
+}
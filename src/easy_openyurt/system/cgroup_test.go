@@ -0,0 +1,111 @@
+package system
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+// Let `SystemInit()` detect cgroup v2 with all controllers & the init system, and verify the sysctls, below a fake root
+func useFakeSystemRoot(t *testing.T, initSystem string) {
+	files := map[string]string{
+		"/sys/fs/cgroup/cgroup.controllers": "cpuset cpu io memory hugetlb pids rdma misc\n",
+		"/proc/1/comm":                      initSystem + "\n",
+	}
+	for _, sysctl := range kernelSysctls {
+		files[sysctl.procPath()] = sysctl.Value + "\n"
+	}
+	checkRootDir = writeCheckFiles(t, files)
+	t.Cleanup(func() {
+		checkRootDir = ""
+		configs.Containerd.SystemdCgroup = true
+		configs.System.SystemdStartUp = true
+		configs.System.CgroupVersion, configs.System.CgroupDriver = "", ""
+	})
+}
+
+func TestDetectCgroupSetup(t *testing.T) {
+	defer func() { checkRootDir = "" }()
+	for _, test := range []struct {
+		name    string
+		files   map[string]string
+		version string
+		driver  string
+		missing string
+	}{
+		{"v2 with systemd", map[string]string{
+			"/sys/fs/cgroup/cgroup.controllers": "cpuset cpu io memory pids\n",
+			"/proc/1/comm":                      "systemd\n",
+		}, CgroupV2, CgroupDriverSystemd, ""},
+		{"v2 without cpuset, with OpenRC", map[string]string{
+			"/sys/fs/cgroup/cgroup.controllers": "cpu io memory pids\n",
+			"/proc/1/comm":                      "openrc-init\n",
+		}, CgroupV2, CgroupDriverCgroupfs, "cpuset"},
+		{"hybrid", map[string]string{
+			"/sys/fs/cgroup/unified/cgroup.controllers": "",
+			"/proc/cgroups": "#subsys_name\thierarchy\tnum_cgroups\tenabled\ncpuset\t2\t1\t1\ncpu\t3\t64\t1\nmemory\t4\t90\t1\npids\t5\t70\t1\n",
+			"/proc/1/comm":  "systemd\n",
+		}, CgroupHybrid, CgroupDriverSystemd, ""},
+		{"v1 with memory disabled", map[string]string{
+			"/sys/fs/cgroup/memory/memory.limit_in_bytes": "9223372036854771712\n",
+			"/proc/cgroups": "#subsys_name\thierarchy\tnum_cgroups\tenabled\ncpuset\t2\t1\t1\ncpu\t3\t64\t1\nmemory\t0\t1\t0\npids\t5\t70\t1\n",
+			"/proc/1/comm":  "init\n",
+		}, CgroupV1, CgroupDriverCgroupfs, "memory"},
+	} {
+		checkRootDir = writeCheckFiles(t, test.files)
+		setup, err := DetectCgroupSetup()
+		if err != nil {
+			t.Errorf("DetectCgroupSetup(%s) error = %v", test.name, err)
+			continue
+		}
+		if setup.Version != test.version || setup.Driver != test.driver || strings.Join(setup.MissingControllers, ",") != test.missing {
+			t.Errorf("DetectCgroupSetup(%s) = %+v", test.name, setup)
+		}
+	}
+	checkRootDir = t.TempDir()
+	if _, err := DetectCgroupSetup(); err == nil {
+		t.Errorf("DetectCgroupSetup(no cgroup filesystem) should fail")
+	}
+}
+
+func TestConfigureCgroupDriver(t *testing.T) {
+	fakeRunner := useFakeRunner(t)
+	useFakeSystemRoot(t, "openrc-init")
+
+	if err := ConfigureCgroupDriver(); err != nil {
+		t.Fatalf("ConfigureCgroupDriver() error = %v", err)
+	}
+	if configs.Containerd.SystemdCgroup || configs.System.SystemdStartUp || configs.System.CgroupDriver != CgroupDriverCgroupfs {
+		t.Errorf("ConfigureCgroupDriver(openrc-init) should use cgroupfs: %+v", configs.System)
+	}
+	if err := WriteKubeletCgroupPatch(); err != nil {
+		t.Fatalf("WriteKubeletCgroupPatch() error = %v", err)
+	}
+	want := "sudo tee " + configs.Kube.KubeadmPatchesDir + "/kubeletconfiguration+merge.yaml"
+	if !fakeRunner.Executed(want) || !strings.Contains(KubeletCgroupPatch(), "\ncgroupDriver: cgroupfs\n") {
+		t.Errorf("WriteKubeletCgroupPatch() did not execute %q with %q\n%v", want, KubeletCgroupPatch(), fakeRunner)
+	}
+
+	// The patch is only passed to kubeadm once recorded
+	defer func(patchesDir string) { configs.Kube.KubeadmPatchesDir = patchesDir }(configs.Kube.KubeadmPatchesDir)
+	configs.Kube.KubeadmPatchesDir = t.TempDir()
+	if args := KubeadmPatchesArgs(); len(args) != 0 {
+		t.Errorf("KubeadmPatchesArgs(no patch) = %v", args)
+	}
+	os.WriteFile(configs.Kube.KubeadmPatchesDir+"/kubeletconfiguration+merge.yaml", []byte(KubeletCgroupPatch()), 0644)
+	if args := KubeadmPatchesArgs(); strings.Join(args, " ") != "--patches "+configs.Kube.KubeadmPatchesDir {
+		t.Errorf("KubeadmPatchesArgs() = %v", args)
+	}
+}
+
+func TestValidateKubeletCgroupPatch(t *testing.T) {
+	defer func(k8sVersion string) { configs.Kube.K8sVersion = k8sVersion }(configs.Kube.K8sVersion)
+	for version, valid := range map[string]bool{"1.24.17": false, "1.25.9": true, "1.29.0": true} {
+		configs.Kube.K8sVersion = version
+		if err := ValidateKubeletCgroupPatch(); (err == nil) != valid {
+			t.Errorf("ValidateKubeletCgroupPatch(%s) = %v", version, err)
+		}
+	}
+}
@@ -0,0 +1,444 @@
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+// Status of a check item
+const (
+	CheckPass = "pass"
+	CheckWarn = "warn" // Fixed by `SystemInit()`, or worth a look
+	CheckFail = "fail" // Blocks setting up the node
+)
+
+// Result of a check item
+type CheckResult struct {
+	Item    string `json:"item"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// Identity of a node, which must be unique in the cluster
+type NodeIdentity struct {
+	Hostname    string   `json:"hostname"`
+	Macs        []string `json:"macs"`
+	ProductUuid string   `json:"productUuid"`
+}
+
+// Report of `system check`
+type CheckReport struct {
+	NodeRole string         `json:"nodeRole"`
+	Identity NodeIdentity   `json:"identity"`
+	Results  []*CheckResult `json:"results"`
+}
+
+// Root of the files inspected by `system check` & the cgroup detection
+var checkRootDir = ""
+
+// Ports needed by each node role: kube-apiserver, kubelet, YurtHub & its proxy
+var checkPorts = map[string][]int{
+	"master": {6443, 10250, 10261, 10267},
+	"worker": {10250, 10261, 10267},
+}
+
+var lookupHost = net.DefaultResolver.LookupHost
+
+func (report *CheckReport) add(item string, status string, format string, pars ...any) {
+	// Keep each result on one line of the table
+	message := strings.Join(strings.Fields(fmt.Sprintf(format, pars...)), " ")
+	report.Results = append(report.Results, &CheckResult{Item: item, Status: status, Message: message})
+}
+
+// Count results of the status
+func (report *CheckReport) Count(status string) int {
+	count := 0
+	for _, result := range report.Results {
+		if result.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+func readCheckFile(filePath string) (string, error) {
+	data, err := os.ReadFile(checkRootDir + filePath)
+	return strings.TrimSpace(string(data)), err
+}
+
+// Status of missing a minimum, which only blocks the control plane
+func belowMinimumStatus(nodeRole string) string {
+	if nodeRole == "master" {
+		return CheckFail
+	}
+	return CheckWarn
+}
+
+func checkCpus(report *CheckReport) {
+	cpuInfo, err := readCheckFile("/proc/cpuinfo")
+	cpus := 0
+	for _, line := range strings.Split(cpuInfo, "\n") {
+		if strings.HasPrefix(line, "processor") {
+			cpus++
+		}
+	}
+	if err != nil || cpus == 0 {
+		cpus = runtime.NumCPU()
+	}
+	status := CheckPass
+	if cpus < configs.System.MinCpus {
+		status = belowMinimumStatus(report.NodeRole)
+	}
+	report.add("cpu", status, "%d CPUs (control plane needs %d)", cpus, configs.System.MinCpus)
+}
+
+func checkMemory(report *CheckReport) {
+	memInfo, err := readCheckFile("/proc/meminfo")
+	if err != nil {
+		report.add("memory", CheckWarn, "Unknown: %v", err)
+		return
+	}
+	for _, line := range strings.Split(memInfo, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		memoryKiB, err := strconv.Atoi(fields[1])
+		if err != nil {
+			break
+		}
+		status := CheckPass
+		if memoryKiB/1024 < configs.System.MinMemoryMiB {
+			status = belowMinimumStatus(report.NodeRole)
+		}
+		report.add("memory", status, "%d MiB (control plane needs %d MiB)", memoryKiB/1024, configs.System.MinMemoryMiB)
+		return
+	}
+	report.add("memory", CheckWarn, "Unknown: no MemTotal in /proc/meminfo")
+}
+
+func checkSwap(report *CheckReport) {
+	swaps, err := readCheckFile("/proc/swaps")
+	if err != nil {
+		report.add("swap", CheckWarn, "Unknown: %v", err)
+		return
+	}
+	var devices []string
+	for _, line := range strings.Split(swaps, "\n")[1:] {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			devices = append(devices, fields[0])
+		}
+	}
+	if len(devices) > 0 {
+		report.add("swap", CheckWarn, "On (%s), `system init` turns it off", strings.Join(devices, ", "))
+		return
+	}
+	report.add("swap", CheckPass, "Off")
+}
+
+func checkKernelModulesAndSysctls(report *CheckReport) {
+	for _, module := range kernelModules {
+		if kernelModuleLoaded(module) {
+			report.add("kernel-module/"+module, CheckPass, "Loaded")
+		} else {
+			report.add("kernel-module/"+module, CheckWarn, "Not loaded, `system init` loads it")
+		}
+	}
+	for _, sysctl := range kernelSysctls {
+		value, err := readCheckFile(sysctl.procPath())
+		switch {
+		case err != nil:
+			report.add("sysctl/"+sysctl.Key, CheckWarn, "Missing, `system init` sets it to %s", sysctl.Value)
+		case value != sysctl.Value:
+			report.add("sysctl/"+sysctl.Key, CheckWarn, "%s, `system init` sets it to %s", value, sysctl.Value)
+		default:
+			report.add("sysctl/"+sysctl.Key, CheckPass, "%s", value)
+		}
+	}
+	// Settings lost at the next boot, or edited since `system init`
+	for _, dropIn := range []struct {
+		path    string
+		content string
+	}{
+		{kernelModulesConfigPath, KernelModulesConfig()},
+		{sysctlConfigPath, SysctlConfig()},
+	} {
+		content, err := readCheckFile(dropIn.path)
+		switch {
+		case err != nil:
+			report.add("kernel-config/"+path.Base(dropIn.path), CheckWarn, "%s missing, `system init` writes it", dropIn.path)
+		case content != strings.TrimSpace(dropIn.content):
+			report.add("kernel-config/"+path.Base(dropIn.path), CheckWarn, "%s differs from the settings of `system init`", dropIn.path)
+		default:
+			report.add("kernel-config/"+path.Base(dropIn.path), CheckPass, "%s", dropIn.path)
+		}
+	}
+}
+
+func checkCgroup(report *CheckReport) {
+	setup, err := DetectCgroupSetup()
+	switch {
+	case err != nil:
+		report.add("cgroup", CheckFail, "No cgroup filesystem at /sys/fs/cgroup")
+		return
+	case setup.Version == CgroupV2:
+		report.add("cgroup", CheckPass, "v2, %s cgroup driver", setup.Driver)
+	default:
+		report.add("cgroup", CheckWarn, "%s, in maintenance mode since Kubernetes 1.31, %s cgroup driver", setup.Version, setup.Driver)
+	}
+	if len(setup.MissingControllers) > 0 {
+		report.add("cgroup-controllers", CheckWarn, "Not enabled by the kernel: %s", strings.Join(setup.MissingControllers, ", "))
+	} else {
+		report.add("cgroup-controllers", CheckPass, "%s", strings.Join(requiredCgroupControllers, ", "))
+	}
+}
+
+func checkFreePorts(report *CheckReport) {
+	for _, port := range checkPorts[report.NodeRole] {
+		item := fmt.Sprintf("port/%d", port)
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+		if err != nil {
+			report.add(item, CheckFail, "In use: %v", err)
+			continue
+		}
+		listener.Close()
+		report.add(item, CheckPass, "Free")
+	}
+}
+
+func checkComponents(report *CheckReport) {
+	for _, component := range []struct {
+		name    string
+		version string
+	}{
+		{"go", configs.System.GoVersion},
+		{"containerd", configs.System.ContainerdVersion},
+		{"runc", configs.System.RuncVersion},
+		{"cni-plugins", configs.System.CniPluginsVersion},
+	} {
+		item := "component/" + component.name
+		if !componentInstalled(component.name) {
+			report.add(item, CheckPass, "Not installed, `system init` installs %s", component.version)
+			continue
+		}
+		version, err := componentVersion(component.name)
+		switch {
+		case err != nil:
+			report.add(item, CheckWarn, "Installed, unknown version: %v", err)
+		case version != component.version:
+			report.add(item, CheckWarn, "%s installed, %s requested (see -upgrade-policy of `system init`)", version, component.version)
+		default:
+			report.add(item, CheckPass, "%s installed", version)
+		}
+	}
+}
+
+func checkDns(report *CheckReport) {
+	resolvConf, err := readCheckFile("/etc/resolv.conf")
+	var nameservers []string
+	for _, line := range strings.Split(resolvConf, "\n") {
+		if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "nameserver" {
+			nameservers = append(nameservers, fields[1])
+		}
+	}
+	if err != nil || len(nameservers) == 0 {
+		report.add("dns", CheckWarn, "No nameserver in /etc/resolv.conf, which is inherited by cluster DNS")
+		return
+	}
+	repoUrl, err := url.Parse(MirrorUrl(fmt.Sprintf(configs.System.KubeRepoUrlTemplate, kubeMinorVersion(configs.Kube.K8sVersion))))
+	if err != nil {
+		report.add("dns", CheckWarn, "Invalid package repository URL: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(Context(), 5*time.Second)
+	defer cancel()
+	if _, err = lookupHost(ctx, repoUrl.Hostname()); err != nil {
+		report.add("dns", CheckWarn, "Failed to resolve %s (needed unless installing from a bundle): %v", repoUrl.Hostname(), err)
+		return
+	}
+	report.add("dns", CheckPass, "Resolved %s via %s", repoUrl.Hostname(), strings.Join(nameservers, ", "))
+}
+
+func checkTimeSync(report *CheckReport) {
+	synchronized, err := ExecCmd("timedatectl", "show", "--property=NTPSynchronized", "--value")
+	switch {
+	case err != nil:
+		report.add("time-sync", CheckWarn, "Unknown: %v", err)
+	case strings.TrimSpace(synchronized) != "yes":
+		report.add("time-sync", CheckWarn, "Clock not synchronized by NTP, which certificates & tokens rely on")
+	default:
+		report.add("time-sync", CheckPass, "Synchronized by NTP")
+	}
+}
+
+// Get MAC addresses of the network devices (virtual interfaces may share theirs)
+func readMacs() ([]string, error) {
+	netDir := checkRootDir + "/sys/class/net"
+	entries, err := os.ReadDir(netDir)
+	if err != nil {
+		return nil, err
+	}
+	var macs []string
+	for _, entry := range entries {
+		if _, err := os.Stat(netDir + "/" + entry.Name() + "/device"); err != nil {
+			continue
+		}
+		mac, err := readCheckFile("/sys/class/net/" + entry.Name() + "/address")
+		if err != nil {
+			return nil, err
+		}
+		macs = append(macs, mac)
+	}
+	return macs, nil
+}
+
+// Find duplicates in values
+func duplicates(values []string) []string {
+	seen := map[string]bool{}
+	var duplicated []string
+	for _, value := range values {
+		if seen[value] && !contains(duplicated, value) {
+			duplicated = append(duplicated, value)
+		}
+		seen[value] = true
+	}
+	return duplicated
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Check the identity of this node, which must differ from the peers (reports of other nodes by file name)
+func checkIdentity(report *CheckReport, peers map[string]*CheckReport) {
+	var peerNames []string
+	for peerName := range peers {
+		peerNames = append(peerNames, peerName)
+	}
+	sort.Strings(peerNames)
+	// Find peers sharing an identity value
+	sharedWith := func(value func(identity *NodeIdentity) []string) []string {
+		var sharing []string
+		for _, peerName := range peerNames {
+			for _, v := range value(&peers[peerName].Identity) {
+				if len(v) > 0 && contains(value(&report.Identity), v) {
+					sharing = append(sharing, fmt.Sprintf("%s (%s)", v, peerName))
+				}
+			}
+		}
+		return sharing
+	}
+
+	// Hostname, which becomes the node name
+	hostname, err := readCheckFile("/proc/sys/kernel/hostname")
+	if err != nil {
+		hostname, err = os.Hostname()
+	}
+	report.Identity.Hostname = strings.ToLower(hostname)
+	hostnames := func(identity *NodeIdentity) []string { return []string{identity.Hostname} }
+	switch {
+	case err != nil:
+		report.add("hostname", CheckFail, "Unknown: %v", err)
+	case !nodeNameRegexp.MatchString(report.Identity.Hostname) || len(report.Identity.Hostname) > 253:
+		report.add("hostname", CheckFail, "%s is not a valid node name", hostname)
+	case report.Identity.Hostname == "localhost":
+		report.add("hostname", CheckFail, "localhost is not a unique node name")
+	case len(sharedWith(hostnames)) > 0:
+		report.add("hostname", CheckFail, "Duplicate: %s", strings.Join(sharedWith(hostnames), ", "))
+	default:
+		report.add("hostname", CheckPass, "%s", report.Identity.Hostname)
+	}
+
+	// MAC addresses
+	report.Identity.Macs, err = readMacs()
+	macs := func(identity *NodeIdentity) []string { return identity.Macs }
+	switch {
+	case err != nil:
+		report.add("mac", CheckWarn, "Unknown: %v", err)
+	case len(duplicates(report.Identity.Macs)) > 0:
+		report.add("mac", CheckFail, "Duplicate among network devices: %s", strings.Join(duplicates(report.Identity.Macs), ", "))
+	case len(sharedWith(macs)) > 0:
+		report.add("mac", CheckFail, "Duplicate: %s", strings.Join(sharedWith(macs), ", "))
+	default:
+		report.add("mac", CheckPass, "%s", strings.Join(report.Identity.Macs, ", "))
+	}
+
+	// product_uuid, only readable by root
+	report.Identity.ProductUuid, err = readCheckFile("/sys/class/dmi/id/product_uuid")
+	productUuids := func(identity *NodeIdentity) []string { return []string{identity.ProductUuid} }
+	switch {
+	case errors.Is(err, os.ErrPermission):
+		report.add("product-uuid", CheckWarn, "Unknown, only readable by root")
+	case err != nil:
+		report.add("product-uuid", CheckWarn, "Unknown: %v", err)
+	case len(sharedWith(productUuids)) > 0:
+		report.add("product-uuid", CheckFail, "Duplicate: %s", strings.Join(sharedWith(productUuids), ", "))
+	default:
+		report.add("product-uuid", CheckPass, "%s", report.Identity.ProductUuid)
+	}
+}
+
+// Inspect the node without modifying anything
+// peers are reports of other nodes (by file name) to find duplicate identities
+func CheckSystem(nodeRole string, peers map[string]*CheckReport) *CheckReport {
+	report := &CheckReport{NodeRole: nodeRole}
+	checkCpus(report)
+	checkMemory(report)
+	checkSwap(report)
+	checkKernelModulesAndSysctls(report)
+	checkCgroup(report)
+	checkFreePorts(report)
+	checkComponents(report)
+	checkDns(report)
+	checkTimeSync(report)
+	checkIdentity(report, peers)
+	return report
+}
+
+// Write the report as table or JSON
+func WriteCheckReport(writer io.Writer, report *CheckReport, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	tableWriter := tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tableWriter, "STATUS\tITEM\tDETAIL\n")
+	for _, result := range report.Results {
+		fmt.Fprintf(tableWriter, "%s\t%s\t%s\n", strings.ToUpper(result.Status), result.Item, result.Message)
+	}
+	return tableWriter.Flush()
+}
+
+// Read a JSON report written by `system check`
+func ReadCheckReport(reportPath string) (*CheckReport, error) {
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		return nil, err
+	}
+	report := &CheckReport{}
+	if err = json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("%s: %w", reportPath, err)
+	}
+	return report, nil
+}
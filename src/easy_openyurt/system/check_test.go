@@ -0,0 +1,126 @@
+package system
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+// Create the files inspected by `system check` below a fake root
+func writeCheckFiles(t *testing.T, files map[string]string) string {
+	rootDir := t.TempDir()
+	for filePath, content := range files {
+		if err := os.MkdirAll(filepath.Dir(rootDir+filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(rootDir+filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rootDir
+}
+
+func TestCheckSystem(t *testing.T) {
+	fakeRunner := useFakeRunner(t)
+	fakeRunner.On("containerd --version", FakeResponse{Stdout: "containerd github.com/containerd/containerd v1.7.2 0cae528dd6cb557f7201036e9f43420650207b58"})
+	fakeRunner.On("timedatectl", FakeResponse{Stdout: "no"})
+	checkRootDir = writeCheckFiles(t, map[string]string{
+		"/proc/cpuinfo":                                 "processor\t: 0\nprocessor\t: 1\n",
+		"/proc/meminfo":                                 "MemTotal:        1024000 kB\nMemFree:          512000 kB\n",
+		"/proc/swaps":                                   "Filename\tType\tSize\tUsed\tPriority\n/swap.img\tfile\t2097148\t0\t-2\n",
+		"/proc/modules":                                 "overlay 151552 0 - Live 0x0000000000000000\n",
+		"/proc/sys/net/ipv4/ip_forward":                 "0\n",
+		"/proc/sys/net/ipv4/conf/all/forwarding":        "1\n",
+		"/proc/sys/net/bridge/bridge-nf-call-iptables":  "1\n",
+		"/proc/sys/net/bridge/bridge-nf-call-ip6tables": "1\n",
+		"/proc/sys/kernel/hostname":                     "Edge-1\n",
+		"/sys/fs/cgroup/cgroup.controllers":             "cpu memory pids\n",
+		"/sys/class/net/eth0/address":                   "02:fc:00:00:00:01\n",
+		"/sys/class/net/eth0/device/vendor":             "0x1af4\n",
+		"/sys/class/net/cni0/address":                   "02:fc:00:00:00:01\n",
+		"/sys/class/dmi/id/product_uuid":                "03000200-0400-0500-0006-000700080009\n",
+		"/etc/resolv.conf":                              "nameserver 10.0.0.53\n",
+	})
+	// containerd is installed, go is not
+	binDir := t.TempDir()
+	os.WriteFile(binDir+"/containerd", []byte("#!/bin/sh\n"), 0755)
+	t.Setenv("PATH", binDir)
+	// A port needed by the node is taken
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	takenPort := listener.Addr().(*net.TCPAddr).Port
+	checkPorts["worker"] = []int{takenPort}
+	lookupHost = func(ctx context.Context, host string) ([]string, error) { return []string{"10.0.0.1"}, nil }
+	defer func() {
+		checkRootDir = ""
+		checkPorts["worker"] = []int{10250, 10261, 10267}
+		lookupHost = net.DefaultResolver.LookupHost
+	}()
+
+	peers := map[string]*CheckReport{
+		"edge-2.json": {Identity: NodeIdentity{Hostname: "edge-2", Macs: []string{"02:fc:00:00:00:02"}, ProductUuid: "03000200-0400-0500-0006-000700080009"}},
+	}
+	report := CheckSystem("worker", peers)
+	statuses := map[string]string{}
+	for _, result := range report.Results {
+		statuses[result.Item] = result.Status
+	}
+	for item, want := range map[string]string{
+		fmt.Sprintf("port/%d", takenPort): CheckFail,
+		"cpu":                             CheckPass,
+		"memory":                          CheckWarn, // Only blocks the control plane
+		"swap":                            CheckWarn,
+		"kernel-module/overlay":           CheckPass,
+		"kernel-module/br_netfilter":      CheckWarn,
+		"sysctl/net.ipv4.ip_forward":      CheckWarn,
+		"sysctl/net.bridge.bridge-nf-call-iptables": CheckPass,
+		"kernel-config/99-kubernetes-cri.conf":      CheckWarn, // Not written yet
+		"cgroup":                                    CheckPass,
+		"cgroup-controllers":                        CheckWarn, // cpuset is missing
+		"component/go":                              CheckPass,
+		"component/containerd":                      CheckWarn, // 1.7.2 instead of the configured version
+		"dns":                                       CheckPass,
+		"time-sync":                                 CheckWarn,
+		"hostname":                                  CheckPass,
+		"mac":                                       CheckPass, // cni0 is virtual
+		"product-uuid":                              CheckFail, // Shared with edge-2
+	} {
+		if statuses[item] != want {
+			t.Errorf("CheckSystem() %s = %s, want %s\n%+v", item, statuses[item], want, report.Results)
+		}
+	}
+	if report.Identity.Hostname != "edge-1" || len(report.Identity.Macs) != 1 {
+		t.Errorf("CheckSystem() identity = %+v", report.Identity)
+	}
+
+	// JSON reports of other nodes are read back for -compare
+	var output bytes.Buffer
+	if err := WriteCheckReport(&output, report, "json"); err != nil {
+		t.Fatal(err)
+	}
+	reportPath := filepath.Join(t.TempDir(), "edge-1.json")
+	os.WriteFile(reportPath, output.Bytes(), 0644)
+	readReport, err := ReadCheckReport(reportPath)
+	if err != nil || readReport.Count(CheckFail) != report.Count(CheckFail) || readReport.Identity.ProductUuid != report.Identity.ProductUuid {
+		t.Errorf("ReadCheckReport() = %+v, %v", readReport, err)
+	}
+	if err := json.Unmarshal(output.Bytes(), &map[string]any{}); err != nil {
+		t.Errorf("WriteCheckReport(json) = %s, %v", output.String(), err)
+	}
+
+	configs.System.MinCpus = 4
+	defer func() { configs.System.MinCpus = 2 }()
+	if report = CheckSystem("master", nil); report.Results[0].Status != CheckFail {
+		t.Errorf("CheckSystem(master) cpu = %+v", report.Results[0])
+	}
+}
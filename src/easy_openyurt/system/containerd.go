@@ -0,0 +1,364 @@
+package system
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+// Relevant part of containerd config.toml, the rest is left to containerd defaults
+// Schema version 2 is read by containerd 1.x, version 3 by containerd 2.x
+type ContainerdConfig struct {
+	Version            int
+	SandboxImage       string
+	Snapshotter        string
+	RegistryConfigPath string
+	DefaultRuntime     string
+	Runtimes           map[string]*configs.ContainerdRuntime
+}
+
+var tomlBareKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Get the sandbox (pause) image of containerd
+func SandboxImage() string {
+	if len(configs.Containerd.SandboxImage) > 0 {
+		return configs.Containerd.SandboxImage
+	}
+	return defaultSandboxImage()
+}
+
+// Get the sandbox (pause) image of the Kubernetes version
+func defaultSandboxImage() string {
+	imageRepo := "registry.k8s.io"
+	if len(configs.Kube.AlternativeImageRepo) > 0 {
+		imageRepo = configs.Kube.AlternativeImageRepo
+	}
+	pauseVersion, ok := configs.Containerd.PauseVersions[kubeMinorVersion(configs.Kube.K8sVersion)]
+	if !ok {
+		// Follow the latest known Kubernetes version
+		latestKubeVersion := ""
+		for kubeVersion, version := range configs.Containerd.PauseVersions {
+			if compareVersions(kubeVersion, latestKubeVersion) > 0 {
+				latestKubeVersion, pauseVersion = kubeVersion, version
+			}
+		}
+	}
+	return fmt.Sprintf("%s/pause:%s", imageRepo, pauseVersion)
+}
+
+// Build the containerd config from `configs.Containerd` for the containerd version
+func NewContainerdConfig(containerdVersion string) *ContainerdConfig {
+	config := &ContainerdConfig{
+		Version:            2,
+		SandboxImage:       SandboxImage(),
+		Snapshotter:        configs.Containerd.Snapshotter,
+		RegistryConfigPath: configs.Containerd.RegistryConfigDir,
+		DefaultRuntime:     "runc",
+		Runtimes: map[string]*configs.ContainerdRuntime{
+			"runc": {Type: "io.containerd.runc.v2", Options: map[string]any{"SystemdCgroup": configs.Containerd.SystemdCgroup}},
+		},
+	}
+	if compareVersions(containerdVersion, "2.0.0") >= 0 {
+		config.Version = 3
+	}
+	for name, runtime := range configs.Containerd.Runtimes {
+		config.Runtimes[name] = runtime
+	}
+	return config
+}
+
+// Quote a TOML basic string
+func tomlString(s string) string {
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			quoted.WriteByte('\\')
+			quoted.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&quoted, "\\u%04X", r)
+		default:
+			quoted.WriteRune(r)
+		}
+	}
+	quoted.WriteByte('"')
+	return quoted.String()
+}
+
+func tomlKey(key string) string {
+	if tomlBareKeyRegexp.MatchString(key) {
+		return key
+	}
+	return tomlString(key)
+}
+
+// Encode a TOML value (JSON numbers are decoded as float64)
+func tomlValue(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return tomlString(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []string:
+		var elements []any
+		for _, element := range v {
+			elements = append(elements, element)
+		}
+		return tomlValue(elements)
+	case []any:
+		var elements []string
+		for _, element := range v {
+			encoded, err := tomlValue(element)
+			if err != nil {
+				return "", err
+			}
+			elements = append(elements, encoded)
+		}
+		return "[" + strings.Join(elements, ", ") + "]", nil
+	default:
+		return "", fmt.Errorf("unsupported value %v (%T)", value, value)
+	}
+}
+
+// Write a TOML table with its key/value pairs in order
+func writeTomlTable(content *strings.Builder, table string, pairs ...any) error {
+	fmt.Fprintf(content, "\n[%s]\n", table)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		encoded, err := tomlValue(pairs[i+1])
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", table, pairs[i], err)
+		}
+		fmt.Fprintf(content, "  %s = %s\n", tomlKey(pairs[i].(string)), encoded)
+	}
+	return nil
+}
+
+// Encode the config as config.toml of its schema version
+func (config *ContainerdConfig) Marshal() ([]byte, error) {
+	var content strings.Builder
+	fmt.Fprintf(&content, "# Generated by easy_openyurt\nversion = %d\n", config.Version)
+	// Plugin tables of CRI, split into images & runtime since schema version 3
+	var err error
+	var runtimeTable string
+	switch config.Version {
+	case 2:
+		criTable := `plugins."io.containerd.grpc.v1.cri"`
+		runtimeTable = criTable + ".containerd"
+		err = writeTomlTable(&content, criTable, "sandbox_image", config.SandboxImage)
+		if err == nil {
+			err = writeTomlTable(&content, criTable+".registry", "config_path", config.RegistryConfigPath)
+		}
+		if err == nil {
+			err = writeTomlTable(&content, runtimeTable, "snapshotter", config.Snapshotter, "default_runtime_name", config.DefaultRuntime)
+		}
+	case 3:
+		imagesTable := `plugins."io.containerd.cri.v1.images"`
+		runtimeTable = `plugins."io.containerd.cri.v1.runtime".containerd`
+		err = writeTomlTable(&content, imagesTable, "snapshotter", config.Snapshotter)
+		if err == nil {
+			err = writeTomlTable(&content, imagesTable+".pinned_images", "sandbox", config.SandboxImage)
+		}
+		if err == nil {
+			err = writeTomlTable(&content, imagesTable+".registry", "config_path", config.RegistryConfigPath)
+		}
+		if err == nil {
+			err = writeTomlTable(&content, runtimeTable, "default_runtime_name", config.DefaultRuntime)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported containerd config version %d", config.Version)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range config.Runtimes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		runtime := config.Runtimes[name]
+		table := runtimeTable + ".runtimes." + tomlKey(name)
+		if err = writeTomlTable(&content, table, "runtime_type", runtime.Type); err != nil {
+			return nil, err
+		}
+		if len(runtime.Options) == 0 {
+			continue
+		}
+		var options []any
+		var keys []string
+		for key := range runtime.Options {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			options = append(options, key, runtime.Options[key])
+		}
+		if err = writeTomlTable(&content, table+".options", options...); err != nil {
+			return nil, err
+		}
+	}
+	return []byte(content.String()), nil
+}
+
+// Get hosts.toml of a registry, trying its mirrors first
+// Insecure registries are reached over TLS without verification, then over plain HTTP
+func RegistryHostsConfig(host string, mirrors []string, insecure bool) string {
+	server := "https://" + host
+	if host == "docker.io" {
+		server = "https://registry-1.docker.io"
+	}
+	if insecure {
+		server = "http://" + host
+	}
+	content := fmt.Sprintf("# Generated by easy_openyurt\nserver = %s\n", tomlString(server))
+	for _, mirror := range mirrors {
+		content += fmt.Sprintf("\n[host.%s]\n  capabilities = [\"pull\", \"resolve\"]\n", tomlString(mirror))
+	}
+	if insecure {
+		content += fmt.Sprintf("\n[host.%s]\n  capabilities = [\"pull\", \"resolve\", \"push\"]\n  skip_verify = true\n", tomlString("https://"+host))
+	}
+	return content
+}
+
+// Load the containerd config file (if any) over `configs.Containerd`
+func LoadContainerdSettings() error {
+	if len(configs.Containerd.ConfigFilePath) == 0 {
+		return nil
+	}
+	content, err := os.ReadFile(configs.Containerd.ConfigFilePath)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(content, &configs.Containerd); err != nil {
+		return fmt.Errorf("invalid containerd config %s: %w", configs.Containerd.ConfigFilePath, err)
+	}
+	return nil
+}
+
+// Add registry mirrors given as `host=mirror,host=mirror` to registryMirrors
+func AddRegistryMirrors(registryMirrors map[string][]string, mirrors string) error {
+	for _, mirror := range strings.Split(mirrors, ",") {
+		if len(strings.TrimSpace(mirror)) == 0 {
+			continue
+		}
+		host, mirrorUrl, found := strings.Cut(strings.TrimSpace(mirror), "=")
+		if !found || len(host) == 0 || len(mirrorUrl) == 0 {
+			return fmt.Errorf("invalid registry mirror %q, expected host=mirror", mirror)
+		}
+		registryMirrors[host] = append(registryMirrors[host], mirrorUrl)
+	}
+	return nil
+}
+
+// Validate registries & mirrors of `configs.Containerd`
+func ValidateContainerdSettings() error {
+	return validateRegistries(configs.Containerd.InsecureRegistries, configs.Containerd.RegistryMirrors)
+}
+
+// Validate registries (host[:port]) & their mirrors (absolute URLs)
+func validateRegistries(insecureRegistries []string, registryMirrors map[string][]string) error {
+	validateRegistry := func(registry string) error {
+		host, port, err := net.SplitHostPort(registry)
+		if err != nil {
+			host, port = registry, ""
+		}
+		if ValidateAddress("registry", host) != nil || (len(port) > 0 && ValidatePort("registry", port) != nil) {
+			return fmt.Errorf("invalid registry %q, expected host[:port]", registry)
+		}
+		return nil
+	}
+	for _, registry := range insecureRegistries {
+		if err := validateRegistry(registry); err != nil {
+			return err
+		}
+	}
+	for registry, mirrors := range registryMirrors {
+		if err := validateRegistry(registry); err != nil {
+			return err
+		}
+		for _, mirror := range mirrors {
+			if parsedUrl, err := url.Parse(mirror); err != nil || len(parsedUrl.Scheme) == 0 || len(parsedUrl.Host) == 0 {
+				return fmt.Errorf("invalid mirror %q of registry %s, expected an absolute URL", mirror, registry)
+			}
+		}
+	}
+	return nil
+}
+
+// Write config.toml (backing up the original one) & hosts.toml of the configured registries
+// containerd has to be restarted by the caller afterwards
+func ConfigureContainerd() error {
+	containerdVersion := configs.System.ContainerdVersion
+	if configs.System.ContainerdInstalled {
+		if installedVersion, err := componentVersion("containerd"); err == nil {
+			containerdVersion = installedVersion
+		}
+	}
+	content, err := NewContainerdConfig(containerdVersion).Marshal()
+	if err != nil {
+		return err
+	}
+	configPath := configs.Containerd.ConfigPath
+	if err = RecordFileChange(configPath); err != nil {
+		return err
+	}
+	// Keep only the config found before the first run, later runs would back up a generated one
+	backupPath := configPath + ".bak"
+	_, err = ExecShellCmd("if [ -f %s ] && [ ! -e %s ]; then sudo cp -p %s %s; fi", ShellQuote(configPath), ShellQuote(backupPath), ShellQuote(configPath), ShellQuote(backupPath))
+	if err != nil {
+		return err
+	}
+	if _, err = ExecCmd("sudo", "mkdir", "-p", path.Dir(configPath)); err != nil {
+		return err
+	}
+	if _, err = ExecCmdWithInput(string(content), "sudo", "tee", configPath); err != nil {
+		return err
+	}
+
+	insecureRegistries := map[string]bool{}
+	for _, registry := range configs.Containerd.InsecureRegistries {
+		insecureRegistries[registry] = true
+	}
+	var registries []string
+	for registry := range configs.Containerd.RegistryMirrors {
+		if !insecureRegistries[registry] {
+			registries = append(registries, registry)
+		}
+	}
+	for registry := range insecureRegistries {
+		registries = append(registries, registry)
+	}
+	sort.Strings(registries)
+	for _, registry := range registries {
+		insecure := insecureRegistries[registry]
+		registryDir := path.Join(configs.Containerd.RegistryConfigDir, registry)
+		if _, err = ExecCmd("sudo", "mkdir", "-p", registryDir); err != nil {
+			return err
+		}
+		hostsConfig := RegistryHostsConfig(registry, configs.Containerd.RegistryMirrors[registry], insecure)
+		if err = RecordFileChange(registryDir + "/hosts.toml"); err != nil {
+			return err
+		}
+		if _, err = ExecCmdWithInput(hostsConfig, "sudo", "tee", registryDir+"/hosts.toml"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
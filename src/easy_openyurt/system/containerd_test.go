@@ -0,0 +1,123 @@
+package system
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+func TestContainerdConfig(t *testing.T) {
+	configs.Kube.AlternativeImageRepo = "registry.example.com/k8s"
+	configs.Containerd.Runtimes = map[string]*configs.ContainerdRuntime{
+		"kata": {Type: "io.containerd.kata.v2", Options: map[string]any{"ConfigPath": "/opt/kata/configuration.toml", "Debug": false}},
+	}
+	defer func() {
+		configs.Kube.AlternativeImageRepo = ""
+		configs.Containerd.Runtimes = map[string]*configs.ContainerdRuntime{}
+	}()
+
+	content, err := NewContainerdConfig("1.6.18").Marshal()
+	if err != nil {
+		t.Fatalf("Marshal(v2) error = %v", err)
+	}
+	for _, want := range []string{
+		"version = 2\n",
+		"[plugins.\"io.containerd.grpc.v1.cri\"]\n  sandbox_image = \"registry.example.com/k8s/pause:3.8\"\n",
+		"[plugins.\"io.containerd.grpc.v1.cri\".registry]\n  config_path = \"/etc/containerd/certs.d\"\n",
+		"[plugins.\"io.containerd.grpc.v1.cri\".containerd.runtimes.runc.options]\n  SystemdCgroup = true\n",
+		"[plugins.\"io.containerd.grpc.v1.cri\".containerd.runtimes.kata]\n  runtime_type = \"io.containerd.kata.v2\"\n",
+		"  ConfigPath = \"/opt/kata/configuration.toml\"\n  Debug = false\n",
+	} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Marshal(v2) does not contain %q:\n%s", want, content)
+		}
+	}
+
+	configs.Kube.K8sVersion = "1.31.1"
+	defer func() { configs.Kube.K8sVersion = "1.25.9" }()
+	content, err = NewContainerdConfig("2.0.0").Marshal()
+	if err != nil {
+		t.Fatalf("Marshal(v3) error = %v", err)
+	}
+	for _, want := range []string{
+		"version = 3\n",
+		"[plugins.\"io.containerd.cri.v1.images\".pinned_images]\n  sandbox = \"registry.example.com/k8s/pause:3.10\"\n",
+		"[plugins.\"io.containerd.cri.v1.runtime\".containerd.runtimes.runc.options]\n  SystemdCgroup = true\n",
+	} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Marshal(v3) does not contain %q:\n%s", want, content)
+		}
+	}
+	if strings.Contains(string(content), "io.containerd.grpc.v1.cri") {
+		t.Errorf("Marshal(v3) should not use the CRI plugin of version 2:\n%s", content)
+	}
+
+	// Kubernetes versions missing from the table follow the latest one
+	configs.Kube.K8sVersion = "1.40.0"
+	if image := SandboxImage(); image != "registry.example.com/k8s/pause:3.10" {
+		t.Errorf("SandboxImage(1.40.0) = %s", image)
+	}
+}
+
+func TestRegistryHostsConfig(t *testing.T) {
+	want := "# Generated by easy_openyurt\nserver = \"https://registry-1.docker.io\"\n\n[host.\"https://mirror.gcr.io\"]\n  capabilities = [\"pull\", \"resolve\"]\n"
+	if hostsConfig := RegistryHostsConfig("docker.io", []string{"https://mirror.gcr.io"}, false); hostsConfig != want {
+		t.Errorf("RegistryHostsConfig(docker.io) = %q, want %q", hostsConfig, want)
+	}
+	hostsConfig := RegistryHostsConfig("docker-registry.registry.svc.cluster.local:5000", nil, true)
+	if !strings.Contains(hostsConfig, "server = \"http://docker-registry.registry.svc.cluster.local:5000\"") ||
+		!strings.Contains(hostsConfig, "[host.\"https://docker-registry.registry.svc.cluster.local:5000\"]\n  capabilities = [\"pull\", \"resolve\", \"push\"]\n  skip_verify = true\n") {
+		t.Errorf("RegistryHostsConfig(insecure) = %q", hostsConfig)
+	}
+}
+
+func TestConfigureContainerd(t *testing.T) {
+	fakeRunner := useFakeRunner(t)
+	configPath := t.TempDir() + "/containerd.json"
+	os.WriteFile(configPath, []byte(`{"SandboxImage": "registry.example.com/pause:3.9", "RegistryMirrors": {"docker.io": ["https://mirror.gcr.io"]}}`), 0644)
+	configs.Containerd.ConfigFilePath = configPath
+	defer func() {
+		configs.Containerd.ConfigFilePath, configs.Containerd.SandboxImage = "", ""
+		configs.Containerd.RegistryMirrors, configs.Containerd.InsecureRegistries = map[string][]string{}, []string{}
+	}()
+	if err := LoadContainerdSettings(); err != nil {
+		t.Fatalf("LoadContainerdSettings() error = %v", err)
+	}
+	configs.Containerd.InsecureRegistries = append(configs.Containerd.InsecureRegistries, "localhost:5000")
+	if err := AddRegistryMirrors(configs.Containerd.RegistryMirrors, "ghcr.io=https://ghcr.example.com,"); err != nil {
+		t.Fatalf("AddRegistryMirrors() error = %v", err)
+	}
+	if err := ValidateContainerdSettings(); err != nil {
+		t.Fatalf("ValidateContainerdSettings() error = %v", err)
+	}
+	if err := ConfigureContainerd(); err != nil {
+		t.Fatalf("ConfigureContainerd() error = %v", err)
+	}
+	for _, pattern := range []string{
+		"[ ! -e /etc/containerd/config.toml.bak ]; then sudo cp -p /etc/containerd/config.toml /etc/containerd/config.toml.bak;",
+		"sudo tee /etc/containerd/config.toml",
+		"sudo tee /etc/containerd/certs.d/docker.io/hosts.toml",
+		"sudo tee /etc/containerd/certs.d/ghcr.io/hosts.toml",
+		"sudo tee /etc/containerd/certs.d/localhost:5000/hosts.toml",
+	} {
+		if !fakeRunner.Executed(pattern) {
+			t.Errorf("ConfigureContainerd() did not execute %q\n%v", pattern, fakeRunner)
+		}
+	}
+	if fakeRunner.Index("config.toml.bak") > fakeRunner.Index("sudo tee /etc/containerd/config.toml") {
+		t.Errorf("ConfigureContainerd() should back up config.toml before writing it\n%v", fakeRunner)
+	}
+
+	for _, invalid := range []func(){
+		func() { configs.Containerd.InsecureRegistries = []string{"http://localhost:5000"} },
+		func() { configs.Containerd.RegistryMirrors = map[string][]string{"docker.io": {"mirror.gcr.io"}} },
+	} {
+		configs.Containerd.InsecureRegistries, configs.Containerd.RegistryMirrors = []string{}, map[string][]string{}
+		invalid()
+		if err := ValidateContainerdSettings(); err == nil {
+			t.Errorf("ValidateContainerdSettings(%v, %v) should fail", configs.Containerd.InsecureRegistries, configs.Containerd.RegistryMirrors)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package system
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
+)
+
+// Root context of the current run
+var rootContext = context.Background()
+
+// Get the root context of the current run, which is cancelled on SIGINT/SIGTERM or when the overall timeout expires
+func Context() context.Context {
+	return rootContext
+}
+
+// Derive the context of a single step (command or wait loop) from the root context
+func StepContext() (context.Context, context.CancelFunc) {
+	if configs.System.StepTimeout > 0 {
+		return context.WithTimeout(rootContext, configs.System.StepTimeout)
+	}
+	return context.WithCancel(rootContext)
+}
+
+// Set up the root context with the overall timeout and SIGINT/SIGTERM handling
+func setUpContext() {
+	var cancel context.CancelFunc
+	if configs.System.Timeout > 0 {
+		rootContext, cancel = context.WithTimeout(context.Background(), configs.System.Timeout)
+	} else {
+		rootContext, cancel = context.WithCancel(context.Background())
+	}
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		// The first signal stops the running step, the remaining steps are then aborted by the caller
+		receivedSignal := <-signals
+		logs.WarnPrintf("Received %v, stopping...\n", receivedSignal)
+		cancel()
+		// The second signal exits immediately
+		receivedSignal = <-signals
+		logs.FatalPrintf("Received %v again, exiting immediately!\n", receivedSignal)
+	}()
+}
+
+// Send SIGTERM to process pid and all its descendants
+func terminateProcessTree(pid int) error {
+	for _, child := range listChildProcesses(pid) {
+		terminateProcessTree(child)
+	}
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
+
+// List the direct children of process pid by scanning /proc
+func listChildProcesses(pid int) []int {
+	var children []int
+	procEntries, err := os.ReadDir("/proc")
+	if err != nil {
+		return children
+	}
+	for _, procEntry := range procEntries {
+		childPid, err := strconv.Atoi(procEntry.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := os.ReadFile("/proc/" + procEntry.Name() + "/stat")
+		if err != nil {
+			continue
+		}
+		// Format: pid (comm) state ppid ..., comm may contain spaces and parentheses
+		fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+		if len(fields) > 1 && fields[1] == strconv.Itoa(pid) {
+			children = append(children, childPid)
+		}
+	}
+	return children
+}
+
+// Time to wait for a cancelled command to exit before killing it
+const cancelWaitDelay = 5 * time.Second
@@ -0,0 +1,204 @@
+package system
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
+)
+
+// Container runtimes
+const (
+	RuntimeContainerd = "containerd"
+	RuntimeCrio       = "crio"
+)
+
+// CRI sockets of the container runtimes, passed to kubeadm
+var CriSockets = map[string]string{
+	RuntimeContainerd: "unix:///run/containerd/containerd.sock",
+	RuntimeCrio:       "unix:///var/run/crio/crio.sock",
+}
+
+// Files written for CRI-O
+const (
+	crioConfigPath           = "/etc/crio/crio.conf.d/50-easy-openyurt.conf"
+	crioRegistriesConfigPath = "/etc/containers/registries.conf.d/50-easy-openyurt.conf"
+)
+
+// Get the CRI-O minor version, which follows the Kubernetes minor version by default
+func crioMinorVersion() string {
+	if len(configs.System.CrioVersion) > 0 {
+		return kubeMinorVersion(configs.System.CrioVersion)
+	}
+	return kubeMinorVersion(configs.Kube.K8sVersion)
+}
+
+// Validate the CRI-O version, only packaged on pkgs.k8s.io since CRI-O 1.28
+func ValidateCrioVersion() error {
+	if len(configs.System.CrioVersion) > 0 {
+		if err := ValidateVersion("crio-version", configs.System.CrioVersion); err != nil {
+			return err
+		}
+	}
+	if compareVersions(crioMinorVersion(), "1.28") < 0 {
+		return fmt.Errorf("-crio-version: no CRI-O %s packages (published from 1.28 on), please choose -k8s-version or -crio-version 1.28+", crioMinorVersion())
+	}
+	return nil
+}
+
+// Get the CRI-O package repository of the current OS
+func CrioRepo() *PackageRepo {
+	return pkgsK8sIoRepo("cri-o", fmt.Sprintf(configs.System.CrioRepoUrlTemplate, crioMinorVersion()))
+}
+
+// Load the CRI-O config file (if any) over `configs.Crio`
+func LoadCrioSettings() error {
+	if len(configs.Crio.ConfigFilePath) == 0 {
+		return nil
+	}
+	content, err := os.ReadFile(configs.Crio.ConfigFilePath)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(content, &configs.Crio); err != nil {
+		return fmt.Errorf("invalid CRI-O config %s: %w", configs.Crio.ConfigFilePath, err)
+	}
+	return nil
+}
+
+// Validate registries & mirrors of `configs.Crio`
+func ValidateCrioSettings() error {
+	return validateRegistries(configs.Crio.InsecureRegistries, configs.Crio.RegistryMirrors)
+}
+
+// Get the CRI-O config drop-in (cgroup manager of the node's cgroup driver & pause image)
+func CrioConfig() string {
+	content := "# Generated by easy_openyurt\n[crio.runtime]\n"
+	if configs.System.CgroupDriver == CgroupDriverCgroupfs {
+		content += "  cgroup_manager = \"cgroupfs\"\n  conmon_cgroup = \"pod\"\n"
+	} else {
+		content += "  cgroup_manager = \"systemd\"\n"
+	}
+	pauseImage := configs.Crio.PauseImage
+	if len(pauseImage) == 0 {
+		pauseImage = defaultSandboxImage()
+	}
+	content += fmt.Sprintf("\n[crio.image]\n  pause_image = %s\n", tomlString(pauseImage))
+	return content
+}
+
+// Get the location of a registry mirror (without scheme) & whether it is reached over plain HTTP
+func mirrorLocation(mirror string) (string, bool) {
+	parsedUrl, err := url.Parse(mirror)
+	if err != nil || len(parsedUrl.Host) == 0 {
+		return mirror, false
+	}
+	return parsedUrl.Host + strings.TrimSuffix(parsedUrl.Path, "/"), parsedUrl.Scheme == "http"
+}
+
+// Get the containers-registries.conf drop-in of the configured registries (empty if there is none)
+func CrioRegistriesConfig() string {
+	insecureRegistries := map[string]bool{}
+	for _, registry := range configs.Crio.InsecureRegistries {
+		insecureRegistries[registry] = true
+	}
+	var registries []string
+	for registry := range configs.Crio.RegistryMirrors {
+		if !insecureRegistries[registry] {
+			registries = append(registries, registry)
+		}
+	}
+	for registry := range insecureRegistries {
+		registries = append(registries, registry)
+	}
+	if len(registries) == 0 {
+		return ""
+	}
+	sort.Strings(registries)
+	content := "# Generated by easy_openyurt\n"
+	for _, registry := range registries {
+		content += fmt.Sprintf("\n[[registry]]\n  prefix = %s\n  location = %s\n  insecure = %t\n",
+			tomlString(registry), tomlString(registry), insecureRegistries[registry])
+		for _, mirror := range configs.Crio.RegistryMirrors[registry] {
+			location, insecure := mirrorLocation(mirror)
+			content += fmt.Sprintf("\n  [[registry.mirror]]\n    location = %s\n    insecure = %t\n", tomlString(location), insecure)
+		}
+	}
+	return content
+}
+
+// Write the CRI-O config & registries drop-ins
+// CRI-O has to be restarted by the caller afterwards
+func ConfigureCrio() error {
+	for _, dropIn := range []struct {
+		path    string
+		content string
+	}{
+		{crioConfigPath, CrioConfig()},
+		{crioRegistriesConfigPath, CrioRegistriesConfig()},
+	} {
+		err := RecordFileChange(dropIn.path)
+		if err != nil {
+			return err
+		}
+		if len(dropIn.content) == 0 {
+			_, err = ExecCmd("sudo", "rm", "-f", dropIn.path)
+		} else if _, err = ExecCmd("sudo", "mkdir", "-p", path.Dir(dropIn.path)); err == nil {
+			_, err = ExecCmdWithInput(dropIn.content, "sudo", "tee", dropIn.path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Install CRI-O from the pkgs.k8s.io repository, configure & start it
+func installCrio(packageManager PackageManager) {
+	logs.WaitPrintf("Adding the CRI-O %s repository", packageManager.Name())
+	err := packageManager.AddRepo(CrioRepo())
+	logs.CheckErrorWithTagAndMsg(err, "Failed to add the CRI-O %s repository!\n", packageManager.Name())
+	logs.WaitPrintf("Installing CRI-O(ver %s)", crioMinorVersion())
+	err = RecordComponentChange("cri-o")
+	logs.CheckErrorWithMsg(err, "Failed to install CRI-O(ver %s)!\n", crioMinorVersion())
+	err = packageManager.Install("cri-o")
+	logs.CheckErrorWithTagAndMsg(err, "Failed to install CRI-O(ver %s)!\n", crioMinorVersion())
+	logs.WaitPrintf("Locking CRI-O version")
+	err = packageManager.Hold("cri-o")
+	logs.CheckErrorWithTagAndMsg(err, "Failed to lock CRI-O version!\n")
+
+	logs.WaitPrintf("Configuring CRI-O")
+	err = ConfigureCrio()
+	logs.CheckErrorWithMsg(err, "Failed to configure CRI-O!\n")
+	err = ConfigureServiceProxy("crio")
+	logs.CheckErrorWithTagAndMsg(err, "Failed to configure proxy for CRI-O!\n")
+	logs.WaitPrintf("Starting CRI-O via systemd")
+	_, err = ExecCmd("sudo", "systemctl", "enable", "crio")
+	logs.CheckErrorWithMsg(err, "Failed to start CRI-O via systemd!\n")
+	_, err = ExecCmd("sudo", "systemctl", "restart", "crio")
+	logs.CheckErrorWithTagAndMsg(err, "Failed to start CRI-O via systemd!\n")
+}
+
+// Detect the container runtime from the existing CRI sockets (containerd if there is none)
+func DetectContainerRuntime() (string, error) {
+	var found []string
+	for _, runtime := range []string{RuntimeContainerd, RuntimeCrio} {
+		if _, err := os.Stat(strings.TrimPrefix(CriSockets[runtime], "unix://")); err == nil {
+			found = append(found, runtime)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return RuntimeContainerd, nil
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("several container runtimes found (%s), please choose one with -runtime", strings.Join(found, ", "))
+	}
+}
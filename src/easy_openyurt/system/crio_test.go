@@ -0,0 +1,127 @@
+package system
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+func TestCrioConfig(t *testing.T) {
+	configs.Kube.K8sVersion = "1.29.3"
+	configs.System.CgroupDriver = CgroupDriverSystemd
+	configs.Crio.RegistryMirrors = map[string][]string{"docker.io": {"https://mirror.gcr.io"}}
+	configs.Crio.InsecureRegistries = []string{"localhost:5000"}
+	// containerd settings are not used by CRI-O
+	configs.Containerd.SandboxImage = "registry.example.com/pause:3.9"
+	configs.Containerd.RegistryMirrors = map[string][]string{"ghcr.io": {"https://ghcr.example.com"}}
+	defer func() {
+		configs.Kube.K8sVersion = "1.25.9"
+		configs.System.CgroupDriver, configs.Containerd.SandboxImage, configs.Crio.PauseImage = "", "", ""
+		configs.Crio.RegistryMirrors, configs.Crio.InsecureRegistries = map[string][]string{}, []string{}
+		configs.Containerd.RegistryMirrors = map[string][]string{}
+	}()
+
+	if content := CrioConfig(); !strings.Contains(content, "cgroup_manager = \"systemd\"\n") ||
+		!strings.Contains(content, "pause_image = \"registry.k8s.io/pause:3.9\"\n") {
+		t.Errorf("CrioConfig() = %q", content)
+	}
+	configs.System.CgroupDriver, configs.Crio.PauseImage = CgroupDriverCgroupfs, "registry.example.com/pause:3.10"
+	if content := CrioConfig(); !strings.Contains(content, "cgroup_manager = \"cgroupfs\"\n  conmon_cgroup = \"pod\"\n") ||
+		!strings.Contains(content, "pause_image = \"registry.example.com/pause:3.10\"\n") {
+		t.Errorf("CrioConfig(cgroupfs, pause image) = %q", content)
+	}
+
+	content := CrioRegistriesConfig()
+	if strings.Contains(content, "ghcr.io") {
+		t.Errorf("CrioRegistriesConfig() should not contain the containerd registries:\n%s", content)
+	}
+	for _, want := range []string{
+		"[[registry]]\n  prefix = \"docker.io\"\n  location = \"docker.io\"\n  insecure = false\n\n  [[registry.mirror]]\n    location = \"mirror.gcr.io\"\n    insecure = false\n",
+		"[[registry]]\n  prefix = \"localhost:5000\"\n  location = \"localhost:5000\"\n  insecure = true\n",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("CrioRegistriesConfig() does not contain %q:\n%s", want, content)
+		}
+	}
+	configs.Crio.RegistryMirrors, configs.Crio.InsecureRegistries = map[string][]string{}, []string{}
+	if content := CrioRegistriesConfig(); content != "" {
+		t.Errorf("CrioRegistriesConfig(no registries) = %q, want empty", content)
+	}
+}
+
+func TestValidateCrioVersion(t *testing.T) {
+	defer func() { configs.Kube.K8sVersion = "1.25.9"; configs.System.CrioVersion = "" }()
+	for _, test := range []struct {
+		k8sVersion  string
+		crioVersion string
+		valid       bool
+		repoUrl     string
+	}{
+		{"1.25.9", "", false, ""},
+		{"1.25.9", "1.28.4", true, "https://pkgs.k8s.io/addons:/cri-o:/stable:/v1.28/deb/"},
+		{"1.30.2", "", true, "https://pkgs.k8s.io/addons:/cri-o:/stable:/v1.30/deb/"},
+		{"1.30.2", "1.x", false, ""},
+	} {
+		configs.Kube.K8sVersion, configs.System.CrioVersion = test.k8sVersion, test.crioVersion
+		if err := ValidateCrioVersion(); (err == nil) != test.valid {
+			t.Errorf("ValidateCrioVersion(k8s %s, crio %q) = %v", test.k8sVersion, test.crioVersion, err)
+		}
+		if test.valid {
+			if repo := CrioRepo(); repo.AptUrl != test.repoUrl {
+				t.Errorf("CrioRepo(k8s %s, crio %q).AptUrl = %s, want %s", test.k8sVersion, test.crioVersion, repo.AptUrl, test.repoUrl)
+			}
+		}
+	}
+}
+
+func TestSystemInitWithCrio(t *testing.T) {
+	fakeRunner := useFakeSystemInit(t)
+	configs.System.ContainerRuntime = RuntimeCrio
+	configs.Kube.K8sVersion = "1.29.3"
+
+	SystemInit()
+
+	for _, pattern := range []string{
+		"https://pkgs.k8s.io/addons:/cri-o:/stable:/v1.29/deb/",
+		"sudo apt-mark hold cri-o",
+		"sudo tee " + crioConfigPath,
+		"sudo rm -f " + crioRegistriesConfigPath,
+		"sudo systemctl restart crio",
+	} {
+		if !fakeRunner.Executed(pattern) {
+			t.Errorf("SystemInit(-runtime=crio) did not execute %q\n%v", pattern, fakeRunner)
+		}
+	}
+	for _, pattern := range []string{"containerd-", "/usr/local/sbin/runc", "sudo systemctl restart containerd"} {
+		if fakeRunner.Executed(pattern) {
+			t.Errorf("SystemInit(-runtime=crio) should not execute %q\n%v", pattern, fakeRunner)
+		}
+	}
+	if fakeRunner.Index("sudo modprobe br_netfilter") > fakeRunner.Index("sudo systemctl restart crio") {
+		t.Errorf("SystemInit(-runtime=crio) started CRI-O before loading br_netfilter\n%v", fakeRunner)
+	}
+}
+
+func TestDetectContainerRuntime(t *testing.T) {
+	socketDir := t.TempDir()
+	previousSockets := CriSockets
+	CriSockets = map[string]string{
+		RuntimeContainerd: "unix://" + socketDir + "/containerd.sock",
+		RuntimeCrio:       "unix://" + socketDir + "/crio.sock",
+	}
+	defer func() { CriSockets = previousSockets }()
+
+	if runtime, err := DetectContainerRuntime(); err != nil || runtime != RuntimeContainerd {
+		t.Errorf("DetectContainerRuntime(no socket) = %s, %v", runtime, err)
+	}
+	os.WriteFile(socketDir+"/crio.sock", nil, 0644)
+	if runtime, err := DetectContainerRuntime(); err != nil || runtime != RuntimeCrio {
+		t.Errorf("DetectContainerRuntime(crio.sock) = %s, %v", runtime, err)
+	}
+	os.WriteFile(socketDir+"/containerd.sock", nil, 0644)
+	if _, err := DetectContainerRuntime(); err == nil {
+		t.Errorf("DetectContainerRuntime(both sockets) should fail")
+	}
+}
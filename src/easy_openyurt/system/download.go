@@ -0,0 +1,379 @@
+package system
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
+)
+
+// File to be downloaded by a Downloader
+type Download struct {
+	Url       string
+	FilePath  string
+	Sha256    string     // Expected SHA256 sum (optional)
+	Sha256Url string     // Published checksum file, only used when Sha256 is empty (optional)
+	Signature *Signature // Upstream signature verified after downloading (optional)
+}
+
+// Runner which can download files by itself
+// Downloads are rendered as equivalent `curl` & `sha256sum` commands for runners which can not (e.g. in dry-run mode)
+type Downloader interface {
+	Download(ctx context.Context, download *Download) error
+}
+
+// Delay before the first retry of a failed download, doubled on every further retry
+var downloadRetryInterval = 2 * time.Second
+
+var sha256Regexp = regexp.MustCompile(`^[a-fA-F0-9]{64}$`)
+
+// Error which retrying can not fix (e.g. 404 Not Found)
+type permanentDownloadError struct {
+	err error
+}
+
+func (e *permanentDownloadError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentDownloadError) Unwrap() error {
+	return e.err
+}
+
+// Download file to temporary directory (absolute path of downloaded file will be the first return value if successful)
+// The file is verified against the SHA256 sum pinned in configs (if any)
+func DownloadToTmpDir(urlTemplate string, pars ...any) (string, error) {
+	return DownloadToTmpDirWithChecksum("", urlTemplate, pars...)
+}
+
+// Download file to temporary directory, verifying it against the SHA256 sum pinned in configs, or the one published at checksumUrl
+func DownloadToTmpDirWithChecksum(checksumUrl string, urlTemplate string, pars ...any) (string, error) {
+	return DownloadToTmpDirWithSignature(nil, checksumUrl, urlTemplate, pars...)
+}
+
+// Download file to temporary directory, verifying its SHA256 sum (like `DownloadToTmpDirWithChecksum()`) and its upstream signature
+func DownloadToTmpDirWithSignature(signature *Signature, checksumUrl string, urlTemplate string, pars ...any) (string, error) {
+	url := fmt.Sprintf(urlTemplate, pars...)
+	fileName := path.Base(url)
+	download := &Download{
+		Url:       url,
+		FilePath:  configs.System.TmpDir + "/" + fileName,
+		Sha256:    configs.System.ArtifactSha256[fileName],
+		Sha256Url: checksumUrl,
+		Signature: signature,
+	}
+	return download.FilePath, runDownload(download)
+}
+
+// Download with the current runner under a step context, then verify the signature (if any) and record how the file was verified
+// Downloads are only added to the cache once fully verified
+func runDownload(download *Download) error {
+	checksumMethod, cacheable, err := fetchDownload(download)
+	if err != nil {
+		return err
+	}
+	methods := []string{}
+	if len(checksumMethod) > 0 {
+		methods = append(methods, checksumMethod)
+	}
+	if download.Signature != nil {
+		if !configs.System.VerifySignatures {
+			methods = append(methods, download.Signature.Kind+" signature skipped")
+		} else if err := verifySignature(download); err != nil {
+			ExecCmd("rm", "-f", download.FilePath)
+			return fmt.Errorf("failed to verify signature of %s: %w", download.Url, err)
+		} else {
+			methods = append(methods, download.Signature.Method())
+		}
+	}
+	if cacheable {
+		if err := addToCache(download); err != nil {
+			logs.WarnPrintf("Failed to add %s to the artifact cache: %v\n", download.Url, err)
+		}
+	}
+	recordVerification(download.Url, methods)
+	return nil
+}
+
+// Get the file with the current runner under a step context, and return how its SHA256 sum was verified ("" if it was not)
+// and whether it may be cached once its signature (if any) is verified too
+// The bundled or cached copy is used if there is one
+func fetchDownload(download *Download) (string, bool, error) {
+	if IsBundleMode() {
+		bundledFilePath, err := bundledFile(download.Url)
+		if err != nil {
+			return "", false, err
+		}
+		_, err = ExecCmd("cp", bundledFilePath, download.FilePath)
+		return "sha256 (bundle)", false, err
+	}
+	ctx, cancel := StepContext()
+	defer cancel()
+	downloader, isDownloader := currentRunner.(Downloader)
+	checksumMethod, cacheMethod := "", "sha256 (cache)"
+	if len(download.Sha256) > 0 {
+		checksumMethod = "sha256 (pinned)"
+	} else if len(download.Sha256Url) > 0 {
+		checksumMethod, cacheMethod = "sha256 (published)", "sha256 (published, cache)"
+		// The cache is looked up by the published sum, so that the URLs of the cache index are never trusted
+		if isDownloader {
+			sum, err := fetchSha256(ctx, MirrorUrl(download.Sha256Url), path.Base(download.Url))
+			if err != nil {
+				return "", false, err
+			}
+			download.Sha256 = sum
+		}
+	}
+	if cachedFilePath := lookUpCache(download); len(cachedFilePath) > 0 {
+		if logs.CommonLog != nil {
+			logs.CommonLog.Printf("Using cached %s for %s\n", cachedFilePath, download.Url)
+		}
+		_, err := ExecCmd("cp", cachedFilePath, download.FilePath)
+		return cacheMethod, false, err
+	}
+	if isDownloader {
+		err := downloader.Download(ctx, download)
+		// Only verified artifacts are cached, files behind mutable URLs must be downloaded again
+		return checksumMethod, err == nil && len(checksumMethod) > 0, err
+	}
+	for _, command := range download.Commands() {
+		if _, err := currentRunner.Run(ctx, command); err != nil {
+			return "", false, err
+		}
+	}
+	return checksumMethod, false, nil
+}
+
+// Render download as shell commands
+func (download *Download) Commands() []*Command {
+	commands := []*Command{{Args: []string{
+		"curl", "-fsSL", "--retry", fmt.Sprint(configs.System.DownloadRetries), "--continue-at", "-", "--output", download.FilePath, MirrorUrl(download.Url)}}}
+	fileName := path.Base(download.Url)
+	if len(download.Sha256) > 0 {
+		commands = append(commands, &Command{
+			Args:  []string{"sha256sum", "--check", "--strict", "-"},
+			Stdin: fmt.Sprintf("%s  %s\n", download.Sha256, download.FilePath)})
+	} else if len(download.Sha256Url) > 0 {
+		commands = append(commands, &Command{Shell: fmt.Sprintf(
+			`echo "$(curl -fsSL %s | awk %s | head -n 1)  "%s | sha256sum --check --strict -`,
+			ShellQuote(MirrorUrl(download.Sha256Url)),
+			ShellQuote(fmt.Sprintf(`NF == 1 || $2 == "%s" || $2 == "*%s" { print $1 }`, fileName, fileName)),
+			ShellQuote(download.FilePath))})
+	}
+	return commands
+}
+
+// Download with net/http: partial files are resumed, transient errors are retried and the SHA256 sum is verified
+func (runner *LocalRunner) Download(ctx context.Context, download *Download) error {
+	if logs.CommonLog != nil {
+		logs.CommonLog.Printf("Downloading %s to %s\n", download.Url, download.FilePath)
+	}
+	expectedSha256 := strings.ToLower(download.Sha256)
+	if len(expectedSha256) == 0 && len(download.Sha256Url) > 0 {
+		var err error
+		expectedSha256, err = fetchSha256(ctx, MirrorUrl(download.Sha256Url), path.Base(download.Url))
+		if err != nil {
+			return err
+		}
+	}
+	if len(expectedSha256) > 0 && !sha256Regexp.MatchString(expectedSha256) {
+		return fmt.Errorf("invalid SHA256 sum %q for %s", expectedSha256, download.Url)
+	}
+
+	url := MirrorUrl(download.Url)
+	partialFilePath := download.FilePath + ".part"
+	err := retryDownload(ctx, url, func() error {
+		resumed, err := downloadOnce(ctx, url, partialFilePath)
+		if err != nil {
+			return err
+		}
+		actualSha256, err := FileSha256(partialFilePath)
+		if err != nil {
+			return &permanentDownloadError{err}
+		}
+		if len(expectedSha256) > 0 && actualSha256 != expectedSha256 {
+			os.Remove(partialFilePath)
+			err = fmt.Errorf("checksum mismatch: expected sha256 %s, got %s", expectedSha256, actualSha256)
+			if !resumed {
+				return &permanentDownloadError{err}
+			}
+			// Possibly corrupted by resuming, start over
+			return err
+		}
+		if logs.CommonLog != nil {
+			logs.CommonLog.Printf("Downloaded %s (sha256 %s)\n", download.Url, actualSha256)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return os.Rename(partialFilePath, download.FilePath)
+}
+
+// Call attempt until it succeeds, fails permanently, or the retries configured are used up
+func retryDownload(ctx context.Context, url string, attempt func() error) error {
+	interval := downloadRetryInterval
+	var err error
+	for i := 0; i <= configs.System.DownloadRetries; i++ {
+		if i > 0 {
+			if logs.ErrorLog != nil {
+				logs.ErrorLog.Printf("Failed to download %s: %v, retrying in %v\n", url, err, interval)
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("failed to download %s: %w (last error: %v)", url, ctx.Err(), err)
+			case <-time.After(interval):
+			}
+			interval *= 2
+		}
+		err = attempt()
+		var permanentError *permanentDownloadError
+		if err == nil {
+			return nil
+		} else if errors.As(err, &permanentError) || ctx.Err() != nil {
+			return fmt.Errorf("failed to download %s: %w", url, err)
+		}
+	}
+	return fmt.Errorf("failed to download %s after %d attempts: %w", url, configs.System.DownloadRetries+1, err)
+}
+
+// Download url to filePath once, resuming from the end of filePath if it already exists
+// Return whether the download was resumed
+func downloadOnce(ctx context.Context, url string, filePath string) (bool, error) {
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return false, &permanentDownloadError{err}
+	}
+	defer file.Close()
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, &permanentDownloadError{err}
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, &permanentDownloadError{err}
+	}
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusPartialContent && offset > 0:
+		if !strings.HasPrefix(response.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			if err := file.Truncate(0); err != nil {
+				return false, &permanentDownloadError{err}
+			}
+			return false, fmt.Errorf("unexpected Content-Range %q when resuming at byte %d", response.Header.Get("Content-Range"), offset)
+		}
+	case response.StatusCode == http.StatusOK:
+		// Server ignored the range (or nothing to resume), start over
+		if err := file.Truncate(0); err != nil {
+			return false, &permanentDownloadError{err}
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return false, &permanentDownloadError{err}
+		}
+	case response.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// Partial file is already complete (or larger than the remote file), drop it so that the next attempt starts over
+		if err := file.Truncate(0); err != nil {
+			return false, &permanentDownloadError{err}
+		}
+		return false, fmt.Errorf("server rejected resuming at byte %d", offset)
+	default:
+		err := fmt.Errorf("server responded %s", response.Status)
+		if response.StatusCode >= 400 && response.StatusCode < 500 && response.StatusCode != http.StatusRequestTimeout && response.StatusCode != http.StatusTooManyRequests {
+			return false, &permanentDownloadError{err}
+		}
+		return false, err
+	}
+
+	written, err := io.Copy(file, response.Body)
+	if err != nil {
+		return false, fmt.Errorf("connection lost after %d bytes: %w", offset+written, err)
+	}
+	if response.ContentLength >= 0 && written != response.ContentLength {
+		return false, fmt.Errorf("truncated response: got %d of %d bytes", written, response.ContentLength)
+	}
+	return response.StatusCode == http.StatusPartialContent, nil
+}
+
+// Fetch the SHA256 sum of fileName from a published checksum file
+// Both plain sums (`<sum>`) and sha256sum output (`<sum>  <file name>`) are accepted
+func fetchSha256(ctx context.Context, checksumUrl string, fileName string) (string, error) {
+	var sum string
+	err := retryDownload(ctx, checksumUrl, func() error {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, checksumUrl, nil)
+		if err != nil {
+			return &permanentDownloadError{err}
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			err := fmt.Errorf("server responded %s", response.Status)
+			if response.StatusCode >= 400 && response.StatusCode < 500 {
+				return &permanentDownloadError{err}
+			}
+			return err
+		}
+		sum, err = parseChecksumFile(io.LimitReader(response.Body, 1<<20), fileName)
+		if err != nil {
+			return &permanentDownloadError{err}
+		}
+		return nil
+	})
+	return sum, err
+}
+
+// Find the SHA256 sum of fileName in the content of a checksum file
+func parseChecksumFile(reader io.Reader, fileName string) (string, error) {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || !sha256Regexp.MatchString(fields[0]) {
+			continue
+		}
+		if len(fields) == 1 || path.Base(strings.TrimPrefix(fields[1], "*")) == fileName {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no SHA256 sum for %s in checksum file", fileName)
+}
+
+// Calculate the SHA256 sum of a file
+func FileSha256(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
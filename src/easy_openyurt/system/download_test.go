@@ -0,0 +1,177 @@
+package system
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+func TestDownloadVerifiesChecksum(t *testing.T) {
+	content := bytes.Repeat([]byte("containerd"), 1000)
+	sum := sha256.Sum256(content)
+	contentSha256 := hex.EncodeToString(sum[:])
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containerd.tar.gz":
+			requests.Add(1)
+			w.Write(content)
+		case "/containerd.tar.gz.sha256sum":
+			fmt.Fprintf(w, "%s  other.tar.gz\n%s *containerd.tar.gz\n", strings.Repeat("0", 64), contentSha256)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	runner := &LocalRunner{}
+	tmpDir := t.TempDir()
+
+	// Pinned sum
+	download := &Download{Url: server.URL + "/containerd.tar.gz", FilePath: tmpDir + "/pinned.tar.gz", Sha256: strings.ToUpper(contentSha256)}
+	if err := runner.Download(context.Background(), download); err != nil {
+		t.Fatalf("Download(pinned sum) error = %v", err)
+	}
+	if downloaded, _ := os.ReadFile(download.FilePath); !bytes.Equal(downloaded, content) {
+		t.Errorf("Download(pinned sum) wrote %d bytes, want %d", len(downloaded), len(content))
+	}
+	if _, err := os.Stat(download.FilePath + ".part"); !os.IsNotExist(err) {
+		t.Errorf("Download() should not leave the partial file behind")
+	}
+
+	// Published checksum file
+	download = &Download{Url: server.URL + "/containerd.tar.gz", FilePath: tmpDir + "/published.tar.gz", Sha256Url: server.URL + "/containerd.tar.gz.sha256sum"}
+	if err := runner.Download(context.Background(), download); err != nil {
+		t.Fatalf("Download(published sum) error = %v", err)
+	}
+
+	// Mismatch of a fresh download is not retried
+	requests.Store(0)
+	download = &Download{Url: server.URL + "/containerd.tar.gz", FilePath: tmpDir + "/corrupted.tar.gz", Sha256: strings.Repeat("0", 64)}
+	err := runner.Download(context.Background(), download)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Download(wrong sum) error = %v, want checksum mismatch", err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Download(wrong sum) sent %d requests, want 1", requests.Load())
+	}
+	if _, err := os.Stat(download.FilePath); !os.IsNotExist(err) {
+		t.Errorf("Download(wrong sum) should not leave a file behind")
+	}
+
+	// Checksum file without the artifact
+	download = &Download{Url: server.URL + "/containerd.tar.gz", FilePath: tmpDir + "/unlisted.tar.gz", Sha256Url: server.URL + "/missing.sha256"}
+	if err := runner.Download(context.Background(), download); err == nil {
+		t.Errorf("Download(missing checksum file) should fail")
+	}
+}
+
+func TestDownloadResumesAndRetries(t *testing.T) {
+	defer func(interval time.Duration) { downloadRetryInterval = interval }(downloadRetryInterval)
+	downloadRetryInterval = time.Millisecond
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	sum := sha256.Sum256(content)
+	var requests atomic.Int32
+	var rangeHeader atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch requests.Add(1) {
+		case 1:
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		case 2:
+			// Drop the connection half way
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			w.Write(content[:len(content)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		default:
+			rangeHeader.Store(r.Header.Get("Range"))
+			http.ServeContent(w, r, "go.tar.gz", time.Time{}, bytes.NewReader(content))
+		}
+	}))
+	defer server.Close()
+
+	download := &Download{Url: server.URL + "/go.tar.gz", FilePath: t.TempDir() + "/go.tar.gz", Sha256: hex.EncodeToString(sum[:])}
+	if err := (&LocalRunner{}).Download(context.Background(), download); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if requests.Load() != 3 {
+		t.Errorf("Download() sent %d requests, want 3", requests.Load())
+	}
+	if want := fmt.Sprintf("bytes=%d-", len(content)/2); rangeHeader.Load() != want {
+		t.Errorf("Download() resumed with Range %q, want %q", rangeHeader.Load(), want)
+	}
+	if downloaded, _ := os.ReadFile(download.FilePath); !bytes.Equal(downloaded, content) {
+		t.Errorf("Download() wrote %d bytes, want %d", len(downloaded), len(content))
+	}
+
+	// A partial file the server refuses to resume (416) is downloaded again from the start
+	requests.Store(0)
+	rangeHeaders := []string{}
+	rangeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		rangeHeaders = append(rangeHeaders, r.Header.Get("Range"))
+		http.ServeContent(w, r, "go.tar.gz", time.Time{}, bytes.NewReader(content))
+	}))
+	defer rangeServer.Close()
+	download = &Download{Url: rangeServer.URL + "/go.tar.gz", FilePath: t.TempDir() + "/go.tar.gz", Sha256: hex.EncodeToString(sum[:])}
+	os.WriteFile(download.FilePath+".part", bytes.Repeat([]byte("x"), len(content)+10), 0644)
+	if err := (&LocalRunner{}).Download(context.Background(), download); err != nil {
+		t.Fatalf("Download(416) error = %v", err)
+	}
+	if want := []string{fmt.Sprintf("bytes=%d-", len(content)+10), ""}; requests.Load() != 2 || fmt.Sprint(rangeHeaders) != fmt.Sprint(want) {
+		t.Errorf("Download(416) sent %d requests with Range %q, want %q", requests.Load(), rangeHeaders, want)
+	}
+	if downloaded, _ := os.ReadFile(download.FilePath); !bytes.Equal(downloaded, content) {
+		t.Errorf("Download(416) wrote %d bytes, want %d", len(downloaded), len(content))
+	}
+
+	// Permanent errors are not retried
+	requests.Store(0)
+	notFound := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer notFound.Close()
+	err := (&LocalRunner{}).Download(context.Background(), &Download{Url: notFound.URL + "/runc.amd64", FilePath: t.TempDir() + "/runc.amd64"})
+	if err == nil || !strings.Contains(err.Error(), "404") || requests.Load() != 1 {
+		t.Errorf("Download(404) error = %v after %d requests, want one 404", err, requests.Load())
+	}
+}
+
+func TestDownloadToTmpDirWithFakeRunner(t *testing.T) {
+	fakeRunner := useFakeRunner(t)
+	configs.System.TmpDir = "/tmp/easy_openyurt-test"
+	configs.System.ArtifactSha256["runc.amd64"] = strings.Repeat("a", 64)
+	defer func() {
+		configs.System.TmpDir = ""
+		delete(configs.System.ArtifactSha256, "runc.amd64")
+	}()
+
+	filePath, err := DownloadToTmpDirWithChecksum("https://example.com/runc.sha256sum", "https://example.com/v%s/runc.%s", "1.1.4", "amd64")
+	if err != nil || filePath != "/tmp/easy_openyurt-test/runc.amd64" {
+		t.Fatalf("DownloadToTmpDirWithChecksum() = %q, %v", filePath, err)
+	}
+	for _, pattern := range []string{
+		"curl -fsSL --retry 3 --continue-at - --output /tmp/easy_openyurt-test/runc.amd64 https://example.com/v1.1.4/runc.amd64",
+		"sha256sum --check --strict - <<'EASY_OPENYURT_EOF'\n" + strings.Repeat("a", 64) + "  /tmp/easy_openyurt-test/runc.amd64\n",
+	} {
+		if !fakeRunner.Executed(pattern) {
+			t.Errorf("DownloadToTmpDirWithChecksum() did not execute %q\n%v", pattern, fakeRunner)
+		}
+	}
+
+	_, err = DownloadToTmpDirWithChecksum("https://example.com/cni.tgz.sha256", "https://example.com/cni.tgz")
+	if err != nil || !fakeRunner.Executed("curl -fsSL https://example.com/cni.tgz.sha256 | awk") {
+		t.Errorf("DownloadToTmpDirWithChecksum() should verify against the published checksum file\n%v", fakeRunner)
+	}
+}
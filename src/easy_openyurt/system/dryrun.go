@@ -0,0 +1,100 @@
+package system
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
+)
+
+// Runner for dry-run mode: prints every command as an ordered plan (and optionally writes it as a shell script) without executing anything
+type DryRunRunner struct {
+	Commands []string // Planned commands in order
+	Files    []string // Planned file writes in order
+	lastStep string
+	script   *os.File
+	mutex    sync.Mutex
+}
+
+// Create a DryRunRunner, the plan will also be written to scriptPath as a shell script if scriptPath is not empty
+func NewDryRunRunner(scriptPath string) (*DryRunRunner, error) {
+	runner := &DryRunRunner{}
+	if len(scriptPath) == 0 {
+		return runner, nil
+	}
+	script, err := os.OpenFile(scriptPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return nil, err
+	}
+	runner.script = script
+	fmt.Fprintf(script, "#!/bin/bash\n# Generated by EasyOpenYurt %s in dry-run mode: %s\n", configs.Version, strings.Join(os.Args, " "))
+	fmt.Fprintf(script, "# Review carefully before running, errors are NOT checked!\n")
+	return runner, nil
+}
+
+// Write a comment header for the current step to the script when it changes
+func (runner *DryRunRunner) announceStep() {
+	step := logs.CurrentStep()
+	if step == runner.lastStep {
+		return
+	}
+	runner.lastStep = step
+	if runner.script != nil {
+		fmt.Fprintf(runner.script, "\n# %s\n", step)
+	}
+}
+
+func (runner *DryRunRunner) Run(ctx context.Context, command *Command) (string, error) {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	runner.announceStep()
+	cmd := command.String()
+	runner.Commands = append(runner.Commands, cmd)
+	logs.PlanPrintf("#%d $ %s\n", len(runner.Commands), cmd)
+	if runner.script != nil {
+		fmt.Fprintf(runner.script, "%s\n", cmd)
+	}
+	return "", nil
+}
+
+// Plan writing content to filePath
+func (runner *DryRunRunner) WriteFile(filePath string, content []byte) {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	runner.announceStep()
+	runner.Files = append(runner.Files, filePath)
+	logs.PlanPrintf("Write file %s (%d bytes)\n", filePath, len(content))
+	if runner.script != nil {
+		fmt.Fprintf(runner.script, "cat > %s <<'EASY_OPENYURT_EOF'\n%s\nEASY_OPENYURT_EOF\n", filePath, content)
+	}
+}
+
+// Print the summary of the plan and close the script file
+func (runner *DryRunRunner) Close() error {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	logs.InfoPrintf("Dry run finished: %d commands and %d file writes planned, nothing was executed\n", len(runner.Commands), len(runner.Files))
+	if runner.script == nil {
+		return nil
+	}
+	logs.InfoPrintf("Plan script -> %s\n", runner.script.Name())
+	return runner.script.Close()
+}
+
+// Check whether dry-run mode is enabled
+func IsDryRun() bool {
+	return configs.System.DryRun
+}
+
+// Write content to filePath, or only plan it in dry-run mode
+func WriteFile(filePath string, content []byte, perm os.FileMode) error {
+	if dryRunRunner, ok := currentRunner.(*DryRunRunner); ok {
+		dryRunRunner.WriteFile(filePath, content)
+		return nil
+	}
+	return os.WriteFile(filePath, content, perm)
+}
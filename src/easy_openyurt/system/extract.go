@@ -0,0 +1,440 @@
+package system
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
+)
+
+// Archive to be extracted by an Extractor
+type Extraction struct {
+	FilePath        string // .tar, .tar.gz, .tar.xz or .zip (detected by content)
+	DirPath         string
+	StripComponents int  // Leading path components removed from every entry (like `tar --strip-components`)
+	Privileged      bool // DirPath is only writable by root
+}
+
+// Runner which can extract archives by itself
+// Extractions are rendered as equivalent `tar` / `unzip` commands for runners which can not (e.g. in dry-run mode)
+type Extractor interface {
+	Extract(ctx context.Context, extraction *Extraction) error
+}
+
+// Supported archive formats
+const (
+	archiveTar   = "tar"
+	archiveGzip  = "gzip"
+	archiveXz    = "xz"
+	archiveZip   = "zip"
+	magicLength  = 6
+	xzExecutable = "xz" // The standard library has no xz decompressor (and no third-party module is used), so .tar.xz needs the xz executable
+)
+
+// Extract archive file to specific directory
+func ExtractToDir(filePath string, dirPath string, privileged bool) error {
+	return ExtractArchive(&Extraction{FilePath: filePath, DirPath: dirPath, Privileged: privileged})
+}
+
+// Extract archive with the current runner under a step context
+func ExtractArchive(extraction *Extraction) error {
+	ctx, cancel := StepContext()
+	defer cancel()
+	if extractor, ok := currentRunner.(Extractor); ok {
+		return extractor.Extract(ctx, extraction)
+	}
+	commands, err := extraction.Commands()
+	if err != nil {
+		return err
+	}
+	for _, command := range commands {
+		if _, err := currentRunner.Run(ctx, command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Render extraction as shell commands
+func (extraction *Extraction) Commands() ([]*Command, error) {
+	var prefix []string
+	if extraction.Privileged {
+		prefix = []string{"sudo"}
+	}
+	commands := []*Command{{Args: append(prefix, "mkdir", "-p", extraction.DirPath)}}
+	if strings.HasSuffix(extraction.FilePath, ".zip") {
+		if extraction.StripComponents > 0 {
+			return nil, fmt.Errorf("stripping path components of zip archive %s is not supported without a local runner", extraction.FilePath)
+		}
+		return append(commands, &Command{Args: append(prefix, "unzip", "-o", "-q", extraction.FilePath, "-d", extraction.DirPath)}), nil
+	}
+	args := append(prefix, "tar", "-x", "--no-same-owner", "-f", extraction.FilePath, "-C", extraction.DirPath)
+	if extraction.StripComponents > 0 {
+		args = append(args, fmt.Sprintf("--strip-components=%d", extraction.StripComponents))
+	}
+	return append(commands, &Command{Args: args}), nil
+}
+
+// Extract archive natively
+// Privileged extractions are staged in a temporary directory first, and then copied into place by `installTree()`
+func (runner *LocalRunner) Extract(ctx context.Context, extraction *Extraction) error {
+	if logs.CommonLog != nil {
+		logs.CommonLog.Printf("Extracting %s to %s\n", extraction.FilePath, extraction.DirPath)
+	}
+	if !extraction.Privileged {
+		return extractArchive(ctx, extraction.FilePath, extraction.DirPath, extraction.StripComponents)
+	}
+	stagingDir, err := os.MkdirTemp("", "easy_openyurt_extract")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stagingDir)
+	if err := extractArchive(ctx, extraction.FilePath, stagingDir, extraction.StripComponents); err != nil {
+		return err
+	}
+	return runner.installTree(ctx, stagingDir, extraction.DirPath)
+}
+
+// Copy the content of srcDir into the root-owned dstDir, keeping file modes
+// This is the only place where extracted files are written with root privileges
+func (runner *LocalRunner) installTree(ctx context.Context, srcDir string, dstDir string) error {
+	if _, err := runner.Run(ctx, &Command{Args: []string{"sudo", "mkdir", "-p", dstDir}}); err != nil {
+		return err
+	}
+	_, err := runner.Run(ctx, &Command{Args: []string{"sudo", "cp", "-R", "--no-dereference", "--preserve=mode,timestamps,links", srcDir + "/.", dstDir}})
+	return err
+}
+
+// Detect archive format by magic number
+func detectArchiveFormat(magic []byte) string {
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return archiveGzip
+	case bytes.HasPrefix(magic, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return archiveXz
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		return archiveZip
+	default:
+		return archiveTar
+	}
+}
+
+// Extract archive to dirPath, rejecting entries (and links) which escape dirPath
+func extractArchive(ctx context.Context, filePath string, dirPath string, stripComponents int) error {
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		return err
+	}
+	archiveFile, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer archiveFile.Close()
+	bufferedReader := bufio.NewReader(archiveFile)
+	magic, _ := bufferedReader.Peek(magicLength)
+	extractor, err := newArchiveExtractor(dirPath, stripComponents)
+	if err != nil {
+		return err
+	}
+
+	switch detectArchiveFormat(magic) {
+	case archiveZip:
+		return extractor.extractZip(filePath)
+	case archiveGzip:
+		gzipReader, err := gzip.NewReader(bufferedReader)
+		if err != nil {
+			return fmt.Errorf("failed to extract %s: %w", filePath, err)
+		}
+		defer gzipReader.Close()
+		return extractor.extractTar(tar.NewReader(gzipReader), filePath)
+	case archiveXz:
+		xzCmd := exec.CommandContext(ctx, xzExecutable, "--decompress", "--stdout")
+		xzCmd.Stdin = bufferedReader
+		stderr := new(bytes.Buffer)
+		xzCmd.Stderr = stderr
+		xzStdout, err := xzCmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err := xzCmd.Start(); err != nil {
+			return fmt.Errorf("failed to extract %s: %w (xz archives need the %s executable)", filePath, err, xzExecutable)
+		}
+		extractErr := extractor.extractTar(tar.NewReader(xzStdout), filePath)
+		// Drain the rest of the stream, so that xz is not blocked on a full pipe
+		io.Copy(io.Discard, xzStdout)
+		if err := xzCmd.Wait(); err != nil && extractErr == nil {
+			extractErr = fmt.Errorf("failed to extract %s: %w: %s", filePath, err, strings.TrimSpace(stderr.String()))
+		}
+		return extractErr
+	default:
+		return extractor.extractTar(tar.NewReader(bufferedReader), filePath)
+	}
+}
+
+// Writes archive entries below a directory
+type archiveExtractor struct {
+	dirPath         string // Resolved absolute path of the target directory
+	stripComponents int
+}
+
+func newArchiveExtractor(dirPath string, stripComponents int) (*archiveExtractor, error) {
+	resolvedDirPath, err := filepath.EvalSymlinks(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	resolvedDirPath, err = filepath.Abs(resolvedDirPath)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveExtractor{dirPath: resolvedDirPath, stripComponents: stripComponents}, nil
+}
+
+func (extractor *archiveExtractor) extractTar(tarReader *tar.Reader, filePath string) error {
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to extract %s: %w", filePath, err)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = extractor.writeDir(header.Name, header.FileInfo().Mode())
+		case tar.TypeReg, tar.TypeRegA:
+			err = extractor.writeFile(header.Name, header.FileInfo().Mode(), tarReader)
+		case tar.TypeSymlink:
+			err = extractor.writeSymlink(header.Name, header.Linkname)
+		case tar.TypeLink:
+			err = extractor.writeHardLink(header.Name, header.Linkname)
+		case tar.TypeXGlobalHeader:
+			continue
+		default:
+			err = fmt.Errorf("unsupported entry type %q", header.Typeflag)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to extract %s: entry %q: %w", filePath, header.Name, err)
+		}
+	}
+}
+
+func (extractor *archiveExtractor) extractZip(filePath string) error {
+	zipReader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", filePath, err)
+	}
+	defer zipReader.Close()
+	for _, zipFile := range zipReader.File {
+		mode := zipFile.Mode()
+		switch {
+		case mode.IsDir():
+			err = extractor.writeDir(zipFile.Name, mode)
+		case mode&fs.ModeSymlink != 0:
+			var linkname []byte
+			linkname, err = readZipFile(zipFile)
+			if err == nil {
+				err = extractor.writeSymlink(zipFile.Name, string(linkname))
+			}
+		case mode.IsRegular():
+			var reader io.ReadCloser
+			reader, err = zipFile.Open()
+			if err == nil {
+				err = extractor.writeFile(zipFile.Name, mode, reader)
+				reader.Close()
+			}
+		default:
+			err = fmt.Errorf("unsupported entry mode %v", mode)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to extract %s: entry %q: %w", filePath, zipFile.Name, err)
+		}
+	}
+	return nil
+}
+
+func readZipFile(zipFile *zip.File) ([]byte, error) {
+	reader, err := zipFile.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// Get the target path of an entry, or "" if the entry is removed by stripping
+func (extractor *archiveExtractor) targetPath(name string) (string, error) {
+	cleanName := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if path.IsAbs(cleanName) || cleanName == ".." || strings.HasPrefix(cleanName, "../") {
+		return "", fmt.Errorf("path escapes the target directory")
+	}
+	if cleanName == "." {
+		return "", nil
+	}
+	components := strings.Split(cleanName, "/")
+	if len(components) <= extractor.stripComponents {
+		return "", nil
+	}
+	return filepath.Join(extractor.dirPath, filepath.FromSlash(strings.Join(components[extractor.stripComponents:], "/"))), nil
+}
+
+// Whether path is the target directory or below it
+func (extractor *archiveExtractor) contains(targetPath string) bool {
+	return targetPath == extractor.dirPath || strings.HasPrefix(targetPath, extractor.dirPath+string(os.PathSeparator))
+}
+
+// Create the parent directories of targetPath, and make sure they do not lead outside through symlinks
+// Return the resolved parent directory
+func (extractor *archiveExtractor) prepareParent(targetPath string) (string, error) {
+	parentDir := filepath.Dir(targetPath)
+	if err := os.MkdirAll(parentDir, 0755); err != nil {
+		return "", err
+	}
+	resolvedParentDir, err := filepath.EvalSymlinks(parentDir)
+	if err != nil {
+		return "", err
+	}
+	if !extractor.contains(resolvedParentDir) {
+		return "", fmt.Errorf("path escapes the target directory through a symlink")
+	}
+	// Never write through an existing symlink
+	targetPath = filepath.Join(resolvedParentDir, filepath.Base(targetPath))
+	if info, err := os.Lstat(targetPath); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		if err := os.Remove(targetPath); err != nil {
+			return "", err
+		}
+	}
+	return resolvedParentDir, nil
+}
+
+func (extractor *archiveExtractor) writeDir(name string, mode fs.FileMode) error {
+	targetPath, err := extractor.targetPath(name)
+	if err != nil || len(targetPath) == 0 {
+		return err
+	}
+	parentDir, err := extractor.prepareParent(targetPath)
+	if err != nil {
+		return err
+	}
+	targetPath = filepath.Join(parentDir, filepath.Base(targetPath))
+	if err := os.MkdirAll(targetPath, 0755); err != nil {
+		return err
+	}
+	// Keep directories writable by the owner, so that their entries can be extracted
+	return os.Chmod(targetPath, mode.Perm()|0700)
+}
+
+func (extractor *archiveExtractor) writeFile(name string, mode fs.FileMode, reader io.Reader) error {
+	targetPath, err := extractor.targetPath(name)
+	if err != nil || len(targetPath) == 0 {
+		return err
+	}
+	parentDir, err := extractor.prepareParent(targetPath)
+	if err != nil {
+		return err
+	}
+	targetPath = filepath.Join(parentDir, filepath.Base(targetPath))
+	file, err := os.OpenFile(targetPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	// Not affected by umask
+	return os.Chmod(targetPath, mode.Perm()|mode&(fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky))
+}
+
+func (extractor *archiveExtractor) writeSymlink(name string, linkname string) error {
+	targetPath, err := extractor.targetPath(name)
+	if err != nil || len(targetPath) == 0 {
+		return err
+	}
+	parentDir, err := extractor.prepareParent(targetPath)
+	if err != nil {
+		return err
+	}
+	if filepath.IsAbs(linkname) || !extractor.containsLinkTarget(parentDir, linkname) {
+		return fmt.Errorf("symlink to %q escapes the target directory", linkname)
+	}
+	targetPath = filepath.Join(parentDir, filepath.Base(targetPath))
+	if err := os.RemoveAll(targetPath); err != nil {
+		return err
+	}
+	return os.Symlink(linkname, targetPath)
+}
+
+// Whether the target of a symlink in parentDir stays below the target directory
+// The target is resolved through the entries extracted so far (e.g. `x -> d/..` after `d -> .` escapes),
+// and ".." after a component which does not exist yet is refused, as a later entry decides where it leads
+func (extractor *archiveExtractor) containsLinkTarget(parentDir string, linkname string) bool {
+	currentPath := parentDir
+	missing := false
+	for _, component := range strings.Split(filepath.ToSlash(linkname), "/") {
+		switch {
+		case component == "" || component == ".":
+			continue
+		case component == ".." && missing:
+			return false
+		case component == "..":
+			currentPath = filepath.Dir(currentPath)
+		case missing:
+			currentPath = filepath.Join(currentPath, component)
+		default:
+			currentPath = filepath.Join(currentPath, component)
+			resolvedPath, err := filepath.EvalSymlinks(currentPath)
+			if err != nil {
+				// Not extracted yet (or a dangling symlink)
+				missing = true
+				continue
+			}
+			currentPath = resolvedPath
+		}
+		if !extractor.contains(currentPath) {
+			return false
+		}
+	}
+	return true
+}
+
+func (extractor *archiveExtractor) writeHardLink(name string, linkname string) error {
+	targetPath, err := extractor.targetPath(name)
+	if err != nil || len(targetPath) == 0 {
+		return err
+	}
+	linkTargetPath, err := extractor.targetPath(linkname)
+	if err != nil {
+		return fmt.Errorf("hard link to %q: %w", linkname, err)
+	} else if len(linkTargetPath) == 0 {
+		return fmt.Errorf("hard link to %q, which is stripped", linkname)
+	}
+	resolvedLinkTargetPath, err := filepath.EvalSymlinks(linkTargetPath)
+	if err != nil {
+		return err
+	}
+	if !extractor.contains(resolvedLinkTargetPath) {
+		return fmt.Errorf("hard link to %q escapes the target directory", linkname)
+	}
+	parentDir, err := extractor.prepareParent(targetPath)
+	if err != nil {
+		return err
+	}
+	targetPath = filepath.Join(parentDir, filepath.Base(targetPath))
+	if err := os.RemoveAll(targetPath); err != nil {
+		return err
+	}
+	return os.Link(resolvedLinkTargetPath, targetPath)
+}
@@ -0,0 +1,168 @@
+package system
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+type testEntry struct {
+	name     string
+	content  string
+	mode     int64
+	typeflag byte
+	linkname string
+}
+
+func writeTestTar(t *testing.T, filePath string, entries []testEntry, compress bool) {
+	buffer := new(bytes.Buffer)
+	tarWriter := tar.NewWriter(buffer)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: entry.mode, Typeflag: entry.typeflag, Linkname: entry.linkname, Size: int64(len(entry.content))}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		tarWriter.Write([]byte(entry.content))
+	}
+	tarWriter.Close()
+	content := buffer.Bytes()
+	if compress {
+		compressed := new(bytes.Buffer)
+		gzipWriter := gzip.NewWriter(compressed)
+		gzipWriter.Write(content)
+		gzipWriter.Close()
+		content = compressed.Bytes()
+	}
+	if err := os.WriteFile(filePath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractArchive(t *testing.T) {
+	tmpDir := t.TempDir()
+	archivePath := tmpDir + "/containerd.tar.gz"
+	writeTestTar(t, archivePath, []testEntry{
+		{name: "./bin/", mode: 0755, typeflag: tar.TypeDir},
+		{name: "./bin/containerd", content: "containerd", mode: 0755, typeflag: tar.TypeReg},
+		{name: "./bin/ctr", linkname: "containerd", typeflag: tar.TypeSymlink},
+		{name: "./bin/containerd-shim", linkname: "bin/containerd", typeflag: tar.TypeLink},
+		{name: "./README", content: "readme", mode: 0600, typeflag: tar.TypeReg},
+	}, true)
+
+	dirPath := tmpDir + "/usr/local"
+	if err := extractArchive(context.Background(), archivePath, dirPath, 0); err != nil {
+		t.Fatalf("extractArchive() error = %v", err)
+	}
+	if info, err := os.Stat(dirPath + "/bin/containerd"); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("bin/containerd = %v, %v, want mode 0755", info, err)
+	}
+	if info, err := os.Stat(dirPath + "/README"); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("README = %v, %v, want mode 0600", info, err)
+	}
+	if linkname, err := os.Readlink(dirPath + "/bin/ctr"); err != nil || linkname != "containerd" {
+		t.Errorf("bin/ctr -> %q, %v", linkname, err)
+	}
+	if content, err := os.ReadFile(dirPath + "/bin/containerd-shim"); err != nil || string(content) != "containerd" {
+		t.Errorf("bin/containerd-shim = %q, %v", content, err)
+	}
+
+	// Strip leading components
+	strippedDirPath := tmpDir + "/stripped"
+	if err := extractArchive(context.Background(), archivePath, strippedDirPath, 1); err != nil {
+		t.Fatalf("extractArchive(strip 1) error = %v", err)
+	}
+	if _, err := os.Stat(strippedDirPath + "/containerd"); err != nil {
+		t.Errorf("extractArchive(strip 1) should extract bin/containerd as containerd: %v", err)
+	}
+	if _, err := os.Stat(strippedDirPath + "/README"); !os.IsNotExist(err) {
+		t.Errorf("extractArchive(strip 1) should skip README")
+	}
+}
+
+func TestExtractArchiveRejectsEscapes(t *testing.T) {
+	for description, entries := range map[string][]testEntry{
+		"parent path":      {{name: "../evil", content: "evil", mode: 0644, typeflag: tar.TypeReg}},
+		"absolute path":    {{name: "/tmp/evil", content: "evil", mode: 0644, typeflag: tar.TypeReg}},
+		"symlink outside":  {{name: "link", linkname: "../..", typeflag: tar.TypeSymlink}},
+		"absolute symlink": {{name: "link", linkname: "/etc", typeflag: tar.TypeSymlink}},
+		"write through symlink": {
+			{name: "dir/", mode: 0755, typeflag: tar.TypeDir},
+			{name: "dir/up", linkname: "..", typeflag: tar.TypeSymlink},
+			{name: "dir/up/up", linkname: "..", typeflag: tar.TypeSymlink},
+			{name: "dir/up/up/evil", content: "evil", mode: 0644, typeflag: tar.TypeReg},
+		},
+		"hard link outside": {{name: "link", linkname: "../../etc/passwd", typeflag: tar.TypeLink}},
+		"symlink outside through a symlink": {
+			{name: "d", linkname: ".", typeflag: tar.TypeSymlink},
+			{name: "x", linkname: "d/..", typeflag: tar.TypeSymlink},
+		},
+		"symlink outside through a later symlink": {
+			{name: "x", linkname: "d/..", typeflag: tar.TypeSymlink},
+			{name: "d", linkname: ".", typeflag: tar.TypeSymlink},
+		},
+	} {
+		tmpDir := t.TempDir()
+		archivePath := tmpDir + "/evil.tar"
+		writeTestTar(t, archivePath, entries, false)
+		if err := extractArchive(context.Background(), archivePath, tmpDir+"/a/b", 0); err == nil {
+			t.Errorf("extractArchive(%s) should fail", description)
+		}
+		if _, err := os.Stat(tmpDir + "/a/evil"); !os.IsNotExist(err) {
+			t.Errorf("extractArchive(%s) wrote outside the target directory", description)
+		}
+	}
+}
+
+func TestExtractZipAndXz(t *testing.T) {
+	tmpDir := t.TempDir()
+	buffer := new(bytes.Buffer)
+	zipWriter := zip.NewWriter(buffer)
+	header := &zip.FileHeader{Name: "istio-1.16.3/bin/istioctl", Method: zip.Deflate}
+	header.SetMode(0755)
+	writer, _ := zipWriter.CreateHeader(header)
+	writer.Write([]byte("istioctl"))
+	zipWriter.Create("../evil")
+	zipWriter.Close()
+	archivePath := tmpDir + "/istio.zip"
+	os.WriteFile(archivePath, buffer.Bytes(), 0644)
+	if err := extractArchive(context.Background(), archivePath, tmpDir+"/zip", 1); err == nil || !strings.Contains(err.Error(), "escapes") {
+		t.Errorf("extractArchive(zip with ../evil) error = %v, want escape", err)
+	}
+	if info, err := os.Stat(tmpDir + "/zip/bin/istioctl"); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("zip bin/istioctl = %v, %v, want mode 0755", info, err)
+	}
+
+	if _, err := exec.LookPath(xzExecutable); err != nil {
+		t.Skip("xz is not installed")
+	}
+	archivePath = tmpDir + "/cni.tar"
+	writeTestTar(t, archivePath, []testEntry{{name: "bridge", content: "bridge", mode: 0755, typeflag: tar.TypeReg}}, false)
+	if _, err := ExecCmd(xzExecutable, archivePath); err != nil {
+		t.Fatalf("xz error = %v", err)
+	}
+	if err := extractArchive(context.Background(), archivePath+".xz", tmpDir+"/xz", 0); err != nil {
+		t.Fatalf("extractArchive(tar.xz) error = %v", err)
+	}
+	if content, err := os.ReadFile(tmpDir + "/xz/bridge"); err != nil || string(content) != "bridge" {
+		t.Errorf("tar.xz bridge = %q, %v", content, err)
+	}
+}
+
+func TestExtractWithFakeRunner(t *testing.T) {
+	runner := NewFakeRunner()
+	defer SetRunner(SetRunner(runner))
+	err := ExtractArchive(&Extraction{FilePath: "/tmp/go.tar.gz", DirPath: "/usr/local", StripComponents: 1, Privileged: true})
+	if err != nil {
+		t.Fatalf("ExtractArchive() error = %v", err)
+	}
+	want := []string{"sudo mkdir -p /usr/local", "sudo tar -x --no-same-owner -f /tmp/go.tar.gz -C /usr/local --strip-components=1"}
+	if strings.Join(runner.Commands, "\n") != strings.Join(want, "\n") {
+		t.Errorf("ExtractArchive() ran %q, want %q", runner.Commands, want)
+	}
+}
@@ -0,0 +1,69 @@
+package system
+
+import (
+	"flag"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
+)
+
+// Add parameters shared by all subcommands to flag set
+func AddGlobalFlags(flagSet *flag.FlagSet) {
+	flagSet.BoolVar(&configs.System.DryRun, "dry-run", configs.System.DryRun, "Print the plan of every step and command without executing anything")
+	flagSet.StringVar(&configs.System.PlanScriptPath, "plan-script", configs.System.PlanScriptPath, "Also write the dry-run plan as a shell script to this file (implies -dry-run)")
+	flagSet.DurationVar(&configs.System.Timeout, "timeout", configs.System.Timeout, "Overall deadline of the subcommand, e.g. 1h (0 means no limit)")
+	flagSet.DurationVar(&configs.System.StepTimeout, "step-timeout", configs.System.StepTimeout, "Deadline of each command or wait step (0 means no limit)")
+	flagSet.BoolVar(&configs.System.StreamOutput, "stream", configs.System.StreamOutput, "Write command output to the log files line by line while commands run")
+	flagSet.BoolVar(&configs.System.Verbose, "verbose", configs.System.Verbose, "Also echo command output to the terminal under the current step (implies -stream)")
+	flagSet.StringVar(&configs.System.BundlePath, "bundle", configs.System.BundlePath, "Install every artifact from this bundle (created by `bundle create`) without network access")
+	flagSet.StringVar(&configs.System.NetworkConfigPath, "network-config", configs.System.NetworkConfigPath, "JSON file with download mirrors & proxy settings (default $"+NetworkConfigEnv+")")
+	flagSet.BoolVar(&configs.System.VerifySignatures, "verify-signatures", configs.System.VerifySignatures, "Verify upstream signatures of release artifacts (cosign is installed unless found)")
+	flagSet.BoolVar(&configs.System.Force, "force", configs.System.Force, "Proceed on combinations of OS & Kubernetes version that are not tested (see the support matrix)")
+	flagSet.StringVar(&configs.System.CacheDir, "cache-dir", configs.System.CacheDir, "Artifact cache directory (default $XDG_CACHE_HOME/easy_openyurt or ~/.cache/easy_openyurt)")
+}
+
+// Whether the flag was given on the command line (rather than left at its default)
+func IsFlagSet(flagSet *flag.FlagSet, name string) bool {
+	set := false
+	flagSet.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// Apply parameters shared by all subcommands, must be called after the flag set is parsed
+func ApplyGlobalFlags() {
+	setUpContext()
+	if configs.System.Verbose {
+		configs.System.StreamOutput = true
+	}
+	if len(configs.System.PlanScriptPath) > 0 {
+		configs.System.DryRun = true
+	}
+	err := LoadNetworkSettings()
+	logs.CheckErrorWithMsg(err, "Failed to load network settings!\n")
+	applyProxyEnvironment()
+	if len(configs.System.BundlePath) > 0 {
+		logs.WaitPrintf("Extracting bundle %s", configs.System.BundlePath)
+		err = OpenBundle(configs.System.BundlePath)
+		logs.CheckErrorWithTagAndMsg(err, "Failed to open bundle %s!\n", configs.System.BundlePath)
+	}
+	if configs.System.DryRun {
+		dryRunRunner, err := NewDryRunRunner(configs.System.PlanScriptPath)
+		logs.CheckErrorWithMsg(err, "Failed to create plan script %s!\n", configs.System.PlanScriptPath)
+		SetRunner(dryRunRunner)
+		logs.WarnPrintf("Dry-run mode: commands below will only be printed, NOT executed!\n")
+	}
+}
+
+// Finish the current subcommand (print the report of downloads, and the plan summary in dry-run mode)
+func FinishGlobal() {
+	PrintVerificationReport()
+	CloseBundle()
+	if dryRunRunner, ok := currentRunner.(*DryRunRunner); ok {
+		err := dryRunRunner.Close()
+		logs.CheckErrorWithMsg(err, "Failed to write plan script %s!\n", configs.System.PlanScriptPath)
+	}
+}
@@ -0,0 +1,154 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Kernel parameter, set through /proc/sys
+type Sysctl struct {
+	Key   string // e.g. net.ipv4.ip_forward
+	Value string
+}
+
+// Kernel modules & sysctls required by Kubernetes, set by `SystemInit()` & checked by `system check`
+var (
+	kernelModules = []string{"overlay", "br_netfilter"}
+	kernelSysctls = []Sysctl{
+		{"net.bridge.bridge-nf-call-iptables", "1"},
+		{"net.bridge.bridge-nf-call-ip6tables", "1"},
+		{"net.ipv4.ip_forward", "1"},
+		{"net.ipv4.conf.all.forwarding", "1"},
+	}
+)
+
+// Drop-in files loading the kernel modules & setting the sysctls at boot
+var (
+	kernelModulesConfigPath = "/etc/modules-load.d/netfilter.conf"
+	sysctlConfigPath        = "/etc/sysctl.d/99-kubernetes-cri.conf"
+	// Applied after the drop-ins (as /etc/sysctl.d/99-sysctl.conf), so conflicting settings are commented out
+	mainSysctlConfigPath = "/etc/sysctl.conf"
+)
+
+// Get the path of sysctl below /proc/sys
+func (sysctl Sysctl) procPath() string {
+	return "/proc/sys/" + strings.ReplaceAll(sysctl.Key, ".", "/")
+}
+
+// Get the modules-load.d drop-in loading the kernel modules
+func KernelModulesConfig() string {
+	return "# Generated by easy_openyurt\n" + strings.Join(kernelModules, "\n") + "\n"
+}
+
+// Get the sysctl.d drop-in setting the sysctls
+func SysctlConfig() string {
+	content := "# Generated by easy_openyurt\n"
+	for _, sysctl := range kernelSysctls {
+		content += fmt.Sprintf("%s = %s\n", sysctl.Key, sysctl.Value)
+	}
+	return content
+}
+
+// Comment out settings of sysctls that conflict with the drop-in, returning whether any was found
+func commentOutConflictingSysctls(content string) (string, bool) {
+	lines := strings.Split(content, "\n")
+	found := false
+	for i, line := range lines {
+		key, value, ok := strings.Cut(strings.TrimPrefix(strings.TrimSpace(line), "-"), "=")
+		if !ok || strings.HasPrefix(key, "#") || strings.HasPrefix(key, ";") {
+			continue
+		}
+		key, value = strings.ReplaceAll(strings.TrimSpace(key), "/", "."), strings.TrimSpace(value)
+		for _, sysctl := range kernelSysctls {
+			if sysctl.Key == key && sysctl.Value != value {
+				lines[i] = "# " + line + " # Overridden by " + sysctlConfigPath
+				found = true
+			}
+		}
+	}
+	return strings.Join(lines, "\n"), found
+}
+
+// Whether the kernel module is loaded or built in
+func kernelModuleLoaded(module string) bool {
+	modules, _ := readCheckFile("/proc/modules")
+	for _, line := range strings.Split(modules, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && fields[0] == module {
+			return true
+		}
+	}
+	// Built-in modules are only listed in /sys/module
+	_, err := os.Stat(checkRootDir + "/sys/module/" + module)
+	return err == nil
+}
+
+// Describe the sysctls whose live values differ from the required ones (empty if none)
+func SysctlDrift() []string {
+	var drift []string
+	for _, sysctl := range kernelSysctls {
+		value, err := readCheckFile(sysctl.procPath())
+		if err != nil {
+			drift = append(drift, fmt.Sprintf("%s missing (want %s)", sysctl.Key, sysctl.Value))
+		} else if value != sysctl.Value {
+			drift = append(drift, fmt.Sprintf("%s = %s (want %s)", sysctl.Key, value, sysctl.Value))
+		}
+	}
+	return drift
+}
+
+// Write the drop-ins, load the kernel modules & apply the sysctls, then verify their live values
+func ConfigureKernel() error {
+	for _, dropIn := range []struct {
+		path    string
+		content string
+	}{
+		{kernelModulesConfigPath, KernelModulesConfig()},
+		{sysctlConfigPath, SysctlConfig()},
+	} {
+		if err := RecordFileChange(dropIn.path); err != nil {
+			return err
+		}
+		if _, err := ExecCmd("sudo", "mkdir", "-p", path.Dir(dropIn.path)); err != nil {
+			return err
+		}
+		if _, err := ExecCmdWithInput(dropIn.content, "sudo", "tee", dropIn.path); err != nil {
+			return err
+		}
+	}
+	if content, err := os.ReadFile(mainSysctlConfigPath); err == nil {
+		if content, found := commentOutConflictingSysctls(string(content)); found {
+			if err = RecordFileChange(mainSysctlConfigPath); err != nil {
+				return err
+			}
+			if _, err = ExecCmdWithInput(content, "sudo", "tee", mainSysctlConfigPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Bridge sysctls only exist once br_netfilter is loaded
+	for _, module := range kernelModules {
+		if _, err := ExecCmd("sudo", "modprobe", module); err != nil {
+			return err
+		}
+	}
+	for _, sysctl := range kernelSysctls {
+		if value, err := readCheckFile(sysctl.procPath()); err == nil && value != sysctl.Value {
+			if err = RecordSysctlChange(sysctl.Key, value); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := ExecCmd("sudo", "sysctl", "--quiet", "-p", sysctlConfigPath); err != nil {
+		return err
+	}
+	if IsDryRun() {
+		return nil
+	}
+	if drift := SysctlDrift(); len(drift) > 0 {
+		return fmt.Errorf("sysctls not applied: %s", strings.Join(drift, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package system
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSysctlConfig(t *testing.T) {
+	want := "# Generated by easy_openyurt\nnet.bridge.bridge-nf-call-iptables = 1\nnet.bridge.bridge-nf-call-ip6tables = 1\nnet.ipv4.ip_forward = 1\nnet.ipv4.conf.all.forwarding = 1\n"
+	if content := SysctlConfig(); content != want {
+		t.Errorf("SysctlConfig() = %q, want %q", content, want)
+	}
+	if content := KernelModulesConfig(); content != "# Generated by easy_openyurt\noverlay\nbr_netfilter\n" {
+		t.Errorf("KernelModulesConfig() = %q", content)
+	}
+
+	content, found := commentOutConflictingSysctls("#net.ipv4.ip_forward=1\nnet.ipv4.ip_forward = 0\nvm.swappiness=10\n-net/bridge/bridge-nf-call-iptables=0\nnet.ipv4.conf.all.forwarding=1\n")
+	want = "#net.ipv4.ip_forward=1\n# net.ipv4.ip_forward = 0 # Overridden by /etc/sysctl.d/99-kubernetes-cri.conf\nvm.swappiness=10\n# -net/bridge/bridge-nf-call-iptables=0 # Overridden by /etc/sysctl.d/99-kubernetes-cri.conf\nnet.ipv4.conf.all.forwarding=1\n"
+	if !found || content != want {
+		t.Errorf("commentOutConflictingSysctls() = %q, %v, want %q", content, found, want)
+	}
+	if _, found = commentOutConflictingSysctls("vm.swappiness=10\n"); found {
+		t.Errorf("commentOutConflictingSysctls(no conflict) should find nothing")
+	}
+}
+
+func TestConfigureKernel(t *testing.T) {
+	fakeRunner := useFakeRunner(t)
+	useFakeSystemRoot(t, "systemd")
+	useStateJournal(t, "system master init")
+	previousMainSysctlConfigPath := mainSysctlConfigPath
+	mainSysctlConfigPath = t.TempDir() + "/sysctl.conf"
+	defer func() { mainSysctlConfigPath = previousMainSysctlConfigPath }()
+	os.WriteFile(mainSysctlConfigPath, []byte("net.ipv4.ip_forward=0\n"), 0644)
+
+	if err := ConfigureKernel(); err != nil {
+		t.Fatalf("ConfigureKernel() error = %v", err)
+	}
+	for _, pattern := range []string{
+		"sudo tee " + kernelModulesConfigPath,
+		"sudo tee " + sysctlConfigPath,
+		"sudo tee " + mainSysctlConfigPath,
+		"sudo modprobe br_netfilter",
+		"sudo sysctl --quiet -p " + sysctlConfigPath,
+	} {
+		if !fakeRunner.Executed(pattern) {
+			t.Errorf("ConfigureKernel() did not execute %q\n%v", pattern, fakeRunner)
+		}
+	}
+	if fakeRunner.Index("sudo modprobe br_netfilter") > fakeRunner.Index("sudo sysctl --quiet -p") {
+		t.Errorf("ConfigureKernel() applied the sysctls before loading br_netfilter\n%v", fakeRunner)
+	}
+
+	// Live values are verified
+	os.WriteFile(checkRootDir+"/proc/sys/net/ipv4/ip_forward", []byte("0\n"), 0644)
+	os.Remove(checkRootDir + "/proc/sys/net/bridge/bridge-nf-call-ip6tables")
+	err := ConfigureKernel()
+	if err == nil || !strings.Contains(err.Error(), "net.ipv4.ip_forward = 0 (want 1)") || !strings.Contains(err.Error(), "net.bridge.bridge-nf-call-ip6tables missing (want 1)") {
+		t.Errorf("ConfigureKernel(drift) error = %v", err)
+	}
+	// Original live values are recorded for `system reset`
+	journal, _ := LoadStateJournal()
+	var sysctlChanges []string
+	for _, change := range journal.Changes {
+		if change.Kind == ChangeSysctl {
+			sysctlChanges = append(sysctlChanges, change.Names[0]+"="+change.Value)
+		}
+	}
+	if strings.Join(sysctlChanges, " ") != "net.ipv4.ip_forward=0" {
+		t.Errorf("ConfigureKernel(drift) recorded sysctls %v, want net.ipv4.ip_forward=0", sysctlChanges)
+	}
+}
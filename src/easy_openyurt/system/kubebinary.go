@@ -0,0 +1,104 @@
+package system
+
+import (
+	"fmt"
+	"strings"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
+)
+
+// Methods of installing kubeadm, kubelet & kubectl
+const (
+	KubeInstallPackage = "package" // From the pkgs.k8s.io repository, with the package manager
+	KubeInstallBinary  = "binary"  // From release binaries, without the package manager
+)
+
+// Directory of Kubernetes binaries installed by the `binary` method
+const kubeBinaryDir = "/usr/local/bin"
+
+// Dependencies of kubelet & kubeadm otherwise pulled in by their packages, named as on Ubuntu
+const kubeBinaryDependencies = "conntrack socat ethtool iptables"
+
+// Get the version of the binary (kubeadm, kubelet or kubectl) to install, without package revision
+func kubeBinaryVersion(binary string) string {
+	version := map[string]string{
+		"kubeadm": configs.System.KubeadmVersion,
+		"kubelet": configs.System.KubeletVersion,
+		"kubectl": configs.System.KubectlVersion,
+	}[binary]
+	return upstreamVersion(KubePackageVersion(version))
+}
+
+// Get the crictl version, which follows the Kubernetes minor version by default
+func crictlVersion() string {
+	if len(configs.System.CrictlVersion) > 0 {
+		return configs.System.CrictlVersion
+	}
+	return kubeMinorVersion(configs.Kube.K8sVersion) + ".0"
+}
+
+func kubeBinaryUrl(binary string) string {
+	return fmt.Sprintf(configs.System.KubeBinaryDownloadUrlTemplate, kubeBinaryVersion(binary), configs.ArchName("kubernetes-binaries"), binary)
+}
+
+func crictlUrl() string {
+	return fmt.Sprintf(configs.System.CrictlDownloadUrlTemplate, crictlVersion(), crictlVersion(), configs.ArchName("crictl"))
+}
+
+// Get artifacts needed by the `binary` install method
+func kubeBinaryArtifacts() []*Artifact {
+	var artifacts []*Artifact
+	for _, binary := range []string{"kubeadm", "kubelet", "kubectl"} {
+		artifacts = append(artifacts, &Artifact{Kind: ArtifactFile, Source: kubeBinaryUrl(binary), Sha256Url: kubeBinaryUrl(binary) + ".sha256"})
+		artifacts = append(artifacts, KubeBinarySignature(kubeBinaryUrl(binary)).artifacts()...)
+	}
+	artifacts = append(artifacts,
+		&Artifact{Kind: ArtifactFile, Source: crictlUrl(), Sha256Url: crictlUrl() + ".sha256"},
+		&Artifact{Kind: ArtifactFile, Source: configs.System.KubeletSystemdProfileDownloadUrl},
+		&Artifact{Kind: ArtifactFile, Source: configs.System.KubeadmSystemdDropInDownloadUrl})
+	for _, dependency := range strings.Fields(kubeBinaryDependencies) {
+		artifacts = append(artifacts, &Artifact{Kind: ArtifactPackage, Source: dependency})
+	}
+	return artifacts
+}
+
+// Install kubeadm, kubelet, kubectl & crictl from release binaries, and kubelet as systemd service
+func installKubeBinaries() {
+	// Install dependencies
+	logs.WaitPrintf("Installing dependencies of kubelet & kubeadm")
+	err := InstallPackages(kubeBinaryDependencies)
+	logs.CheckErrorWithTagAndMsg(err, "Failed to install dependencies of kubelet & kubeadm!\n")
+
+	// Download & install kubeadm, kubelet, kubectl
+	for _, binary := range []string{"kubeadm", "kubelet", "kubectl"} {
+		logs.WaitPrintf("Downloading %s(ver %s)", binary, kubeBinaryVersion(binary))
+		url := kubeBinaryUrl(binary)
+		filePathName, err := DownloadToTmpDirWithSignature(KubeBinarySignature(url), url+".sha256", url)
+		logs.CheckErrorWithTagAndMsg(err, "Failed to download %s(ver %s)!\n", binary, kubeBinaryVersion(binary))
+		logs.WaitPrintf("Installing %s", binary)
+		_, err = ExecCmd("sudo", "install", "-m", "755", filePathName, kubeBinaryDir+"/"+binary)
+		logs.CheckErrorWithTagAndMsg(err, "Failed to install %s!\n", binary)
+	}
+
+	// Download & install crictl
+	logs.WaitPrintf("Downloading crictl(ver %s)", crictlVersion())
+	filePathName, err := DownloadToTmpDirWithChecksum(crictlUrl()+".sha256", crictlUrl())
+	logs.CheckErrorWithTagAndMsg(err, "Failed to download crictl(ver %s)!\n", crictlVersion())
+	logs.WaitPrintf("Installing crictl")
+	err = ExtractToDir(filePathName, kubeBinaryDir, true)
+	logs.CheckErrorWithTagAndMsg(err, "Failed to install crictl!\n")
+
+	// Install kubelet as systemd service, with the drop-in configuring it for kubeadm
+	logs.WaitPrintf("Downloading systemd profile for kubelet")
+	kubeletProfilePath, err := DownloadToTmpDir(configs.System.KubeletSystemdProfileDownloadUrl)
+	logs.CheckErrorWithMsg(err, "Failed to download systemd profile for kubelet!\n")
+	kubeadmDropInPath, err := DownloadToTmpDir(configs.System.KubeadmSystemdDropInDownloadUrl)
+	logs.CheckErrorWithTagAndMsg(err, "Failed to download systemd profile for kubelet!\n")
+	logs.WaitPrintf("Enabling kubelet via systemd")
+	// The profiles refer to binaries installed by packages
+	binaryPathSed := ShellQuote(fmt.Sprintf("s:/usr/bin:%s:g", kubeBinaryDir))
+	_, err = ExecShellCmd("sed %s %s | sudo tee /etc/systemd/system/kubelet.service && sudo mkdir -p /etc/systemd/system/kubelet.service.d && sed %s %s | sudo tee /etc/systemd/system/kubelet.service.d/10-kubeadm.conf && sudo systemctl daemon-reload && sudo systemctl enable kubelet",
+		binaryPathSed, ShellQuote(kubeletProfilePath), binaryPathSed, ShellQuote(kubeadmDropInPath))
+	logs.CheckErrorWithTagAndMsg(err, "Failed to enable kubelet via systemd!\n")
+}
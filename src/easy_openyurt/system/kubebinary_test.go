@@ -0,0 +1,65 @@
+package system
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+func TestSystemInitWithKubeBinaries(t *testing.T) {
+	fakeRunner := useFakeSystemInit(t)
+	configs.System.KubeInstallMethod = KubeInstallBinary
+	configs.System.KubeletVersion = "1.25.8-00"
+
+	SystemInit()
+
+	for _, pattern := range []string{
+		"sudo apt-get -qq install -y --allow-downgrades conntrack socat ethtool iptables",
+		"https://dl.k8s.io/release/v1.25.9/bin/linux/" + configs.System.CurrentArch + "/kubeadm.sha256",
+		"cosign verify-blob",
+		"/kubeadm /usr/local/bin/kubeadm",
+		"https://dl.k8s.io/release/v1.25.8/bin/linux/" + configs.System.CurrentArch + "/kubelet",
+		"https://github.com/kubernetes-sigs/cri-tools/releases/download/v1.25.0/crictl-v1.25.0-linux-" + configs.System.CurrentArch + ".tar.gz",
+		"sudo tee /etc/systemd/system/kubelet.service.d/10-kubeadm.conf",
+		"sudo systemctl enable kubelet",
+	} {
+		if !fakeRunner.Executed(pattern) {
+			t.Errorf("SystemInit(-k8s-install-method=binary) did not execute %q\n%v", pattern, fakeRunner)
+		}
+	}
+	if _, err := exec.LookPath("cosign"); err != nil {
+		if install := fakeRunner.Index("/cosign-linux-" + configs.ArchName("cosign") + " " + cosignPath); install < 0 || install > fakeRunner.Index("cosign verify-blob") {
+			t.Errorf("SystemInit(-k8s-install-method=binary) did not install cosign before verifying signatures\n%v", fakeRunner)
+		}
+	}
+	if fakeRunner.Executed("pkgs.k8s.io") || fakeRunner.Executed("apt-mark hold") {
+		t.Errorf("SystemInit(-k8s-install-method=binary) should not use the package repository\n%v", fakeRunner)
+	}
+}
+
+func TestKubeBinaryArtifacts(t *testing.T) {
+	configs.System.KubeInstallMethod = KubeInstallBinary
+	defer func() { configs.System.KubeInstallMethod = KubeInstallPackage }()
+
+	artifacts, err := BundleArtifacts()
+	if err != nil {
+		t.Fatalf("BundleArtifacts() error = %v", err)
+	}
+	sources := map[string]*Artifact{}
+	for _, artifact := range artifacts {
+		sources[artifact.Source] = artifact
+	}
+	kubeletUrl := "https://dl.k8s.io/release/v1.25.9/bin/linux/" + configs.System.CurrentArch + "/kubelet"
+	if artifact := sources[kubeletUrl]; artifact == nil || artifact.Sha256Url != kubeletUrl+".sha256" {
+		t.Errorf("BundleArtifacts() should bundle %s with its checksum: %+v", kubeletUrl, artifact)
+	}
+	for _, source := range []string{kubeletUrl + ".sig", kubeletUrl + ".cert", configs.System.KubeadmSystemdDropInDownloadUrl, "conntrack", cosignUrl()} {
+		if sources[source] == nil {
+			t.Errorf("BundleArtifacts() should bundle %s", source)
+		}
+	}
+	if sources["kubelet=1.25.9-*"] != nil {
+		t.Errorf("BundleArtifacts() should not bundle the kubelet package")
+	}
+}
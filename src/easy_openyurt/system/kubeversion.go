@@ -0,0 +1,77 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+// Get the package version of kubeadm, kubelet or kubectl (empty follows the Kubernetes version)
+// Revisions of the frozen apt.kubernetes.io (e.g. 1.25.9-00) are dropped, pkgs.k8s.io uses others (e.g. 1.28.2-1.1)
+func KubePackageVersion(version string) string {
+	if len(version) == 0 {
+		version = configs.Kube.K8sVersion
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(version, "v"), "-00")
+}
+
+// Make the Kubernetes version & the versions of kubeadm, kubelet, kubectl consistent
+// Without -k8s-version, the Kubernetes version follows the first package version given
+// All packages must be of the Kubernetes minor version, as pkgs.k8s.io has a repository per minor version
+func ResolveKubeVersions(k8sVersionSet bool) error {
+	packageVersions := []struct {
+		flagName string
+		version  string
+	}{
+		{"kubeadm-version", configs.System.KubeadmVersion},
+		{"kubelet-version", configs.System.KubeletVersion},
+		{"kubectl-version", configs.System.KubectlVersion},
+	}
+	if !k8sVersionSet {
+		for _, packageVersion := range packageVersions {
+			if len(packageVersion.version) > 0 {
+				configs.Kube.K8sVersion = upstreamVersion(KubePackageVersion(packageVersion.version))
+				break
+			}
+		}
+	}
+	var err error
+	for _, packageVersion := range packageVersions {
+		if len(packageVersion.version) > 0 && kubeMinorVersion(packageVersion.version) != kubeMinorVersion(configs.Kube.K8sVersion) {
+			err = errors.Join(err, fmt.Errorf("-%s: %s is not in the Kubernetes v%s repository of -k8s-version %s",
+				packageVersion.flagName, packageVersion.version, kubeMinorVersion(configs.Kube.K8sVersion), configs.Kube.K8sVersion))
+		}
+	}
+	return err
+}
+
+// Get a repository of pkgs.k8s.io (with deb/ & rpm/ below repoUrl) for the current OS
+func pkgsK8sIoRepo(name string, repoUrl string) *PackageRepo {
+	repo := &PackageRepo{
+		Name:     name,
+		AptUrl:   repoUrl + "deb/",
+		AptSuite: "/",
+		RpmUrl:   repoUrl + "rpm/",
+		KeyUrl:   repoUrl + "deb/Release.key",
+	}
+	if packageManager, err := GetPackageManager(); err == nil && packageManager.Name() != "apt" {
+		repo.KeyUrl = repoUrl + "rpm/repodata/repomd.xml.key"
+	}
+	return repo
+}
+
+// Get the Kubernetes package repository of the current OS
+func KubeRepo() *PackageRepo {
+	return pkgsK8sIoRepo("kubernetes", fmt.Sprintf(configs.System.KubeRepoUrlTemplate, kubeMinorVersion(configs.Kube.K8sVersion)))
+}
+
+// Get the version of the installed kubeadm (e.g. 1.25.9)
+func InstalledKubeadmVersion() (string, error) {
+	version, err := ExecCmd("kubeadm", "version", "-o", "short")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(version, "v"), nil
+}
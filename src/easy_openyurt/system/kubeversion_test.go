@@ -0,0 +1,57 @@
+package system
+
+import (
+	"testing"
+
+	"github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+func TestResolveKubeVersions(t *testing.T) {
+	defer func() {
+		configs.Kube.K8sVersion = "1.25.9"
+		configs.System.KubeadmVersion, configs.System.KubeletVersion, configs.System.KubectlVersion = "", "", ""
+	}()
+	for _, test := range []struct {
+		k8sVersion    string
+		k8sVersionSet bool
+		kubeadm       string
+		kubelet       string
+		wantK8s       string
+		wantKubeadm   string
+		wantErr       bool
+	}{
+		{"1.25.9", false, "", "", "1.25.9", "kubeadm=1.25.9-*", false},
+		{"1.25.9", false, "1.28.2-1.1", "", "1.28.2", "kubeadm=1.28.2-1.1", false},
+		{"1.25.9", false, "1.25.4-00", "1.25.4-00", "1.25.4", "kubeadm=1.25.4-*", false},
+		{"1.27.3", true, "", "", "1.27.3", "kubeadm=1.27.3-*", false},
+		{"1.27.3", true, "1.26.1", "", "1.27.3", "", true},
+		{"1.25.9", false, "1.26.1", "1.25.9", "1.26.1", "", true},
+	} {
+		configs.Kube.K8sVersion = test.k8sVersion
+		configs.System.KubeadmVersion, configs.System.KubeletVersion = test.kubeadm, test.kubelet
+		err := ResolveKubeVersions(test.k8sVersionSet)
+		if (err != nil) != test.wantErr || configs.Kube.K8sVersion != test.wantK8s {
+			t.Errorf("ResolveKubeVersions(%+v) = %v, -k8s-version %s", test, err, configs.Kube.K8sVersion)
+			continue
+		}
+		if spec := (&aptPackageManager{}).VersionedPackage("kubeadm", KubePackageVersion(configs.System.KubeadmVersion)); !test.wantErr && spec != test.wantKubeadm {
+			t.Errorf("kubeadm package of %+v = %s, want %s", test, spec, test.wantKubeadm)
+		}
+	}
+}
+
+func TestKubeRepo(t *testing.T) {
+	configs.Kube.K8sVersion = "1.28.2"
+	defer func() { configs.Kube.K8sVersion = "1.25.9"; configs.System.CurrentOS = "ubuntu" }()
+
+	configs.System.CurrentOS = "ubuntu"
+	if repo := KubeRepo(); repo.AptUrl != "https://pkgs.k8s.io/core:/stable:/v1.28/deb/" || repo.AptSuite != "/" ||
+		repo.KeyUrl != "https://pkgs.k8s.io/core:/stable:/v1.28/deb/Release.key" {
+		t.Errorf("KubeRepo(ubuntu) = %+v", repo)
+	}
+	configs.System.CurrentOS = "rocky"
+	if repo := KubeRepo(); repo.RpmUrl != "https://pkgs.k8s.io/core:/stable:/v1.28/rpm/" ||
+		repo.KeyUrl != "https://pkgs.k8s.io/core:/stable:/v1.28/rpm/repodata/repomd.xml.key" {
+		t.Errorf("KubeRepo(rocky) = %+v", repo)
+	}
+}
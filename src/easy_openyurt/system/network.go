@@ -0,0 +1,170 @@
+package system
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+// Environment variables read by `LoadNetworkSettings()`
+const (
+	NetworkConfigEnv = "EASY_OPENYURT_NETWORK_CONFIG" // Network config file, overridden by -network-config
+	MirrorsEnv       = "EASY_OPENYURT_MIRRORS"        // Mirrors as `host=mirror,host=mirror`
+)
+
+// Destinations never reached through the proxy, in addition to the configured ones
+// (traffic inside the cluster must not leave the node through a proxy)
+var clusterNoProxy = []string{"localhost", "127.0.0.1", "::1", ".svc", ".cluster.local", "10.96.0.0/12"}
+
+// Content of a network config file
+type NetworkConfig struct {
+	Mirrors    map[string]string // Host => URL replacing `scheme://host` (e.g. "github.com": "https://mirror.example.com/github.com")
+	HttpProxy  string
+	HttpsProxy string
+	NoProxy    string
+}
+
+// Load mirrors & proxy settings from the environment, then from the network config file (if any)
+func LoadNetworkSettings() error {
+	for _, name := range []string{"HTTP_PROXY", "http_proxy"} {
+		if value := os.Getenv(name); len(value) > 0 && len(configs.System.HttpProxy) == 0 {
+			configs.System.HttpProxy = value
+		}
+	}
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy"} {
+		if value := os.Getenv(name); len(value) > 0 && len(configs.System.HttpsProxy) == 0 {
+			configs.System.HttpsProxy = value
+		}
+	}
+	for _, name := range []string{"NO_PROXY", "no_proxy"} {
+		if value := os.Getenv(name); len(value) > 0 && len(configs.System.NoProxy) == 0 {
+			configs.System.NoProxy = value
+		}
+	}
+	if mirrors := os.Getenv(MirrorsEnv); len(mirrors) > 0 {
+		for _, mirror := range strings.Split(mirrors, ",") {
+			host, mirrorUrl, found := strings.Cut(strings.TrimSpace(mirror), "=")
+			if !found || len(host) == 0 || len(mirrorUrl) == 0 {
+				return fmt.Errorf("invalid mirror %q in %s, expected host=mirror", mirror, MirrorsEnv)
+			}
+			configs.System.Mirrors[host] = mirrorUrl
+		}
+	}
+	if len(configs.System.NetworkConfigPath) == 0 {
+		configs.System.NetworkConfigPath = os.Getenv(NetworkConfigEnv)
+	}
+	if len(configs.System.NetworkConfigPath) > 0 {
+		content, err := os.ReadFile(configs.System.NetworkConfigPath)
+		if err != nil {
+			return err
+		}
+		networkConfig := &NetworkConfig{}
+		if err := json.Unmarshal(content, networkConfig); err != nil {
+			return fmt.Errorf("invalid network config %s: %w", configs.System.NetworkConfigPath, err)
+		}
+		for host, mirrorUrl := range networkConfig.Mirrors {
+			configs.System.Mirrors[host] = mirrorUrl
+		}
+		if len(networkConfig.HttpProxy) > 0 {
+			configs.System.HttpProxy = networkConfig.HttpProxy
+		}
+		if len(networkConfig.HttpsProxy) > 0 {
+			configs.System.HttpsProxy = networkConfig.HttpsProxy
+		}
+		if len(networkConfig.NoProxy) > 0 {
+			configs.System.NoProxy = networkConfig.NoProxy
+		}
+	}
+	for host, mirrorUrl := range configs.System.Mirrors {
+		if parsedUrl, err := url.Parse(mirrorUrl); err != nil || len(parsedUrl.Scheme) == 0 || len(parsedUrl.Host) == 0 {
+			return fmt.Errorf("invalid mirror %q for %s, expected an absolute URL", mirrorUrl, host)
+		}
+	}
+	return nil
+}
+
+// Export proxy settings to the environment, so that net/http and every command (git, kubectl, helm...) use them
+func applyProxyEnvironment() {
+	for _, variable := range ProxyEnvironment() {
+		name, value, _ := strings.Cut(variable, "=")
+		os.Setenv(name, value)
+		os.Setenv(strings.ToLower(name), value)
+	}
+}
+
+// Whether a proxy is configured
+func IsProxyConfigured() bool {
+	return len(configs.System.HttpProxy) > 0 || len(configs.System.HttpsProxy) > 0
+}
+
+// Get proxy settings as environment variables (empty if no proxy is configured)
+func ProxyEnvironment() []string {
+	if !IsProxyConfigured() {
+		return nil
+	}
+	noProxy := append([]string{}, clusterNoProxy...)
+	if len(configs.Kube.PodNetworkCidr) > 0 {
+		noProxy = append(noProxy, configs.Kube.PodNetworkCidr)
+	}
+	if len(configs.Kube.ApiserverAdvertiseAddress) > 0 {
+		noProxy = append(noProxy, configs.Kube.ApiserverAdvertiseAddress)
+	}
+	for _, destination := range strings.Split(configs.System.NoProxy, ",") {
+		if destination = strings.TrimSpace(destination); len(destination) > 0 {
+			noProxy = append(noProxy, destination)
+		}
+	}
+	var environment []string
+	if len(configs.System.HttpProxy) > 0 {
+		environment = append(environment, "HTTP_PROXY="+configs.System.HttpProxy)
+	}
+	if len(configs.System.HttpsProxy) > 0 {
+		environment = append(environment, "HTTPS_PROXY="+configs.System.HttpsProxy)
+	}
+	return append(environment, "NO_PROXY="+strings.Join(noProxy, ","))
+}
+
+// Redirect URL to the mirror configured for its host (unchanged if there is none)
+func MirrorUrl(rawUrl string) string {
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil || len(parsedUrl.Host) == 0 {
+		return rawUrl
+	}
+	mirrorUrl, ok := configs.System.Mirrors[parsedUrl.Host]
+	if !ok {
+		return rawUrl
+	}
+	return strings.TrimSuffix(mirrorUrl, "/") + strings.TrimPrefix(rawUrl, parsedUrl.Scheme+"://"+parsedUrl.Host)
+}
+
+// Write proxy settings into a systemd drop-in of service (removed if no proxy is configured)
+// The service has to be (re)started by the caller afterwards
+func ConfigureServiceProxy(service string) error {
+	dropInDir := fmt.Sprintf("/etc/systemd/system/%s.service.d", service)
+	dropInPath := dropInDir + "/http-proxy.conf"
+	err := RecordFileChange(dropInPath)
+	if err != nil {
+		return err
+	}
+	if !IsProxyConfigured() {
+		_, err = ExecCmd("sudo", "rm", "-f", dropInPath)
+	} else {
+		dropIn := "[Service]\n"
+		for _, variable := range ProxyEnvironment() {
+			dropIn += fmt.Sprintf("Environment=%q\n", variable)
+		}
+		_, err = ExecCmd("sudo", "mkdir", "-p", dropInDir)
+		if err == nil {
+			_, err = ExecCmdWithInput(dropIn, "sudo", "tee", dropInPath)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	_, err = ExecCmd("sudo", "systemctl", "daemon-reload")
+	return err
+}
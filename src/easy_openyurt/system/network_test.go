@@ -0,0 +1,102 @@
+package system
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+func resetNetworkSettings() {
+	configs.System.Mirrors = map[string]string{}
+	configs.System.HttpProxy = ""
+	configs.System.HttpsProxy = ""
+	configs.System.NoProxy = ""
+	configs.System.NetworkConfigPath = ""
+}
+
+func TestLoadNetworkSettings(t *testing.T) {
+	defer resetNetworkSettings()
+	for _, name := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy", "NO_PROXY", "no_proxy"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("HTTPS_PROXY", "http://env-proxy:3128")
+	t.Setenv("no_proxy", "10.0.0.0/8")
+	t.Setenv(MirrorsEnv, "github.com=https://ghproxy.example.com/github.com, dl.k8s.io=https://env.example.com")
+	configPath := t.TempDir() + "/network.json"
+	os.WriteFile(configPath, []byte(`{"Mirrors": {"dl.k8s.io": "https://k8s.example.com/"}, "HttpProxy": "http://file-proxy:3128"}`), 0644)
+	t.Setenv(NetworkConfigEnv, configPath)
+
+	if err := LoadNetworkSettings(); err != nil {
+		t.Fatalf("LoadNetworkSettings() error = %v", err)
+	}
+	if configs.System.HttpProxy != "http://file-proxy:3128" || configs.System.HttpsProxy != "http://env-proxy:3128" || configs.System.NoProxy != "10.0.0.0/8" {
+		t.Errorf("proxy = %q, %q, %q", configs.System.HttpProxy, configs.System.HttpsProxy, configs.System.NoProxy)
+	}
+	for rawUrl, want := range map[string]string{
+		"https://github.com/containerd/containerd/releases/download/v1.6.18/containerd.tar.gz": "https://ghproxy.example.com/github.com/containerd/containerd/releases/download/v1.6.18/containerd.tar.gz",
+		"https://dl.k8s.io/apt/doc/apt-key.gpg":                                                "https://k8s.example.com/apt/doc/apt-key.gpg",
+		"https://go.dev/dl/go1.18.10.linux-amd64.tar.gz":                                       "https://go.dev/dl/go1.18.10.linux-amd64.tar.gz",
+	} {
+		if mirrored := MirrorUrl(rawUrl); mirrored != want {
+			t.Errorf("MirrorUrl(%q) = %q, want %q", rawUrl, mirrored, want)
+		}
+	}
+	environment := strings.Join(ProxyEnvironment(), " ")
+	if !strings.Contains(environment, "HTTP_PROXY=http://file-proxy:3128") || !strings.Contains(environment, "NO_PROXY=localhost,") || !strings.Contains(environment, ",10.0.0.0/8") {
+		t.Errorf("ProxyEnvironment() = %q", environment)
+	}
+
+	t.Setenv(MirrorsEnv, "github.com")
+	if err := LoadNetworkSettings(); err == nil {
+		t.Errorf("LoadNetworkSettings() should reject a mirror without URL")
+	}
+}
+
+func TestDownloadFromMirror(t *testing.T) {
+	defer resetNetworkSettings()
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/github.com/runc.amd64" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("runc"))
+	}))
+	defer mirror.Close()
+	configs.System.Mirrors["github.com"] = mirror.URL + "/github.com"
+	configs.System.TmpDir = t.TempDir()
+	defer func() { configs.System.TmpDir = "" }()
+
+	filePath, err := DownloadToTmpDir("https://github.com/runc.amd64")
+	if content, _ := os.ReadFile(filePath); err != nil || string(content) != "runc" {
+		t.Fatalf("DownloadToTmpDir() = %q, %v", content, err)
+	}
+	if commands := (&Download{Url: "https://github.com/runc.amd64", FilePath: filePath}).Commands(); !strings.Contains(commands[0].String(), mirror.URL) {
+		t.Errorf("Download.Commands() = %q, want the mirror", commands[0])
+	}
+}
+
+func TestConfigureServiceProxy(t *testing.T) {
+	defer resetNetworkSettings()
+	runner := NewFakeRunner()
+	defer SetRunner(SetRunner(runner))
+
+	configs.System.HttpsProxy = "http://proxy:3128"
+	if err := ConfigureServiceProxy("containerd"); err != nil {
+		t.Fatalf("ConfigureServiceProxy() error = %v", err)
+	}
+	if runner.Count("sudo tee /etc/systemd/system/containerd.service.d/http-proxy.conf") != 1 || runner.Count(`Environment="HTTPS_PROXY=http://proxy:3128"`) != 1 {
+		t.Errorf("ConfigureServiceProxy() ran %q", runner.Commands)
+	}
+
+	configs.System.HttpsProxy = ""
+	if err := ConfigureServiceProxy("containerd"); err != nil {
+		t.Fatalf("ConfigureServiceProxy() error = %v", err)
+	}
+	if runner.Count("sudo rm -f /etc/systemd/system/containerd.service.d/http-proxy.conf") != 1 || runner.Count("sudo systemctl daemon-reload") != 2 {
+		t.Errorf("ConfigureServiceProxy() without proxy ran %q", runner.Commands)
+	}
+}
@@ -0,0 +1,96 @@
+package system
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Identification of the Linux distribution, from os-release(5)
+type OsRelease struct {
+	Id              string   // e.g. "ubuntu", "rocky", "opensuse-leap"
+	IdLike          []string // e.g. ["rhel", "centos", "fedora"]
+	VersionId       string   // e.g. "22.04" (empty on rolling releases)
+	VersionCodename string   // e.g. "jammy"
+	PrettyName      string
+}
+
+// Paths of os-release, in order of precedence
+var osReleasePaths = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+// Parse os-release, which is a list of shell-compatible variable assignments
+func ParseOsRelease(reader io.Reader) (*OsRelease, error) {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(reader)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, rawValue, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: invalid assignment %q", lineNumber, line)
+		}
+		value, err := unquoteOsReleaseValue(rawValue)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		values[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	osRelease := &OsRelease{
+		Id:              strings.ToLower(values["ID"]),
+		IdLike:          strings.Fields(strings.ToLower(values["ID_LIKE"])),
+		VersionId:       values["VERSION_ID"],
+		VersionCodename: values["VERSION_CODENAME"],
+		PrettyName:      values["PRETTY_NAME"],
+	}
+	// ID defaults to "linux" according to os-release(5)
+	if len(osRelease.Id) == 0 {
+		osRelease.Id = "linux"
+	}
+	return osRelease, nil
+}
+
+// Unquote a value of os-release: either unquoted, or enclosed in double or single quotes
+func unquoteOsReleaseValue(rawValue string) (string, error) {
+	if len(rawValue) == 0 || (rawValue[0] != '"' && rawValue[0] != '\'') {
+		return rawValue, nil
+	}
+	quote := rawValue[0]
+	if len(rawValue) < 2 || rawValue[len(rawValue)-1] != quote {
+		return "", fmt.Errorf("unterminated quote in %s", rawValue)
+	}
+	quoted := rawValue[1 : len(rawValue)-1]
+	if quote == '\'' {
+		return quoted, nil
+	}
+	// Backslash escapes `"`, `\`, `$` & "`" within double quotes
+	value := new(strings.Builder)
+	for i := 0; i < len(quoted); i++ {
+		if quoted[i] == '\\' && i+1 < len(quoted) && strings.IndexByte("\"\\$`", quoted[i+1]) >= 0 {
+			i++
+		}
+		value.WriteByte(quoted[i])
+	}
+	return value.String(), nil
+}
+
+// Read os-release of the current system
+func ReadOsRelease() (*OsRelease, error) {
+	for _, osReleasePath := range osReleasePaths {
+		file, err := os.Open(osReleasePath)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return ParseOsRelease(file)
+	}
+	return nil, fmt.Errorf("none of %s exists", strings.Join(osReleasePaths, ", "))
+}
@@ -0,0 +1,85 @@
+package system
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+func TestParseOsRelease(t *testing.T) {
+	for description, test := range map[string]struct {
+		content string
+		want    OsRelease
+	}{
+		"ubuntu": {
+			content: `PRETTY_NAME="Ubuntu 22.04.2 LTS"
+NAME="Ubuntu"
+VERSION_ID="22.04"
+VERSION="22.04.2 LTS (Jammy Jellyfish)"
+VERSION_CODENAME=jammy
+ID=ubuntu
+ID_LIKE=debian
+`,
+			want: OsRelease{Id: "ubuntu", IdLike: []string{"debian"}, VersionId: "22.04", VersionCodename: "jammy", PrettyName: "Ubuntu 22.04.2 LTS"},
+		},
+		"rocky": {
+			content: `NAME="Rocky Linux"
+ID="rocky"
+ID_LIKE="rhel centos fedora"
+VERSION_ID="9.2"
+PRETTY_NAME="Rocky Linux 9.2 (Blue Onyx)"
+`,
+			want: OsRelease{Id: "rocky", IdLike: []string{"rhel", "centos", "fedora"}, VersionId: "9.2", PrettyName: "Rocky Linux 9.2 (Blue Onyx)"},
+		},
+		"quoting & comments": {
+			content: "# comment\n\nID='opensuse-tumbleweed'\nPRETTY_NAME=\"Say \\\"hi\\\" \\$HOME\"\n",
+			want:    OsRelease{Id: "opensuse-tumbleweed", PrettyName: `Say "hi" $HOME`},
+		},
+		"no ID": {
+			content: "NAME=Linux\n",
+			want:    OsRelease{Id: "linux"},
+		},
+	} {
+		osRelease, err := ParseOsRelease(strings.NewReader(test.content))
+		if err != nil {
+			t.Errorf("ParseOsRelease(%s) error = %v", description, err)
+			continue
+		}
+		if osRelease.Id != test.want.Id || strings.Join(osRelease.IdLike, " ") != strings.Join(test.want.IdLike, " ") ||
+			osRelease.VersionId != test.want.VersionId || osRelease.VersionCodename != test.want.VersionCodename || osRelease.PrettyName != test.want.PrettyName {
+			t.Errorf("ParseOsRelease(%s) = %+v, want %+v", description, osRelease, test.want)
+		}
+	}
+
+	for _, content := range []string{"ID=\"ubuntu\nVERSION_ID=22.04\n", "just some text\n"} {
+		if _, err := ParseOsRelease(strings.NewReader(content)); err == nil {
+			t.Errorf("ParseOsRelease(%q) should fail", content)
+		}
+	}
+}
+
+func TestCheckSupportMatrix(t *testing.T) {
+	defer func() { configs.System.CurrentOS, configs.System.CurrentOSVersion = "ubuntu", "" }()
+	for _, test := range []struct {
+		os          string
+		version     string
+		kubeVersion string
+		supported   bool
+	}{
+		{"ubuntu", "22.04", "1.25.9-00", true},
+		{"ubuntu", "20.04", "v1.27.2", true},
+		{"ubuntu", "22.04", "1.29.3", true},
+		{"centos", "7", "1.28.2", false},
+		{"ubuntu", "24.04", "1.25.9", false},
+		{"ubuntu", "22.04", "1.20.15", false},
+		{"rocky", "9.2", "1.25.9", true},
+		{"rocky", "92", "1.25.9", false},
+		{"opensuse-tumbleweed", "20230601", "1.26.5", true},
+	} {
+		configs.System.CurrentOS, configs.System.CurrentOSVersion = test.os, test.version
+		if err := CheckSupportMatrix(test.kubeVersion); (err == nil) != test.supported {
+			t.Errorf("CheckSupportMatrix(%s %s, %s) error = %v, want supported = %v", test.os, test.version, test.kubeVersion, err, test.supported)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+// Repository of system packages, signed by the key at KeyUrl
+type PackageRepo struct {
+	Name          string // Identifier of the repository, also used to name its key & source files
+	AptUrl        string // Base URL of the apt repository
+	AptSuite      string // e.g. "stable", or "/" for flat repositories
+	AptComponents string // e.g. "main" (empty for flat repositories)
+	RpmUrl        string // Base URL of the rpm repository (may contain $basearch), used by dnf, yum & zypper
+	KeyUrl        string // Public key of the repository (ASCII-armored or binary)
+	KeySignature  *Signature
+}
+
+// Package manager of a Linux distribution
+// Packages are always named as on Ubuntu, and mapped to the names of the distribution by `Install()`
+type PackageManager interface {
+	Name() string
+	// Import the key of repo and add it as a package source
+	AddRepo(repo *PackageRepo) error
+	// Install packages, given as `name` or as returned by `VersionedPackage()`
+	Install(packages ...string) error
+	// Prevent packages from being upgraded (or removed) by later transactions
+	Hold(packages ...string) error
+	// Allow held packages to be upgraded again
+	Unhold(packages ...string) error
+	// Remove installed packages
+	Remove(packages ...string) error
+	// Get the spec installing version of package name (version is given as on Ubuntu, e.g. 1.28.2-1.1, or without revision)
+	VersionedPackage(name string, version string) string
+	// Turn off automatic upgrades, which may replace held or manually installed components
+	DisableAutomaticUpgrade() error
+	// Make the package manager use the configured proxy
+	ConfigureProxy() error
+}
+
+// Get the package manager of the current OS, by its ID or else the distributions it is derived from
+func GetPackageManager() (PackageManager, error) {
+	for _, id := range append([]string{configs.System.CurrentOS}, configs.System.CurrentOSLike...) {
+		switch id {
+		case "ubuntu", "debian":
+			return &aptPackageManager{}, nil
+		case "rocky", "almalinux", "rhel", "fedora", "centos":
+			// yum on CentOS 7
+			if majorVersion, _, _ := strings.Cut(configs.System.CurrentOSVersion, "."); id == configs.System.CurrentOS && majorVersion == "7" {
+				return &rpmPackageManager{command: "yum", versionLockPackage: "yum-plugin-versionlock"}, nil
+			}
+			return &rpmPackageManager{command: "dnf", versionLockPackage: "python3-dnf-plugin-versionlock"}, nil
+		case "opensuse-leap", "opensuse-tumbleweed", "sles", "suse", "opensuse":
+			return &zypperPackageManager{}, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported Linux distribution: %s", configs.System.CurrentOS)
+}
+
+// Names of packages on rpm-based distributions (dnf, yum & zypper), only differences to Ubuntu are listed
+var rpmPackageNames = map[string][]string{
+	"build-essential":     {"gcc", "gcc-c++", "make"},
+	"apt-transport-https": {}, // Built into the package manager
+	"conntrack":           {"conntrack-tools"},
+}
+
+// Commands of packages, checked where no supported package manager can install them, only differences to the package names are listed
+var packageCommands = map[string][]string{
+	"build-essential":     {"gcc", "make"},
+	"apt-transport-https": {}, // No command
+	"ca-certificates":     {}, // No command
+}
+
+// Check that the commands of packages are installed already, where no supported package manager can install them
+func checkPackageCommands(packages []string) error {
+	var missingCommands []string
+	for _, command := range mapPackageNames(packageCommands, packages) {
+		if _, err := exec.LookPath(command); err != nil {
+			missingCommands = append(missingCommands, command)
+		}
+	}
+	if len(missingCommands) > 0 {
+		return fmt.Errorf("no supported package manager on %s to install %s, please install them first", configs.System.CurrentOS, strings.Join(missingCommands, ", "))
+	}
+	return nil
+}
+
+// Check that the install methods work without a package manager, where the distribution has no supported one
+func ValidatePackageManager() error {
+	if _, err := GetPackageManager(); err == nil {
+		return nil
+	}
+	var err error
+	if configs.System.KubeInstallMethod != KubeInstallBinary {
+		err = errors.Join(err, fmt.Errorf("-k8s-install-method: no supported package manager on %s, please use -k8s-install-method=binary", configs.System.CurrentOS))
+	}
+	if configs.System.ContainerRuntime == RuntimeCrio {
+		err = errors.Join(err, fmt.Errorf("-runtime: CRI-O is installed by the package manager, but none is supported on %s", configs.System.CurrentOS))
+	}
+	return err
+}
+
+func mapPackageNames(names map[string][]string, packages []string) []string {
+	var mappedPackages []string
+	for _, packageName := range packages {
+		if mappedNames, ok := names[packageName]; ok {
+			mappedPackages = append(mappedPackages, mappedNames...)
+		} else {
+			mappedPackages = append(mappedPackages, packageName)
+		}
+	}
+	return mappedPackages
+}
+
+// Run a package manager with sudo, passing the proxy settings (sudo drops them from the environment)
+func execSudoWithProxy(args ...string) (string, error) {
+	if !IsProxyConfigured() {
+		return ExecCmd("sudo", args...)
+	}
+	return ExecCmd("sudo", append(append([]string{"env"}, ProxyEnvironment()...), args...)...)
+}
+
+// Download the key of repo, verifying it if a signature is given
+func downloadRepoKey(repo *PackageRepo) (string, error) {
+	keyPath, err := DownloadToTmpDirWithSignature(repo.KeySignature, "", repo.KeyUrl)
+	if err != nil {
+		return "", fmt.Errorf("failed to download the key of %s: %w", repo.Name, err)
+	}
+	return keyPath, nil
+}
+
+// Package manager of Debian & Ubuntu
+type aptPackageManager struct{}
+
+func (apt *aptPackageManager) Name() string {
+	return "apt"
+}
+
+func (apt *aptPackageManager) AddRepo(repo *PackageRepo) error {
+	keyPath, err := downloadRepoKey(repo)
+	if err != nil {
+		return err
+	}
+	keyringPath := fmt.Sprintf("/etc/apt/keyrings/%s.gpg", repo.Name)
+	sourceListPath := fmt.Sprintf("/etc/apt/sources.list.d/%s.list", repo.Name)
+	if err := recordFileChanges(keyringPath, sourceListPath); err != nil {
+		return err
+	}
+	if _, err := ExecCmd("sudo", "mkdir", "-p", "/etc/apt/keyrings"); err != nil {
+		return err
+	}
+	// Binary keys are passed through unchanged
+	if _, err := ExecCmd("sudo", "gpg", "--batch", "--yes", "--dearmor", "--output", keyringPath, keyPath); err != nil {
+		return err
+	}
+	dpkgArch, err := ExecCmd("dpkg", "--print-architecture")
+	if err != nil {
+		return err
+	}
+	_, err = ExecCmdWithInput(
+		strings.TrimSpace(fmt.Sprintf("deb [arch=%s signed-by=%s] %s %s %s", dpkgArch, keyringPath, MirrorUrl(repo.AptUrl), repo.AptSuite, repo.AptComponents))+"\n",
+		"sudo", "tee", sourceListPath)
+	return err
+}
+
+func (apt *aptPackageManager) Install(packages ...string) error {
+	if IsBundleMode() {
+		return installBundlePackages(packages)
+	}
+	_, err := ExecCmd("sudo", "apt-get", "-qq", "update")
+	if err != nil {
+		return err
+	}
+	_, err = ExecCmd("sudo", append([]string{"apt-get", "-qq", "install", "-y", "--allow-downgrades"}, packages...)...)
+	return err
+}
+
+func (apt *aptPackageManager) Hold(packages ...string) error {
+	if err := RecordHoldChange(packages...); err != nil {
+		return err
+	}
+	_, err := ExecCmd("sudo", append([]string{"apt-mark", "hold"}, packages...)...)
+	return err
+}
+
+func (apt *aptPackageManager) Unhold(packages ...string) error {
+	_, err := ExecCmd("sudo", append([]string{"apt-mark", "unhold"}, packages...)...)
+	return err
+}
+
+func (apt *aptPackageManager) Remove(packages ...string) error {
+	_, err := ExecCmd("sudo", append([]string{"apt-get", "-qq", "remove", "-y"}, packages...)...)
+	return err
+}
+
+func (apt *aptPackageManager) VersionedPackage(name string, version string) string {
+	// Any revision of the upstream version
+	if !strings.Contains(version, "-") {
+		version += "-*"
+	}
+	return name + "=" + version
+}
+
+func (apt *aptPackageManager) DisableAutomaticUpgrade() error {
+	if _, err := os.Stat("/etc/apt/apt.conf.d/20auto-upgrades"); err != nil {
+		return nil
+	}
+	if err := RecordFileChange("/etc/apt/apt.conf.d/20auto-upgrades"); err != nil {
+		return err
+	}
+	_, err := ExecShellCmd("sudo sed -i 's/\"1\"/\"0\"/g' /etc/apt/apt.conf.d/20auto-upgrades")
+	return err
+}
+
+// apt ignores the environment under sudo, so proxy settings are written to its config (removed if no proxy is configured)
+func (apt *aptPackageManager) ConfigureProxy() error {
+	const aptProxyConfigPath = "/etc/apt/apt.conf.d/95easy-openyurt-proxy"
+	if err := RecordFileChange(aptProxyConfigPath); err != nil {
+		return err
+	}
+	if !IsProxyConfigured() {
+		_, err := ExecCmd("sudo", "rm", "-f", aptProxyConfigPath)
+		return err
+	}
+	aptProxyConfig := ""
+	if len(configs.System.HttpProxy) > 0 {
+		aptProxyConfig += fmt.Sprintf("Acquire::http::Proxy %q;\n", configs.System.HttpProxy)
+	}
+	if len(configs.System.HttpsProxy) > 0 {
+		aptProxyConfig += fmt.Sprintf("Acquire::https::Proxy %q;\n", configs.System.HttpsProxy)
+	}
+	_, err := ExecCmdWithInput(aptProxyConfig, "sudo", "tee", aptProxyConfigPath)
+	return err
+}
+
+// Write an rpm-md repository file, shared by dnf, yum & zypper
+func writeRpmRepo(repo *PackageRepo, repoDir string, keyPath string) error {
+	repoPath := fmt.Sprintf("%s/%s.repo", repoDir, repo.Name)
+	if err := RecordFileChange(repoPath); err != nil {
+		return err
+	}
+	_, err := ExecCmdWithInput(
+		fmt.Sprintf("[%s]\nname=%s\nbaseurl=%s\nenabled=1\ntype=rpm-md\nautorefresh=1\ngpgcheck=1\nrepo_gpgcheck=0\ngpgkey=file://%s\n",
+			repo.Name, repo.Name, MirrorUrl(repo.RpmUrl), keyPath),
+		"sudo", "tee", repoPath)
+	return err
+}
+
+// Import the key of repo into the rpm database, and keep a copy for the repository file
+func importRpmKey(repo *PackageRepo) (string, error) {
+	keyPath, err := downloadRepoKey(repo)
+	if err != nil {
+		return "", err
+	}
+	installedKeyPath := "/etc/pki/rpm-gpg/RPM-GPG-KEY-" + repo.Name
+	if err := RecordFileChange(installedKeyPath); err != nil {
+		return "", err
+	}
+	if _, err := ExecCmd("sudo", "install", "-D", "-m", "644", keyPath, installedKeyPath); err != nil {
+		return "", err
+	}
+	_, err = ExecCmd("sudo", "rpm", "--import", installedKeyPath)
+	return installedKeyPath, err
+}
+
+// Strip the Debian revision of a version (1.25.9-00 => 1.25.9)
+func upstreamVersion(version string) string {
+	upstream, _, _ := strings.Cut(version, "-")
+	return upstream
+}
+
+// Package manager of Rocky Linux & CentOS (dnf, or yum on CentOS 7)
+type rpmPackageManager struct {
+	command            string
+	versionLockPackage string
+}
+
+func (rpm *rpmPackageManager) Name() string {
+	return rpm.command
+}
+
+func (rpm *rpmPackageManager) AddRepo(repo *PackageRepo) error {
+	keyPath, err := importRpmKey(repo)
+	if err != nil {
+		return err
+	}
+	return writeRpmRepo(repo, "/etc/yum.repos.d", keyPath)
+}
+
+func (rpm *rpmPackageManager) Install(packages ...string) error {
+	if IsBundleMode() {
+		return fmt.Errorf("bundles only contain apt packages, %s is not supported", rpm.command)
+	}
+	_, err := execSudoWithProxy(append([]string{rpm.command, "-y", "-q", "install"}, mapPackageNames(rpmPackageNames, packages)...)...)
+	return err
+}
+
+func (rpm *rpmPackageManager) Hold(packages ...string) error {
+	if err := rpm.Install(rpm.versionLockPackage); err != nil {
+		return err
+	}
+	if err := RecordHoldChange(packages...); err != nil {
+		return err
+	}
+	_, err := ExecCmd("sudo", append([]string{rpm.command, "-q", "versionlock", "add"}, packages...)...)
+	return err
+}
+
+func (rpm *rpmPackageManager) Unhold(packages ...string) error {
+	_, err := ExecCmd("sudo", append([]string{rpm.command, "-q", "versionlock", "delete"}, packages...)...)
+	return err
+}
+
+func (rpm *rpmPackageManager) Remove(packages ...string) error {
+	_, err := ExecCmd("sudo", append([]string{rpm.command, "-y", "-q", "remove"}, mapPackageNames(rpmPackageNames, packages)...)...)
+	return err
+}
+
+func (rpm *rpmPackageManager) VersionedPackage(name string, version string) string {
+	return name + "-" + upstreamVersion(version)
+}
+
+func (rpm *rpmPackageManager) DisableAutomaticUpgrade() error {
+	// Installed & enabled by dnf-automatic only
+	if err := RecordServiceChange("dnf-automatic.timer", "dnf-automatic-install.timer", "yum-cron"); err != nil {
+		return err
+	}
+	_, err := ExecShellCmd("sudo systemctl disable --now dnf-automatic.timer dnf-automatic-install.timer yum-cron 2>/dev/null || true")
+	return err
+}
+
+// dnf & yum read the proxy from the environment, which is passed through sudo by `execSudoWithProxy()`
+func (rpm *rpmPackageManager) ConfigureProxy() error {
+	return nil
+}
+
+// Package manager of openSUSE
+type zypperPackageManager struct{}
+
+func (zypper *zypperPackageManager) Name() string {
+	return "zypper"
+}
+
+func (zypper *zypperPackageManager) AddRepo(repo *PackageRepo) error {
+	keyPath, err := importRpmKey(repo)
+	if err != nil {
+		return err
+	}
+	if err := writeRpmRepo(repo, "/etc/zypp/repos.d", keyPath); err != nil {
+		return err
+	}
+	_, err = execSudoWithProxy("zypper", "--non-interactive", "--quiet", "refresh", repo.Name)
+	return err
+}
+
+func (zypper *zypperPackageManager) Install(packages ...string) error {
+	if IsBundleMode() {
+		return fmt.Errorf("bundles only contain apt packages, zypper is not supported")
+	}
+	_, err := execSudoWithProxy(append([]string{"zypper", "--non-interactive", "--quiet", "install", "--oldpackage"}, mapPackageNames(rpmPackageNames, packages)...)...)
+	return err
+}
+
+func (zypper *zypperPackageManager) Hold(packages ...string) error {
+	if err := RecordHoldChange(packages...); err != nil {
+		return err
+	}
+	_, err := ExecCmd("sudo", append([]string{"zypper", "--non-interactive", "--quiet", "addlock"}, packages...)...)
+	return err
+}
+
+func (zypper *zypperPackageManager) Unhold(packages ...string) error {
+	_, err := ExecCmd("sudo", append([]string{"zypper", "--non-interactive", "--quiet", "removelock"}, packages...)...)
+	return err
+}
+
+func (zypper *zypperPackageManager) Remove(packages ...string) error {
+	_, err := ExecCmd("sudo", append([]string{"zypper", "--non-interactive", "--quiet", "remove"}, mapPackageNames(rpmPackageNames, packages)...)...)
+	return err
+}
+
+func (zypper *zypperPackageManager) VersionedPackage(name string, version string) string {
+	return name + "=" + upstreamVersion(version)
+}
+
+func (zypper *zypperPackageManager) DisableAutomaticUpgrade() error {
+	// Installed & enabled by openSUSE's automatic update tools only
+	if err := RecordServiceChange("transactional-update.timer", "packagekit-background.timer"); err != nil {
+		return err
+	}
+	_, err := ExecShellCmd("sudo systemctl disable --now transactional-update.timer packagekit-background.timer 2>/dev/null || true")
+	return err
+}
+
+// zypper reads the proxy from the environment, which is passed through sudo by `execSudoWithProxy()`
+func (zypper *zypperPackageManager) ConfigureProxy() error {
+	return nil
+}
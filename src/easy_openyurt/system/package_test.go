@@ -0,0 +1,128 @@
+package system
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+func TestSystemInitWithPackageManagers(t *testing.T) {
+	for os, patterns := range map[string][]string{
+		"rocky 9.2": {
+			"sudo rpm --import /etc/pki/rpm-gpg/RPM-GPG-KEY-kubernetes",
+			"sudo tee /etc/yum.repos.d/kubernetes.repo",
+			"sudo dnf -y -q install git wget curl gcc gcc-c++ make ca-certificates",
+			"sudo dnf -y -q install kubeadm-1.25.9 kubelet-1.25.9 kubectl-1.25.9",
+			"sudo dnf -y -q install python3-dnf-plugin-versionlock",
+			"sudo dnf -q versionlock add kubelet kubeadm kubectl",
+		},
+		"centos 7": {
+			"sudo yum -y -q install kubeadm-1.25.9 kubelet-1.25.9 kubectl-1.25.9",
+			"sudo yum -q versionlock add kubelet kubeadm kubectl",
+		},
+		"opensuse-leap 15.5": {
+			"sudo tee /etc/zypp/repos.d/kubernetes.repo",
+			"sudo zypper --non-interactive --quiet refresh kubernetes",
+			"sudo zypper --non-interactive --quiet install --oldpackage kubeadm=1.25.9 kubelet=1.25.9 kubectl=1.25.9",
+			"sudo zypper --non-interactive --quiet addlock kubelet kubeadm kubectl",
+		},
+	} {
+		fakeRunner := useFakeSystemInit(t)
+		configs.System.CurrentOS, configs.System.CurrentOSVersion, _ = strings.Cut(os, " ")
+
+		SystemInit()
+
+		for _, pattern := range patterns {
+			if !fakeRunner.Executed(pattern) {
+				t.Errorf("SystemInit(%s) did not execute %q\n%v", os, pattern, fakeRunner)
+			}
+		}
+		if fakeRunner.Executed("apt") || fakeRunner.Executed("deb/Release.key") {
+			t.Errorf("SystemInit(%s) should not use apt\n%v", os, fakeRunner)
+		}
+		if !fakeRunner.Executed("https://pkgs.k8s.io/core:/stable:/v1.25/rpm/repodata/repomd.xml.key") {
+			t.Errorf("SystemInit(%s) did not download the key of the pkgs.k8s.io rpm repository\n%v", os, fakeRunner)
+		}
+	}
+}
+
+func TestPackageManagerPassesProxy(t *testing.T) {
+	fakeRunner := useFakeRunner(t)
+	configs.System.CurrentOS = "rocky"
+	configs.System.HttpsProxy = "http://proxy.example.com:3128"
+	defer func() {
+		configs.System.CurrentOS = "ubuntu"
+		configs.System.HttpsProxy = ""
+	}()
+
+	if err := InstallPackages("build-essential apt-transport-https"); err != nil {
+		t.Fatalf("InstallPackages() error = %v", err)
+	}
+	if len(fakeRunner.Commands) != 1 || !strings.HasPrefix(fakeRunner.Commands[0], "sudo env ") ||
+		!strings.Contains(fakeRunner.Commands[0], "HTTPS_PROXY=http://proxy.example.com:3128") ||
+		!strings.HasSuffix(fakeRunner.Commands[0], " dnf -y -q install gcc gcc-c++ make") {
+		t.Errorf("InstallPackages() ran %q", fakeRunner.Commands)
+	}
+}
+
+func TestGetPackageManager(t *testing.T) {
+	defer func() {
+		configs.System.CurrentOS, configs.System.CurrentOSVersion, configs.System.CurrentOSLike = "ubuntu", "", nil
+	}()
+	for _, test := range []struct {
+		os       string
+		version  string
+		like     []string
+		wantName string
+	}{
+		{"ubuntu", "22.04", []string{"debian"}, "apt"},
+		{"centos", "8", []string{"rhel", "fedora"}, "dnf"},
+		{"centos", "7", []string{"rhel", "fedora"}, "yum"},
+		{"ol", "9.2", []string{"fedora"}, "dnf"}, // Derived distributions fall back to ID_LIKE
+		{"opensuse-leap", "15.5", []string{"suse", "opensuse"}, "zypper"},
+		{"arch", "", nil, ""},
+	} {
+		configs.System.CurrentOS, configs.System.CurrentOSVersion, configs.System.CurrentOSLike = test.os, test.version, test.like
+		packageManager, err := GetPackageManager()
+		if len(test.wantName) == 0 {
+			if err == nil {
+				t.Errorf("GetPackageManager(%s) should fail", test.os)
+			}
+		} else if err != nil || packageManager.Name() != test.wantName {
+			t.Errorf("GetPackageManager(%s %s) = %v, %v, want %s", test.os, test.version, packageManager, err, test.wantName)
+		}
+	}
+}
+
+func TestWithoutPackageManager(t *testing.T) {
+	fakeRunner := useFakeRunner(t)
+	configs.System.CurrentOS = "arch"
+	defer func() {
+		configs.System.CurrentOS = "ubuntu"
+		configs.System.KubeInstallMethod, configs.System.ContainerRuntime = KubeInstallPackage, RuntimeContainerd
+	}()
+
+	if err := ValidatePackageManager(); err == nil || !strings.Contains(err.Error(), "-k8s-install-method=binary") {
+		t.Errorf("ValidatePackageManager(arch, package) = %v, should ask for -k8s-install-method=binary", err)
+	}
+	configs.System.KubeInstallMethod = KubeInstallBinary
+	if err := ValidatePackageManager(); err != nil {
+		t.Errorf("ValidatePackageManager(arch, binary) error = %v", err)
+	}
+	configs.System.ContainerRuntime = RuntimeCrio
+	if err := ValidatePackageManager(); err == nil {
+		t.Errorf("ValidatePackageManager(arch, crio) should fail")
+	}
+
+	// Dependencies have to be installed by hand
+	if err := InstallPackages("sh ca-certificates"); err != nil {
+		t.Errorf("InstallPackages(sh ca-certificates) without package manager error = %v", err)
+	}
+	if err := InstallPackages("sh easy-openyurt-missing"); err == nil || !strings.Contains(err.Error(), "easy-openyurt-missing") || strings.Contains(err.Error(), "sh,") {
+		t.Errorf("InstallPackages(easy-openyurt-missing) without package manager = %v, should report the missing command", err)
+	}
+	if len(fakeRunner.Commands) > 0 {
+		t.Errorf("InstallPackages() without package manager should not execute anything\n%v", fakeRunner)
+	}
+}
@@ -0,0 +1,153 @@
+package system
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+// Ways of adding installed tools to PATH
+const (
+	PathModeProfile = "profile" // List their directories in the managed shell profile
+	PathModeSymlink = "symlink" // Link their executables into pathLinkDir
+)
+
+// Directory in PATH of every user, receiving links with `-path-mode=symlink`
+var pathLinkDir = "/usr/local/bin"
+
+// Command of the managed shell profile adding a directory to PATH
+const profileAddPathCommand = "easy_openyurt_add_path"
+
+// Add parameters on how installed tools are added to PATH to flag set
+func AddPathFlags(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&configs.System.PathMode, "path-mode", configs.System.PathMode, "Add installed tools to PATH by listing them in the managed shell profile (profile) or by linking them into "+pathLinkDir+" (symlink)")
+	flagSet.StringVar(&configs.System.ProfilePath, "profile", configs.System.ProfilePath, "Managed shell profile, sourced by login shells of all users")
+}
+
+// Validate parameters added by `AddPathFlags()`
+func ValidatePathFlags() error {
+	return ValidateChoice("path-mode", configs.System.PathMode, PathModeProfile, PathModeSymlink)
+}
+
+// Get the directories listed in the managed shell profile
+func profileDirs() []string {
+	content, err := os.ReadFile(configs.System.ProfilePath)
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if dir, ok := strings.CutPrefix(line, profileAddPathCommand+" "); ok {
+			if strings.HasPrefix(dir, "'") {
+				dir = strings.ReplaceAll(strings.Trim(dir, "'"), `'\''`, "'")
+			}
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// Get the managed shell profile adding dirs to PATH, for sh, bash & zsh
+func ShellProfile(dirs []string) string {
+	profile := "# Managed by easy_openyurt, rewritten whenever a tool is installed\n"
+	profile += profileAddPathCommand + "() {\n"
+	profile += "\tcase \":$PATH:\" in\n\t*\":$1:\"*) ;;\n\t*) PATH=\"$PATH:$1\" ;;\n\tesac\n}\n"
+	for _, dir := range dirs {
+		profile += profileAddPathCommand + " " + ShellQuote(dir) + "\n"
+	}
+	profile += "unset -f " + profileAddPathCommand + "\nexport PATH\n"
+	return profile
+}
+
+// Get the managed shell profile with dir added, dropping directories that are gone (e.g. of former istio versions)
+func managedProfileWith(dir string) string {
+	var dirs []string
+	for _, listedDir := range profileDirs() {
+		if _, err := os.Stat(listedDir); err == nil && listedDir != dir {
+			dirs = append(dirs, listedDir)
+		}
+	}
+	return ShellProfile(append(dirs, dir))
+}
+
+// Add directory to PATH of all users, by the managed shell profile or links to its executables (see `-path-mode`)
+func AppendDirToPath(pathTemplate string, pars ...any) error {
+	dir := fmt.Sprintf(pathTemplate, pars...)
+	if err := removeLegacyPathLines(dir); err != nil {
+		return err
+	}
+	if configs.System.PathMode == PathModeSymlink {
+		return linkDirToPath(dir)
+	}
+
+	// Rewrite the managed shell profile
+	if err := RecordFileChange(configs.System.ProfilePath); err != nil {
+		return err
+	}
+	if _, err := ExecCmd("sudo", "mkdir", "-p", path.Dir(configs.System.ProfilePath)); err != nil {
+		return err
+	}
+	if _, err := ExecCmdWithInput(managedProfileWith(dir), "sudo", "tee", configs.System.ProfilePath); err != nil {
+		return err
+	}
+
+	// zsh does not read /etc/profile.d, so its profile of the current user sources the managed one
+	if _, err := exec.LookPath("zsh"); err == nil {
+		zshrc := path.Join(configs.System.UserHomeDir, ".zshrc")
+		sourceLine := fmt.Sprintf("[ -f %s ] && . %s", ShellQuote(configs.System.ProfilePath), ShellQuote(configs.System.ProfilePath))
+		if err := RecordLineChange(zshrc, sourceLine); err != nil {
+			return err
+		}
+		_, err = ExecShellCmd("grep -qxF %s %s 2>/dev/null || echo %s >> %s", ShellQuote(sourceLine), ShellQuote(zshrc), ShellQuote(sourceLine), ShellQuote(zshrc))
+		return err
+	}
+	return nil
+}
+
+// Link the executables of dir into pathLinkDir
+func linkDirToPath(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		// Not installed in dry-run mode
+		if IsDryRun() {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		if info, err := os.Stat(path.Join(dir, entry.Name())); err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+			continue
+		}
+		link := path.Join(pathLinkDir, entry.Name())
+		if err = RecordFileChange(link); err != nil {
+			return err
+		}
+		if _, err = ExecCmd("sudo", "ln", "-sfn", path.Join(dir, entry.Name()), link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove the lines adding dir to PATH, appended to ~/.bashrc & ~/.zshrc by earlier versions on every run
+func removeLegacyPathLines(dir string) error {
+	legacyLine := "export PATH=$PATH:" + dir
+	for _, rcFile := range []string{".bashrc", ".zshrc"} {
+		rcPath := path.Join(configs.System.UserHomeDir, rcFile)
+		if !fileHasLine(rcPath, legacyLine) {
+			continue
+		}
+		if err := RecordFileChange(rcPath); err != nil {
+			return err
+		}
+		if _, err := ExecCmd("sed", "-i", "\\|^"+sedPattern(legacyLine)+"$|d", rcPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package system
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+func TestShellProfile(t *testing.T) {
+	profilePath := t.TempDir() + "/easy_openyurt.sh"
+	os.WriteFile(profilePath, []byte(ShellProfile([]string{"/usr/local/go/bin", "/opt/it's here/bin"})), 0644)
+
+	// Sourcing the profile again does not extend PATH again
+	stdout, err := (&LocalRunner{}).Run(context.Background(), &Command{Shell: "PATH=/usr/bin:/bin; . " + ShellQuote(profilePath) + "; . " + ShellQuote(profilePath) + "; echo \"$PATH\""})
+	if want := "/usr/bin:/bin:/usr/local/go/bin:/opt/it's here/bin"; err != nil || stdout != want {
+		t.Errorf("sourcing ShellProfile() twice sets PATH = %q, %v, want %q", stdout, err, want)
+	}
+}
+
+func TestAppendDirToPath(t *testing.T) {
+	fakeRunner := useFakeRunner(t)
+	existingDir := t.TempDir()
+	previousProfilePath := configs.System.ProfilePath
+	configs.System.ProfilePath = t.TempDir() + "/easy_openyurt.sh"
+	configs.System.UserHomeDir = t.TempDir()
+	defer func() { configs.System.ProfilePath, configs.System.PathMode = previousProfilePath, PathModeProfile }()
+
+	// Directories are kept in order, those gone are dropped
+	os.WriteFile(configs.System.ProfilePath, []byte(ShellProfile([]string{"/usr/local/istio-1.15.0/bin", existingDir, "/usr/local/go/bin"})), 0644)
+	if profile, want := managedProfileWith("/usr/local/go/bin"), ShellProfile([]string{existingDir, "/usr/local/go/bin"}); profile != want {
+		t.Errorf("managedProfileWith(/usr/local/go/bin) = %q, want %q", profile, want)
+	}
+
+	// Lines appended by earlier versions are removed
+	os.WriteFile(configs.System.UserHomeDir+"/.bashrc", []byte("alias ll='ls -l'\nexport PATH=$PATH:/usr/local/go/bin\nexport PATH=$PATH:/usr/local/go/bin\n"), 0644)
+	if err := AppendDirToPath("/usr/local/go/bin"); err != nil {
+		t.Fatalf("AppendDirToPath() error = %v", err)
+	}
+	for _, pattern := range []string{
+		"sed -i '\\|^export PATH=\\$PATH:/usr/local/go/bin$|d' " + configs.System.UserHomeDir + "/.bashrc",
+		"sudo tee " + configs.System.ProfilePath,
+	} {
+		if !fakeRunner.Executed(pattern) {
+			t.Errorf("AppendDirToPath() did not execute %q\n%v", pattern, fakeRunner)
+		}
+	}
+	if _, err := exec.LookPath("zsh"); (err == nil) != fakeRunner.Executed(". "+configs.System.ProfilePath+"' >> "+configs.System.UserHomeDir+"/.zshrc") {
+		t.Errorf("AppendDirToPath() should only source the profile in .zshrc with zsh installed\n%v", fakeRunner)
+	}
+
+	// Only executables are linked
+	configs.System.PathMode = PathModeSymlink
+	os.WriteFile(existingDir+"/istioctl", []byte("#!/bin/sh\n"), 0755)
+	os.WriteFile(existingDir+"/README", []byte("istio\n"), 0644)
+	fakeRunner.Commands = nil
+	if err := AppendDirToPath(existingDir); err != nil {
+		t.Fatalf("AppendDirToPath(-path-mode=symlink) error = %v", err)
+	}
+	if commands := strings.Join(fakeRunner.Commands, "\n"); commands != "sudo ln -sfn "+existingDir+"/istioctl /usr/local/bin/istioctl" {
+		t.Errorf("AppendDirToPath(-path-mode=symlink) executed %q", commands)
+	}
+}
@@ -0,0 +1,328 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
+)
+
+// Kinds of changes to the node, undone by `system reset`
+const (
+	ChangeFile      = "file"      // File modified (restored from its backup) or created (removed)
+	ChangeLine      = "line"      // Line appended to a file
+	ChangeHold      = "hold"      // Packages held
+	ChangeService   = "service"   // Services disabled
+	ChangeComponent = "component" // Component installed, only removed on request
+	ChangeSysctl    = "sysctl"    // Live sysctl value changed, restored with `sysctl -w`
+)
+
+// Change to the node recorded in the state journal
+type ChangeRecord struct {
+	Kind   string   `json:"kind"`
+	Path   string   `json:"path,omitempty"`
+	Backup string   `json:"backup,omitempty"` // Copy of the original file, empty if the file was created
+	Line   string   `json:"line,omitempty"`
+	Names  []string `json:"names,omitempty"` // Packages, services, the component or the sysctl
+	Paths  []string `json:"paths,omitempty"` // Files of the component, removed instead of its whole directory (cni-plugins only)
+	Value  string   `json:"value,omitempty"` // Original live value (sysctl only)
+}
+
+func (change *ChangeRecord) String() string {
+	switch change.Kind {
+	case ChangeFile:
+		if len(change.Backup) == 0 {
+			return "created " + change.Path
+		}
+		return "modified " + change.Path
+	case ChangeLine:
+		return fmt.Sprintf("appended %q to %s", change.Line, change.Path)
+	default:
+		return fmt.Sprintf("%s %s", change.Kind, strings.Join(change.Names, " "))
+	}
+}
+
+// Record a change in the journal of the current subcommand (if any), once
+func recordChange(change *ChangeRecord) error {
+	if stateJournal == nil {
+		return nil
+	}
+	for _, recorded := range stateJournal.Changes {
+		if recorded.String() == change.String() {
+			return nil
+		}
+	}
+	stateJournal.Changes = append(stateJournal.Changes, change)
+	return saveStateJournal()
+}
+
+// Get the directory of backups of files modified on the node
+func backupDir() string {
+	return path.Join(path.Dir(configs.System.StatePath), "backup")
+}
+
+// Record a file about to be written, backing up the original the first time
+func RecordFileChange(filePath string) error {
+	if stateJournal == nil {
+		return nil
+	}
+	for _, recorded := range stateJournal.Changes {
+		if recorded.Kind == ChangeFile && recorded.Path == filePath {
+			return nil
+		}
+	}
+	change := &ChangeRecord{Kind: ChangeFile, Path: filePath}
+	if _, err := os.Lstat(filePath); err == nil {
+		change.Backup = path.Join(backupDir(), filePath)
+		if _, err = ExecCmd("sudo", "mkdir", "-p", path.Dir(change.Backup)); err != nil {
+			return err
+		}
+		if _, err = ExecCmd("sudo", "cp", "-a", filePath, change.Backup); err != nil {
+			return err
+		}
+	}
+	return recordChange(change)
+}
+
+// Whether the file has the line
+func fileHasLine(filePath string, line string) bool {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return false
+	}
+	for _, existingLine := range strings.Split(string(content), "\n") {
+		if existingLine == line {
+			return true
+		}
+	}
+	return false
+}
+
+// Record a line about to be appended to a file, unless the file has it already
+func RecordLineChange(filePath string, line string) error {
+	if fileHasLine(filePath, line) {
+		return nil
+	}
+	return recordChange(&ChangeRecord{Kind: ChangeLine, Path: filePath, Line: line})
+}
+
+// Record files about to be written
+func recordFileChanges(filePaths ...string) error {
+	for _, filePath := range filePaths {
+		if err := RecordFileChange(filePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Record packages held against upgrades
+func RecordHoldChange(packages ...string) error {
+	return recordChange(&ChangeRecord{Kind: ChangeHold, Names: packages})
+}
+
+// Record the services that are enabled now, before they are disabled
+func RecordServiceChange(services ...string) error {
+	var enabledServices []string
+	for _, service := range services {
+		if _, err := ExecCmd("systemctl", "is-enabled", "--quiet", service); err == nil {
+			enabledServices = append(enabledServices, service)
+		}
+	}
+	if len(enabledServices) == 0 {
+		return nil
+	}
+	return recordChange(&ChangeRecord{Kind: ChangeService, Names: enabledServices})
+}
+
+// Record a component installed by `SystemInit()`, with its files if they share a directory with files of others
+func RecordComponentChange(component string, paths ...string) error {
+	return recordChange(&ChangeRecord{Kind: ChangeComponent, Names: []string{component}, Paths: paths})
+}
+
+// Record a component about to be installed at installPath, unless it replaces an existing installation there
+// Upgrades are not recorded, so that `system reset -remove-components` never removes what the node had before
+func recordComponentInstall(component string, installPath string) error {
+	if _, err := os.Lstat(checkRootDir + installPath); err == nil {
+		if logs.CommonLog != nil {
+			logs.CommonLog.Printf("Replacing the existing %s in place, it is kept by `system reset -remove-components`\n", installPath)
+		}
+		return nil
+	}
+	return RecordComponentChange(component)
+}
+
+// Record the files about to be extracted from archive into dirPath which do not exist yet
+func recordArchiveInstall(component string, archivePath string, dirPath string) error {
+	entries, err := ExecCmd("tar", "-tf", archivePath)
+	if err != nil {
+		return err
+	}
+	var paths []string
+	for _, entry := range strings.Split(entries, "\n") {
+		if len(strings.TrimSpace(entry)) == 0 || strings.HasSuffix(entry, "/") {
+			continue
+		}
+		filePath := path.Join(dirPath, entry)
+		if _, err := os.Lstat(checkRootDir + filePath); err == nil {
+			continue
+		}
+		paths = append(paths, filePath)
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	return RecordComponentChange(component, paths...)
+}
+
+// Record the live value of a sysctl about to be changed, the first time
+func RecordSysctlChange(key string, value string) error {
+	return recordChange(&ChangeRecord{Kind: ChangeSysctl, Names: []string{key}, Value: value})
+}
+
+// Whether undoing the change needs the package manager
+func (change *ChangeRecord) needsPackageManager() bool {
+	return change.Kind == ChangeHold || (change.Kind == ChangeComponent && (change.Names[0] == "cri-o" || change.Names[0] == "kubernetes-packages"))
+}
+
+// Remove the component, as installed by `SystemInit()`
+func removeComponent(packageManager PackageManager, change *ChangeRecord) error {
+	var err error
+	switch component := change.Names[0]; component {
+	case "go":
+		_, err = ExecCmd("sudo", "rm", "-rf", goRootDir)
+	case "containerd":
+		_, err = ExecShellCmd("sudo systemctl disable --now containerd 2>/dev/null; sudo rm -f /usr/local/bin/containerd /usr/local/bin/containerd-shim /usr/local/bin/containerd-shim-runc-v1 /usr/local/bin/containerd-shim-runc-v2 /usr/local/bin/containerd-stress /usr/local/bin/ctr /lib/systemd/system/containerd.service")
+	case "runc":
+		_, err = ExecCmd("sudo", "rm", "-f", "/usr/local/sbin/runc")
+	case "cni-plugins":
+		// Plugins of others (e.g. Calico or Flannel) share the directory
+		if len(change.Paths) > 0 {
+			_, err = ExecCmd("sudo", append([]string{"rm", "-f"}, change.Paths...)...)
+		}
+	case "cri-o":
+		if _, err = ExecShellCmd("sudo systemctl disable --now crio 2>/dev/null || true"); err == nil {
+			err = packageManager.Remove("cri-o")
+		}
+	case "kubernetes-packages":
+		err = packageManager.Remove("kubeadm", "kubelet", "kubectl")
+	case "cosign":
+		_, err = ExecCmd("sudo", "rm", "-f", cosignPath)
+	case "kubernetes-binaries":
+		_, err = ExecShellCmd("sudo systemctl disable --now kubelet 2>/dev/null; sudo rm -rf %s %s %s %s /etc/systemd/system/kubelet.service /etc/systemd/system/kubelet.service.d",
+			ShellQuote(kubeBinaryDir+"/kubeadm"), ShellQuote(kubeBinaryDir+"/kubelet"), ShellQuote(kubeBinaryDir+"/kubectl"), ShellQuote(kubeBinaryDir+"/crictl"))
+	default:
+		err = fmt.Errorf("unknown component %s", component)
+	}
+	return err
+}
+
+// Undo a change other than installing a component
+func undoChange(packageManager PackageManager, change *ChangeRecord) error {
+	var err error
+	switch change.Kind {
+	case ChangeFile:
+		if len(change.Backup) == 0 {
+			_, err = ExecCmd("sudo", "rm", "-rf", change.Path)
+		} else {
+			_, err = ExecCmd("sudo", "cp", "-a", change.Backup, change.Path)
+		}
+	case ChangeLine:
+		// Keep the file if it is gone, e.g. with the home directory
+		_, err = ExecShellCmd("if [ -f %s ]; then sed -i %s %s; fi", ShellQuote(change.Path), ShellQuote("\\|^"+sedPattern(change.Line)+"$|d"), ShellQuote(change.Path))
+	case ChangeHold:
+		err = packageManager.Unhold(change.Names...)
+	case ChangeService:
+		_, err = ExecCmd("sudo", append([]string{"systemctl", "enable", "--now"}, change.Names...)...)
+	case ChangeSysctl:
+		_, err = ExecCmd("sudo", "sysctl", "--quiet", "-w", change.Names[0]+"="+change.Value)
+	default:
+		err = fmt.Errorf("unknown change %s", change.Kind)
+	}
+	return err
+}
+
+// Escape a literal line as basic regular expression of sed (delimited by |)
+func sedPattern(line string) string {
+	var escaped strings.Builder
+	for _, r := range line {
+		if strings.ContainsRune(`\.*[]^$|`, r) {
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
+
+// Undo the changes `SystemInit()` recorded in the state journal, in reverse order
+// Held packages are released first, installed components are only removed with removeComponents
+func SystemReset(removeComponents bool) error {
+	journal, err := LoadStateJournal()
+	if err != nil {
+		return err
+	}
+	if len(journal.Changes) == 0 {
+		logs.WarnPrintf("No changes recorded in %s, nothing to reset!\n", configs.System.StatePath)
+		return nil
+	}
+	// Without a supported package manager, no packages were installed or held
+	packageManager, err := GetPackageManager()
+	for _, change := range journal.Changes {
+		if err != nil && change.needsPackageManager() {
+			return err
+		}
+	}
+
+	var changes []*ChangeRecord
+	for i := len(journal.Changes) - 1; i >= 0; i-- {
+		changes = append(changes, journal.Changes[i])
+	}
+	undoPhase := func(phase func(change *ChangeRecord) bool) {
+		for _, change := range changes {
+			if !phase(change) {
+				continue
+			}
+			logs.WaitPrintf("Undoing: %s", change)
+			if change.Kind == ChangeComponent {
+				err = removeComponent(packageManager, change)
+			} else {
+				err = undoChange(packageManager, change)
+			}
+			logs.CheckErrorWithTagAndMsg(err, "Failed to undo: %s!\n", change)
+		}
+	}
+	// Release held packages first, so that they can be removed
+	undoPhase(func(change *ChangeRecord) bool { return change.Kind == ChangeHold })
+	undoPhase(func(change *ChangeRecord) bool { return change.Kind == ChangeComponent && removeComponents })
+	undoPhase(func(change *ChangeRecord) bool {
+		return change.Kind != ChangeHold && change.Kind != ChangeComponent && change.Kind != ChangeSysctl
+	})
+	if !removeComponents {
+		for _, change := range changes {
+			if change.Kind == ChangeComponent {
+				logs.InfoPrintf("Kept %s (see -remove-components)\n", change.Names[0])
+			}
+		}
+	}
+
+	// Apply the restored settings, then the live values sysctls had before `system init`
+	logs.WaitPrintf("Applying restored settings")
+	_, err = ExecShellCmd("sudo systemctl daemon-reload && sudo swapon -a && sudo sysctl --quiet --system")
+	logs.CheckErrorWithTagAndMsg(err, "Failed to apply restored settings!\n")
+	undoPhase(func(change *ChangeRecord) bool { return change.Kind == ChangeSysctl })
+
+	// The node is back to its original state, later runs start from scratch
+	logs.WaitPrintf("Removing the state journal")
+	_, err = ExecCmd("sudo", "rm", "-rf", backupDir())
+	if err == nil && !IsDryRun() {
+		if err = os.Remove(configs.System.StatePath); errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+	}
+	logs.CheckErrorWithTagAndMsg(err, "Failed to remove the state journal!\n")
+	return nil
+}
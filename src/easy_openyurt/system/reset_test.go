@@ -0,0 +1,105 @@
+package system
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+func TestRecordChange(t *testing.T) {
+	fakeRunner := useFakeRunner(t)
+	useStateJournal(t, "system master init")
+	existingPath := t.TempDir() + "/existing.conf"
+	os.WriteFile(existingPath, []byte("export PATH=$PATH:/usr/local/go/bin\n"), 0644)
+
+	for i := 0; i < 2; i++ {
+		RecordFileChange(existingPath)
+		RecordFileChange("/etc/easy-openyurt-missing.conf")
+		RecordLineChange(existingPath, "export PATH=$PATH:/usr/local/go/bin") // Present already
+		RecordLineChange(existingPath, "export PATH=$PATH:/opt/bin")
+		RecordHoldChange("kubelet", "kubeadm")
+	}
+	journal, _ := LoadStateJournal()
+	var changes []string
+	for _, change := range journal.Changes {
+		changes = append(changes, change.String())
+	}
+	want := "modified " + existingPath + "|created /etc/easy-openyurt-missing.conf|appended \"export PATH=$PATH:/opt/bin\" to " + existingPath + "|hold kubelet kubeadm"
+	if strings.Join(changes, "|") != want {
+		t.Errorf("Record*Change() twice recorded %v, want %s", changes, want)
+	}
+	if backup := journal.Changes[0].Backup; fakeRunner.Count("sudo cp -a "+existingPath+" "+backup) != 1 || !strings.HasPrefix(backup, backupDir()) {
+		t.Errorf("RecordFileChange() should back up %s once to %s\n%v", existingPath, backupDir(), fakeRunner)
+	}
+}
+
+func TestSystemReset(t *testing.T) {
+	fakeRunner := useFakeSystemInit(t)
+	useStateJournal(t, "system master init")
+	// loopback is installed already, e.g. by another CNI
+	os.MkdirAll(checkRootDir+cniPluginsDir, 0755)
+	os.WriteFile(checkRootDir+cniPluginsDir+"/loopback", nil, 0755)
+	fakeRunner.On("tar -tf", FakeResponse{Stdout: "./\n./bridge\n./loopback\n"})
+
+	SystemInit()
+	RecordSysctlChange("net.ipv4.ip_forward", "0")
+	FinishStateJournal()
+	journal, err := LoadStateJournal()
+	if err != nil || len(journal.Changes) == 0 {
+		t.Fatalf("SystemInit() recorded no changes: %+v, %v", journal, err)
+	}
+	content, _ := os.ReadFile(configs.System.StatePath)
+
+	// Settings are restored, components are kept
+	fakeRunner.Commands = nil
+	if err = SystemReset(false); err != nil {
+		t.Fatalf("SystemReset() error = %v", err)
+	}
+	unhold := fakeRunner.Index("sudo apt-mark unhold kubelet kubeadm kubectl")
+	if unhold < 0 {
+		t.Errorf("SystemReset() did not release kubelet, kubeadm, kubectl\n%v", fakeRunner)
+	}
+	for _, change := range journal.Changes {
+		var want string
+		switch {
+		case change.Kind == ChangeFile && len(change.Backup) > 0:
+			want = "sudo cp -a " + change.Backup + " " + change.Path
+		case change.Kind == ChangeFile:
+			want = "sudo rm -rf " + change.Path
+		case change.Kind == ChangeLine:
+			want = "sed -i " + ShellQuote("\\|^"+sedPattern(change.Line)+"$|d") + " " + change.Path
+		default:
+			continue
+		}
+		if index := fakeRunner.Index(want); index < unhold {
+			t.Errorf("SystemReset() did not undo %q (after releasing packages) with %q\n%v", change, want, fakeRunner)
+		}
+	}
+	for _, pattern := range []string{"sudo rm -f /usr/local/sbin/runc", "sudo apt-get -qq remove"} {
+		if fakeRunner.Executed(pattern) {
+			t.Errorf("SystemReset() should keep components, but executed %q\n%v", pattern, fakeRunner)
+		}
+	}
+	if apply := fakeRunner.Index("sudo sysctl --quiet --system"); apply < 0 || fakeRunner.Index("sudo sysctl --quiet -w net.ipv4.ip_forward=0") < apply {
+		t.Errorf("SystemReset() did not apply the restored sysctl settings, then the original live values\n%v", fakeRunner)
+	}
+	if _, err = os.Stat(configs.System.StatePath); !os.IsNotExist(err) {
+		t.Errorf("SystemReset() should remove the state journal %s", configs.System.StatePath)
+	}
+
+	// Components are removed on request
+	os.WriteFile(configs.System.StatePath, content, 0644)
+	fakeRunner.Commands = nil
+	if err = SystemReset(true); err != nil {
+		t.Fatalf("SystemReset(-remove-components) error = %v", err)
+	}
+	if remove := fakeRunner.Index("sudo apt-get -qq remove -y kubeadm kubelet kubectl"); remove < 0 || remove < fakeRunner.Index("sudo apt-mark unhold") {
+		t.Errorf("SystemReset(-remove-components) did not remove kubeadm, kubelet, kubectl after releasing them\n%v", fakeRunner)
+	}
+	// Only the CNI plugins extracted by `system init`
+	if !fakeRunner.Executed("sudo rm -f "+cniPluginsDir+"/bridge") || fakeRunner.Executed(cniPluginsDir+"/loopback") || fakeRunner.Executed("rm -rf "+cniPluginsDir) {
+		t.Errorf("SystemReset(-remove-components) should only remove the CNI plugins it installed\n%v", fakeRunner)
+	}
+}
@@ -0,0 +1,247 @@
+package system
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
+)
+
+// Command to be executed by a Runner
+type Command struct {
+	Args  []string // Argument vector (Args[0] is the executable), never interpreted by a shell
+	Shell string   // Shell script executed with `bash -c` instead of Args, for pipelines that truly need a shell
+	Stdin string   // Data written to stdin (optional)
+}
+
+// Render command as a line that can be pasted into a shell
+func (command *Command) String() string {
+	var rendered string
+	if len(command.Shell) > 0 {
+		rendered = command.Shell
+	} else {
+		quotedArgs := make([]string, len(command.Args))
+		for i, arg := range command.Args {
+			quotedArgs[i] = ShellQuote(arg)
+		}
+		rendered = strings.Join(quotedArgs, " ")
+	}
+	if len(command.Stdin) > 0 {
+		rendered += fmt.Sprintf(" <<'EASY_OPENYURT_EOF'\n%s\nEASY_OPENYURT_EOF", strings.TrimSuffix(command.Stdin, "\n"))
+	}
+	return rendered
+}
+
+// Runner executes commands on behalf of all packages
+type Runner interface {
+	// Run the command under ctx and return its stdout without the trailing "\n"
+	Run(ctx context.Context, command *Command) (string, error)
+}
+
+// Runner used by `ExecShellCmd()` and `ExecCmd()`
+var currentRunner Runner = &LocalRunner{}
+
+// Replace the runner used by `ExecShellCmd()` and `ExecCmd()`, and return the previous one
+func SetRunner(runner Runner) Runner {
+	previousRunner := currentRunner
+	currentRunner = runner
+	return previousRunner
+}
+
+// Get the runner currently used by `ExecShellCmd()` and `ExecCmd()`
+func GetRunner() Runner {
+	return currentRunner
+}
+
+// Run command with the current runner under a step context
+func runCommand(command *Command) (string, error) {
+	ctx, cancel := StepContext()
+	defer cancel()
+	return currentRunner.Run(ctx, command)
+}
+
+// Quote s for safe use as a single word in a shell script
+func ShellQuote(s string) string {
+	if len(s) > 0 && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Runner executing commands on the local machine
+type LocalRunner struct{}
+
+func (runner *LocalRunner) Run(ctx context.Context, command *Command) (string, error) {
+	// Allocate bytes buffer
+	cmdStdout := new(bytes.Buffer)
+	cmdStderr := new(bytes.Buffer)
+	var process *exec.Cmd
+	if len(command.Shell) > 0 {
+		process = exec.CommandContext(ctx, "bash", "-c", command.Shell)
+	} else if len(command.Args) > 0 {
+		process = exec.CommandContext(ctx, command.Args[0], command.Args[1:]...)
+	} else {
+		return "", &ShellError{msg: "empty command: neither shell script nor arguments", exitCode: -1}
+	}
+	if len(command.Stdin) > 0 {
+		process.Stdin = strings.NewReader(command.Stdin)
+	}
+	// Redirect stdout & stderr
+	process.Stdout = cmdStdout
+	process.Stderr = cmdStderr
+	flushOutput := func() {}
+	if configs.System.StreamOutput {
+		// Output is logged line by line while the command runs
+		logExecutedCommand(command)
+		process.Stdout, process.Stderr, flushOutput = teeCommandOutput(cmdStdout, cmdStderr)
+	}
+	// Stop the whole process tree (e.g. sudo apt-get) when ctx is done
+	process.Cancel = func() error {
+		return terminateProcessTree(process.Process.Pid)
+	}
+	process.WaitDelay = cancelWaitDelay
+
+	// Execute command
+	err := process.Run()
+	flushOutput()
+
+	// remove suffix "\n" in Stdout & Stderr
+	trimmedStdout := strings.TrimSuffix(cmdStdout.String(), "\n")
+	trimmedStderr := strings.TrimSuffix(cmdStderr.String(), "\n")
+
+	// Rewrite error message
+	if ctx.Err() != nil {
+		err = &ShellError{msg: fmt.Sprintf("%v: %s", ctx.Err(), trimmedStderr), exitCode: -1}
+	} else if err != nil && process.ProcessState == nil {
+		// Failed to start, e.g. executable not found
+		err = &ShellError{msg: err.Error(), exitCode: -1}
+	} else if err != nil {
+		err = &ShellError{msg: trimmedStderr, exitCode: process.ProcessState.ExitCode()}
+	}
+
+	// For logs
+	if !configs.System.StreamOutput {
+		logExecutedCommand(command)
+		if logs.CommonLog != nil {
+			logs.CommonLog.Printf("Stdout from shell:\n%s\n", trimmedStdout)
+		}
+		if logs.ErrorLog != nil {
+			logs.ErrorLog.Printf("Stderr from shell:\n%s\n", trimmedStderr)
+		}
+	}
+
+	return trimmedStdout, err
+}
+
+// Record executed command in logs
+func logExecutedCommand(command *Command) {
+	if logs.CommonLog != nil {
+		logs.CommonLog.Printf("Executing command: %s\n", command)
+	}
+	if logs.ErrorLog != nil {
+		logs.ErrorLog.Printf("Executing command: %s\n", command)
+	}
+}
+
+// Scripted result of a command executed by FakeRunner
+type FakeResponse struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+type fakeRule struct {
+	pattern   string
+	responses []FakeResponse
+}
+
+// In-memory runner for tests: records every command and returns scripted results instead of executing anything
+type FakeRunner struct {
+	Commands []string // Executed commands (rendered by `Command.String()`) in order
+	rules    []*fakeRule
+	mutex    sync.Mutex
+}
+
+// Create a FakeRunner which succeeds with empty stdout for unscripted commands
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{}
+}
+
+// Script the results of commands whose rendered form contains pattern
+// Successive matching commands consume the responses in order, and the last response is repeated afterwards
+// Rules are matched in the order they are added
+func (runner *FakeRunner) On(pattern string, responses ...FakeResponse) *FakeRunner {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	if len(responses) == 0 {
+		responses = []FakeResponse{{}}
+	}
+	runner.rules = append(runner.rules, &fakeRule{pattern: pattern, responses: responses})
+	return runner
+}
+
+func (runner *FakeRunner) Run(ctx context.Context, command *Command) (string, error) {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	cmd := command.String()
+	runner.Commands = append(runner.Commands, cmd)
+	if ctx.Err() != nil {
+		return "", &ShellError{msg: ctx.Err().Error(), exitCode: -1}
+	}
+	for _, rule := range runner.rules {
+		if !strings.Contains(cmd, rule.pattern) {
+			continue
+		}
+		response := rule.responses[0]
+		if len(rule.responses) > 1 {
+			rule.responses = rule.responses[1:]
+		}
+		if response.ExitCode != 0 {
+			return response.Stdout, &ShellError{msg: response.Stderr, exitCode: response.ExitCode}
+		}
+		return response.Stdout, nil
+	}
+	return "", nil
+}
+
+// Count executed commands containing pattern
+func (runner *FakeRunner) Count(pattern string) int {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	count := 0
+	for _, cmd := range runner.Commands {
+		if strings.Contains(cmd, pattern) {
+			count++
+		}
+	}
+	return count
+}
+
+// Check whether any executed command contains pattern
+func (runner *FakeRunner) Executed(pattern string) bool {
+	return runner.Count(pattern) > 0
+}
+
+// Index of the first executed command containing pattern (-1 if not found)
+func (runner *FakeRunner) Index(pattern string) int {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	for i, cmd := range runner.Commands {
+		if strings.Contains(cmd, pattern) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Implement fmt.Stringer for readable test failures
+func (runner *FakeRunner) String() string {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	return fmt.Sprintf("%d commands:\n%s", len(runner.Commands), strings.Join(runner.Commands, "\n"))
+}
@@ -0,0 +1,252 @@
+package system
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+// Replace the current runner with a FakeRunner for the duration of the test
+func useFakeRunner(t *testing.T) *FakeRunner {
+	fakeRunner := NewFakeRunner()
+	previousRunner := SetRunner(fakeRunner)
+	t.Cleanup(func() { SetRunner(previousRunner) })
+	return fakeRunner
+}
+
+func TestLocalRunner(t *testing.T) {
+	stdout, err := (&LocalRunner{}).Run(context.Background(), &Command{Shell: "echo hello"})
+	if err != nil || stdout != "hello" {
+		t.Fatalf("Run(echo hello) = %q, %v", stdout, err)
+	}
+	_, err = (&LocalRunner{}).Run(context.Background(), &Command{Shell: "echo oops >&2; exit 3"})
+	if err == nil || err.Error() != "[exit 3] -> oops" {
+		t.Fatalf("Run(exit 3) error = %v", err)
+	}
+	_, err = (&LocalRunner{}).Run(context.Background(), &Command{Args: []string{"/nonexistent/binary"}})
+	if err == nil {
+		t.Fatalf("Run(/nonexistent/binary) should fail")
+	}
+	if _, err = (&LocalRunner{}).Run(context.Background(), &Command{}); err == nil {
+		t.Fatalf("Run() of an empty command should fail")
+	}
+}
+
+func TestExecCmd(t *testing.T) {
+	// Arguments must never be interpreted by a shell
+	stdout, err := ExecCmd("echo", "node; touch /tmp/pwned", "$(id -u)")
+	if err != nil || stdout != "node; touch /tmp/pwned $(id -u)" {
+		t.Fatalf("ExecCmd(echo) = %q, %v", stdout, err)
+	}
+	stdout, err = ExecCmdWithInput("line1\nline2\n", "sed", "-n", "2p")
+	if err != nil || stdout != "line2" {
+		t.Fatalf("ExecCmdWithInput(sed) = %q, %v", stdout, err)
+	}
+
+	for input, want := range map[string]string{
+		"":                  "''",
+		"plain-1.2.3:/path": "plain-1.2.3:/path",
+		"a b":               "'a b'",
+		"it's; rm -rf /":    `'it'\''s; rm -rf /'`,
+	} {
+		if quoted := ShellQuote(input); quoted != want {
+			t.Errorf("ShellQuote(%q) = %s, want %s", input, quoted, want)
+		}
+		if stdout, _ := ExecShellCmd("printf %%s %s", ShellQuote(input)); stdout != input {
+			t.Errorf("ShellQuote(%q) does not round-trip through bash: %q", input, stdout)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, err := range []error{
+		ValidateVersion("k8s-version", "1.25.9"),
+		ValidateVersion("kubeadm-version", "1.25.9-00"),
+		ValidateVersion("cni-plugins-version", "v1.2.0"),
+		ValidateNodeName("worker-node-name", "edge-node.example.com"),
+		ValidateAddress("apiserver-advertise-address", "192.168.18.2"),
+		ValidateAddress("apiserver-advertise-address", "master.example.com"),
+		ValidatePort("apiserver-port", "6443"),
+		ValidateToken("apiserver-token", "abcdef.0123456789abcdef"),
+		ValidateTokenHash("apiserver-token-hash", "sha256:"+strings.Repeat("0a", 32)),
+		ValidateImageRepo("alternative-image-repo", "registry.example.com:5000/google_containers"),
+		ValidateCidr("pod-network-cidr", "192.168.0.0/16"),
+	} {
+		if err != nil {
+			t.Errorf("valid parameter rejected: %v", err)
+		}
+	}
+	for _, err := range []error{
+		ValidateVersion("k8s-version", "1.25.9; reboot"),
+		ValidateNodeName("worker-node-name", "node$(id)"),
+		ValidateNodeName("worker-node-name", "Upper"),
+		ValidateAddress("apiserver-advertise-address", "1.2.3.4 --ignore-preflight-errors=all"),
+		ValidatePort("apiserver-port", "65536"),
+		ValidateToken("apiserver-token", "abcdef.0123456789abcdef'"),
+		ValidateTokenHash("apiserver-token-hash", "sha256:xyz"),
+		ValidateImageRepo("alternative-image-repo", "registry.example.com/k8s|sh"),
+		ValidateCidr("pod-network-cidr", "192.168.0.0"),
+	} {
+		if err == nil {
+			t.Errorf("invalid parameter accepted")
+		}
+	}
+}
+
+func TestStepTimeout(t *testing.T) {
+	previousStepTimeout := configs.System.StepTimeout
+	configs.System.StepTimeout = 200 * time.Millisecond
+	defer func() { configs.System.StepTimeout = previousStepTimeout }()
+
+	startTime := time.Now()
+	_, err := ExecShellCmd("sleep 10 && echo finished")
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Fatalf("ExecShellCmd(sleep 10) error = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(startTime); elapsed > 3*time.Second {
+		t.Fatalf("ExecShellCmd(sleep 10) took %v after the step timed out", elapsed)
+	}
+
+	startTime = time.Now()
+	err = WaitUntil("nothing", func() (bool, error) { return false, nil })
+	if err == nil || time.Since(startTime) > 3*time.Second {
+		t.Fatalf("WaitUntil() = %v after %v, want timeout", err, time.Since(startTime))
+	}
+}
+
+func TestFakeRunner(t *testing.T) {
+	fakeRunner := useFakeRunner(t)
+	fakeRunner.On("status", FakeResponse{Stdout: "pending"}, FakeResponse{Stdout: "ready"})
+	fakeRunner.On("broken", FakeResponse{Stderr: "boom", ExitCode: 2})
+
+	for _, want := range []string{"pending", "ready", "ready"} {
+		stdout, err := ExecShellCmd("kubectl %s", "status")
+		if err != nil || stdout != want {
+			t.Fatalf("ExecShellCmd(status) = %q, %v, want %q", stdout, err, want)
+		}
+	}
+	if _, err := ExecShellCmd("broken"); err == nil || err.Error() != "[exit 2] -> boom" {
+		t.Fatalf("ExecShellCmd(broken) error = %v", err)
+	}
+	if stdout, err := ExecShellCmd("unscripted"); stdout != "" || err != nil {
+		t.Fatalf("ExecShellCmd(unscripted) = %q, %v", stdout, err)
+	}
+	if fakeRunner.Count("status") != 3 || len(fakeRunner.Commands) != 5 {
+		t.Fatalf("unexpected recorded commands: %v", fakeRunner)
+	}
+}
+
+func cloneMap[K comparable, V any](m map[K]V) map[K]V {
+	clone := make(map[K]V, len(m))
+	for key, value := range m {
+		clone[key] = value
+	}
+	return clone
+}
+
+// Restore the settings of `system init` when the test ends, including the maps `SystemInit()` fills in place
+func useSystemConfigs(t *testing.T) {
+	system, containerd, crio, k8sVersion := configs.System, configs.Containerd, configs.Crio, configs.Kube.K8sVersion
+	system.ArtifactSha256, system.Mirrors = cloneMap(system.ArtifactSha256), cloneMap(system.Mirrors)
+	containerd.RegistryMirrors, containerd.Runtimes = cloneMap(containerd.RegistryMirrors), cloneMap(containerd.Runtimes)
+	crio.RegistryMirrors = cloneMap(crio.RegistryMirrors)
+	t.Cleanup(func() {
+		configs.System, configs.Containerd, configs.Crio, configs.Kube.K8sVersion = system, containerd, crio, k8sVersion
+	})
+}
+
+// Let `SystemInit()` set up an Ubuntu node with systemd below a fake root, recording the commands
+func useFakeSystemInit(t *testing.T) *FakeRunner {
+	useSystemConfigs(t)
+	fakeRunner := useFakeRunner(t)
+	useFakeSystemRoot(t, "systemd")
+	configs.System.CurrentOS = "ubuntu"
+	configs.System.UserHomeDir = t.TempDir()
+	return fakeRunner
+}
+
+func TestSystemInitWithFakeRunner(t *testing.T) {
+	fakeRunner := useFakeSystemInit(t)
+
+	SystemInit()
+
+	for _, pattern := range []string{
+		"sudo swapoff -a",
+		"sudo tee /etc/containerd/config.toml",
+		"sudo systemctl restart containerd",
+		"sudo modprobe br_netfilter",
+		"'kubeadm=1.25.9-*' 'kubelet=1.25.9-*' 'kubectl=1.25.9-*'",
+		"sudo apt-mark hold kubelet kubeadm kubectl",
+		"sudo tee /etc/easy_openyurt/kubeadm-patches/kubeletconfiguration+merge.yaml",
+	} {
+		if !fakeRunner.Executed(pattern) {
+			t.Errorf("SystemInit() did not execute %q\n%v", pattern, fakeRunner)
+		}
+	}
+	if fakeRunner.Index("sudo swapoff -a") > fakeRunner.Index("sudo apt-mark hold") {
+		t.Errorf("SystemInit() held packages before disabling swap\n%v", fakeRunner)
+	}
+}
+
+func TestDryRunRunner(t *testing.T) {
+	scriptPath := t.TempDir() + "/plan.sh"
+	dryRunRunner, err := NewDryRunRunner(scriptPath)
+	if err != nil {
+		t.Fatalf("NewDryRunRunner(%s): %v", scriptPath, err)
+	}
+	useFakeSystemInit(t)
+	SetRunner(dryRunRunner)
+	configs.System.DryRun = true
+
+	SystemInit()
+	err = WriteFile(configs.System.UserHomeDir+"/planned.txt", []byte("planned"), 0666)
+	if err != nil {
+		t.Fatalf("WriteFile() in dry-run mode: %v", err)
+	}
+	if err = dryRunRunner.Close(); err != nil {
+		t.Fatalf("Close(): %v", err)
+	}
+
+	if _, err = os.Stat(configs.System.UserHomeDir + "/planned.txt"); !os.IsNotExist(err) {
+		t.Errorf("WriteFile() should not write in dry-run mode")
+	}
+	script, err := os.ReadFile(scriptPath)
+	if err != nil {
+		t.Fatalf("Failed to read plan script: %v", err)
+	}
+	for _, want := range []string{
+		"#!/bin/bash\n",
+		"\n# Disabling swap\nsudo swapoff -a",
+		"sudo apt-mark hold kubelet kubeadm kubectl\n",
+		"cat > " + configs.System.UserHomeDir + "/planned.txt <<'EASY_OPENYURT_EOF'\nplanned\nEASY_OPENYURT_EOF\n",
+	} {
+		if !strings.Contains(string(script), want) {
+			t.Errorf("plan script does not contain %q:\n%s", want, script)
+		}
+	}
+}
+
+func TestStreamOutput(t *testing.T) {
+	var lines []string
+	writer := newLineWriter(func(line string) { lines = append(lines, line) })
+	writer.Write([]byte("first\r\nsec"))
+	if len(lines) != 1 || lines[0] != "first" {
+		t.Fatalf("lines after the first write = %q, want [first]", lines)
+	}
+	writer.Write([]byte("ond\nthi"))
+	writer.Flush()
+	if strings.Join(lines, ",") != "first,second,thi" {
+		t.Fatalf("lines = %q, want [first second thi]", lines)
+	}
+
+	configs.System.StreamOutput = true
+	defer func() { configs.System.StreamOutput = false }()
+	stdout, err := (&LocalRunner{}).Run(context.Background(), &Command{Shell: "echo out; echo err >&2; printf tail"})
+	if err != nil || stdout != "out\ntail" {
+		t.Fatalf("Run() in streaming mode = %q, %v", stdout, err)
+	}
+}
@@ -0,0 +1,258 @@
+package system
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
+)
+
+// Kinds of signatures
+const (
+	SignatureCosign = "cosign"  // Keyless sigstore signature, verified by `cosign verify-blob`
+	SignatureGpgKey = "gpg-key" // The file is an OpenPGP public key, which must have one of the pinned fingerprints
+	SignatureGpg    = "gpg"     // Detached OpenPGP signature, verified by `gpg --verify` against the keys published by upstream
+)
+
+var fingerprintRegexp = regexp.MustCompile(`^[A-F0-9]{40}$`)
+
+// Upstream signature of a downloaded file
+type Signature struct {
+	Kind           string
+	SignatureUrl   string   // Detached signature (cosign unless BundleUrl is set, or gpg)
+	CertificateUrl string   // Signing certificate (cosign only, unless BundleUrl is set)
+	BundleUrl      string   // Sigstore bundle holding both signature & certificate (cosign only, optional)
+	Identity       string   // Expected certificate identity (cosign only, or IdentityRegexp)
+	IdentityRegexp string   // Expected certificate identity as regular expression (cosign only, or Identity)
+	OidcIssuer     string   // Expected OIDC issuer of the certificate (cosign only)
+	Fingerprints   []string // Trusted key fingerprints (gpg-key only)
+	KeysUrl        string   // Public keys of the trusted signers (gpg only)
+}
+
+// Describe how the signature is verified
+func (signature *Signature) Method() string {
+	switch signature.Kind {
+	case SignatureCosign:
+		identity := signature.Identity
+		if len(identity) == 0 {
+			identity = signature.IdentityRegexp
+		}
+		return fmt.Sprintf("cosign (identity %s, issuer %s)", identity, signature.OidcIssuer)
+	case SignatureGpgKey:
+		return fmt.Sprintf("gpg key fingerprint (%s)", strings.Join(signature.Fingerprints, " | "))
+	case SignatureGpg:
+		return fmt.Sprintf("gpg (keys %s)", signature.KeysUrl)
+	default:
+		return signature.Kind
+	}
+}
+
+// Get the signature of a Kubernetes binary downloaded from dl.k8s.io
+func KubeBinarySignature(url string) *Signature {
+	return &Signature{
+		Kind:           SignatureCosign,
+		SignatureUrl:   url + ".sig",
+		CertificateUrl: url + ".cert",
+		Identity:       configs.System.KubeSignatureIdentity,
+		OidcIssuer:     configs.System.KubeSignatureOidcIssuer,
+	}
+}
+
+// Get the signature of the containerd release (nil if no sigstore bundle is configured)
+func ContainerdSignature() *Signature {
+	if len(configs.System.ContainerdSignatureBundleUrlTemplate) == 0 {
+		return nil
+	}
+	return &Signature{
+		Kind:           SignatureCosign,
+		BundleUrl:      fmt.Sprintf(configs.System.ContainerdSignatureBundleUrlTemplate, configs.System.ContainerdVersion, configs.System.ContainerdVersion, configs.ArchName("containerd")),
+		IdentityRegexp: configs.System.ContainerdSignatureIdentityRegexp,
+		OidcIssuer:     configs.System.ContainerdSignatureOidcIssuer,
+	}
+}
+
+// Path cosign is installed to by `InstallCosign()`
+const cosignPath = "/usr/local/bin/cosign"
+
+func cosignUrl() string {
+	return fmt.Sprintf(configs.System.CosignDownloadUrlTemplate, configs.System.CosignVersion, configs.ArchName("cosign"))
+}
+
+func cosignChecksumUrl() string {
+	return fmt.Sprintf(configs.System.CosignChecksumUrlTemplate, configs.System.CosignVersion)
+}
+
+// Whether `SystemInit()` verifies cosign signatures, and so needs cosign
+func cosignNeeded() bool {
+	return configs.System.VerifySignatures &&
+		((configs.System.KubeInstallMethod == KubeInstallBinary) || (configs.System.ContainerRuntime == RuntimeContainerd && ContainerdSignature() != nil))
+}
+
+// Get the cosign release installed if cosign is not found
+func cosignArtifacts() []*Artifact {
+	return []*Artifact{{Kind: ArtifactFile, Source: cosignUrl(), Sha256Url: cosignChecksumUrl()}}
+}
+
+// Install the pinned cosign release (verified by its SHA256 sum), unless cosign is found
+func InstallCosign() error {
+	if _, err := exec.LookPath("cosign"); err == nil {
+		return nil
+	}
+	filePathName, err := DownloadToTmpDirWithChecksum(cosignChecksumUrl(), cosignUrl())
+	if err != nil {
+		return err
+	}
+	if err = RecordComponentChange("cosign"); err != nil {
+		return err
+	}
+	_, err = ExecCmd("sudo", "install", "-m", "755", filePathName, cosignPath)
+	return err
+}
+
+// Files needed to verify the signature, besides the signed file itself
+func (signature *Signature) artifacts() []*Artifact {
+	var artifacts []*Artifact
+	for _, url := range []string{signature.SignatureUrl, signature.CertificateUrl, signature.BundleUrl, signature.KeysUrl} {
+		if len(url) > 0 {
+			artifacts = append(artifacts, &Artifact{Kind: ArtifactFile, Source: url})
+		}
+	}
+	return artifacts
+}
+
+// Verify the signature of a downloaded file, the verifying command fails if it does not match
+func verifySignature(download *Download) error {
+	signature := download.Signature
+	switch signature.Kind {
+	case SignatureCosign:
+		if len(signature.OidcIssuer) == 0 || (len(signature.Identity) == 0 && len(signature.IdentityRegexp) == 0) {
+			return fmt.Errorf("no trusted identity & OIDC issuer pinned")
+		}
+		args := []string{"verify-blob"}
+		if len(signature.BundleUrl) > 0 {
+			bundlePath := download.FilePath + ".sigstore.json"
+			if _, _, err := fetchDownload(&Download{Url: signature.BundleUrl, FilePath: bundlePath}); err != nil {
+				return err
+			}
+			args = append(args, "--bundle", bundlePath)
+		} else {
+			signaturePath := download.FilePath + ".sig"
+			certificatePath := download.FilePath + ".cert"
+			if _, _, err := fetchDownload(&Download{Url: signature.SignatureUrl, FilePath: signaturePath}); err != nil {
+				return err
+			}
+			if _, _, err := fetchDownload(&Download{Url: signature.CertificateUrl, FilePath: certificatePath}); err != nil {
+				return err
+			}
+			args = append(args, "--signature", signaturePath, "--certificate", certificatePath)
+		}
+		if len(signature.Identity) > 0 {
+			args = append(args, "--certificate-identity", signature.Identity)
+		} else {
+			args = append(args, "--certificate-identity-regexp", signature.IdentityRegexp)
+		}
+		args = append(args, "--certificate-oidc-issuer", signature.OidcIssuer, download.FilePath)
+		if _, err := ExecCmd("cosign", args...); err != nil {
+			return fmt.Errorf("cosign verify-blob failed (is cosign installed? skip with -verify-signatures=false): %w", err)
+		}
+		return nil
+	case SignatureGpgKey:
+		if len(signature.Fingerprints) == 0 {
+			return fmt.Errorf("no trusted key fingerprint pinned")
+		}
+		fingerprints := make([]string, len(signature.Fingerprints))
+		for i, fingerprint := range signature.Fingerprints {
+			fingerprints[i] = strings.ToUpper(strings.ReplaceAll(fingerprint, " ", ""))
+			if !fingerprintRegexp.MatchString(fingerprints[i]) {
+				return fmt.Errorf("invalid key fingerprint %q pinned", fingerprint)
+			}
+		}
+		// Every primary key in the file must be trusted, otherwise an untrusted key could be smuggled in along a trusted one
+		_, err := ExecShellCmd("gpg --batch --show-keys --with-colons %s | awk -F: %s",
+			ShellQuote(download.FilePath),
+			ShellQuote(fmt.Sprintf(`$1 == "pub" { primary = 1; next } $1 == "fpr" && primary { primary = 0; keys++; if ($10 !~ /^(%s)$/) untrusted++ } END { exit (keys == 0 || untrusted > 0) }`, strings.Join(fingerprints, "|"))))
+		if err != nil {
+			return fmt.Errorf("key does not have a trusted fingerprint %s: %w", strings.Join(fingerprints, " | "), err)
+		}
+		return nil
+	case SignatureGpg:
+		if len(signature.SignatureUrl) == 0 || len(signature.KeysUrl) == 0 {
+			return fmt.Errorf("no signature or trusted keys configured")
+		}
+		signaturePath := download.FilePath + ".asc"
+		keysPath := download.FilePath + ".keys"
+		if _, _, err := fetchDownload(&Download{Url: signature.SignatureUrl, FilePath: signaturePath}); err != nil {
+			return err
+		}
+		if _, _, err := fetchDownload(&Download{Url: signature.KeysUrl, FilePath: keysPath}); err != nil {
+			return err
+		}
+		// Throwaway keyring, so that only the published keys are trusted and the keyring of the user is left alone
+		_, err := ExecShellCmd("gnupghome=$(mktemp -d) && trap 'rm -rf \"$gnupghome\"' EXIT && gpg --batch --quiet --homedir \"$gnupghome\" --import %s && gpg --batch --quiet --homedir \"$gnupghome\" --trust-model always --verify %s %s",
+			ShellQuote(keysPath), ShellQuote(signaturePath), ShellQuote(download.FilePath))
+		if err != nil {
+			return fmt.Errorf("gpg --verify failed (is gpg installed? skip with -verify-signatures=false): %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported signature kind %q", signature.Kind)
+	}
+}
+
+// How a downloaded artifact was verified
+type VerificationRecord struct {
+	Url     string
+	Methods []string // Empty if the artifact was not verified at all
+}
+
+var verificationRecords []VerificationRecord
+var verificationRecordsMutex sync.Mutex
+
+func recordVerification(url string, methods []string) {
+	verificationRecordsMutex.Lock()
+	defer verificationRecordsMutex.Unlock()
+	verificationRecords = append(verificationRecords, VerificationRecord{Url: url, Methods: methods})
+	if logs.CommonLog != nil {
+		logs.CommonLog.Printf("Verified %s: %s\n", url, formatVerificationMethods(methods))
+	}
+}
+
+func formatVerificationMethods(methods []string) string {
+	if len(methods) == 0 {
+		return "NOT VERIFIED"
+	}
+	return strings.Join(methods, ", ")
+}
+
+// Get all downloads of the current subcommand, and how they were verified
+func VerificationRecords() []VerificationRecord {
+	verificationRecordsMutex.Lock()
+	defer verificationRecordsMutex.Unlock()
+	return append([]VerificationRecord{}, verificationRecords...)
+}
+
+// Write the report of verified downloads as a table
+func WriteVerificationReport(writer io.Writer) error {
+	tableWriter := tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tableWriter, "ARTIFACT\tVERIFIED BY\n")
+	for _, record := range VerificationRecords() {
+		fmt.Fprintf(tableWriter, "%s\t%s\n", record.Url, formatVerificationMethods(record.Methods))
+	}
+	return tableWriter.Flush()
+}
+
+// Print the report of verified downloads (if anything was downloaded)
+func PrintVerificationReport() {
+	if len(VerificationRecords()) == 0 {
+		return
+	}
+	report := new(strings.Builder)
+	WriteVerificationReport(report)
+	logs.InfoPrintf("Downloaded artifacts:\n%s", report)
+}
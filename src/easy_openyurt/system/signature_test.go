@@ -0,0 +1,161 @@
+package system
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+func TestVerifyGpgKey(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not installed")
+	}
+	gnupgHome := t.TempDir()
+	t.Setenv("GNUPGHOME", gnupgHome)
+	_, err := ExecCmd("gpg", "--batch", "--passphrase", "", "--quick-gen-key", "Test <test@example.com>", "ed25519", "sign", "never")
+	if err != nil {
+		t.Fatalf("gpg --quick-gen-key error = %v", err)
+	}
+	key, err := ExecCmd("gpg", "--batch", "--armor", "--export", "test@example.com")
+	if err != nil {
+		t.Fatalf("gpg --export error = %v", err)
+	}
+	keyInfo, _ := ExecCmd("gpg", "--batch", "--with-colons", "--list-keys", "test@example.com")
+	var fingerprint string
+	for _, line := range strings.Split(keyInfo, "\n") {
+		if fields := strings.Split(line, ":"); fields[0] == "fpr" {
+			fingerprint = fields[9]
+			break
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(key))
+	}))
+	defer server.Close()
+	configs.System.TmpDir = t.TempDir()
+	defer func() { configs.System.TmpDir = "" }()
+
+	signature := &Signature{Kind: SignatureGpgKey, Fingerprints: []string{strings.ToLower(fingerprint)}}
+	if _, err := DownloadToTmpDirWithSignature(signature, "", server.URL+"/signing.asc"); err != nil {
+		t.Errorf("DownloadToTmpDirWithSignature(trusted key) error = %v", err)
+	}
+	signature.Fingerprints = []string{strings.Repeat("A", 40)}
+	filePath, err := DownloadToTmpDirWithSignature(signature, "", server.URL+"/signing.asc")
+	if err == nil {
+		t.Errorf("DownloadToTmpDirWithSignature(untrusted key) should fail")
+	}
+	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+		t.Errorf("DownloadToTmpDirWithSignature(untrusted key) should remove the key")
+	}
+
+	report := new(bytes.Buffer)
+	WriteVerificationReport(report)
+	if !regexp.MustCompile(regexp.QuoteMeta(server.URL+"/signing.asc") + ` +gpg key fingerprint \(` + strings.ToLower(fingerprint) + `\)\n`).MatchString(report.String()) {
+		t.Errorf("WriteVerificationReport() = %q", report)
+	}
+}
+
+func TestVerifyGpgSignature(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not installed")
+	}
+	t.Setenv("GNUPGHOME", t.TempDir())
+	_, err := ExecCmd("gpg", "--batch", "--passphrase", "", "--quick-gen-key", "Test <test@example.com>", "ed25519", "sign", "never")
+	if err != nil {
+		t.Fatalf("gpg --quick-gen-key error = %v", err)
+	}
+	keys, _ := ExecCmd("gpg", "--batch", "--armor", "--export", "test@example.com")
+	content := []byte("helm release")
+	contentPath := t.TempDir() + "/helm.tar.gz"
+	os.WriteFile(contentPath, content, 0644)
+	goodSignature, _ := ExecCmd("gpg", "--batch", "--armor", "--detach-sign", "--output", "-", contentPath)
+	os.WriteFile(contentPath, []byte("tampered"), 0644)
+	badSignature, _ := ExecCmd("gpg", "--batch", "--armor", "--detach-sign", "--output", "-", contentPath)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/KEYS":
+			w.Write([]byte(keys))
+		case "/good.asc":
+			w.Write([]byte(goodSignature))
+		case "/bad.asc":
+			w.Write([]byte(badSignature))
+		default:
+			w.Write(content)
+		}
+	}))
+	defer server.Close()
+	sum := sha256.Sum256(content)
+	configs.System.TmpDir = t.TempDir()
+	configs.System.CacheDir = t.TempDir()
+	configs.System.ArtifactSha256["helm.tar.gz"] = hex.EncodeToString(sum[:])
+	defer func() {
+		configs.System.TmpDir, configs.System.CacheDir = "", ""
+		delete(configs.System.ArtifactSha256, "helm.tar.gz")
+	}()
+
+	// Artifacts failing verification are never cached
+	signature := &Signature{Kind: SignatureGpg, SignatureUrl: server.URL + "/bad.asc", KeysUrl: server.URL + "/KEYS"}
+	if _, err := DownloadToTmpDirWithSignature(signature, "", server.URL+"/helm.tar.gz"); err == nil {
+		t.Errorf("DownloadToTmpDirWithSignature(bad signature) should fail")
+	}
+	if index, _ := readCacheIndex(configs.System.CacheDir); len(index) > 0 {
+		t.Errorf("DownloadToTmpDirWithSignature(bad signature) should not cache the download, cache index = %v", index)
+	}
+	signature.SignatureUrl = server.URL + "/good.asc"
+	if _, err := DownloadToTmpDirWithSignature(signature, "", server.URL+"/helm.tar.gz"); err != nil {
+		t.Errorf("DownloadToTmpDirWithSignature(good signature) error = %v", err)
+	}
+	if index, _ := readCacheIndex(configs.System.CacheDir); index[server.URL+"/helm.tar.gz"] == nil {
+		t.Errorf("DownloadToTmpDirWithSignature(good signature) should cache the download, cache index = %v", index)
+	}
+}
+
+func TestVerifyCosignWithFakeRunner(t *testing.T) {
+	fakeRunner := useFakeRunner(t)
+	fakeRunner.On("cosign verify-blob", FakeResponse{}, FakeResponse{Stderr: "none of the expected identities matched", ExitCode: 1})
+	configs.System.TmpDir = "/tmp/easy_openyurt_test"
+	defer func() { configs.System.TmpDir = "" }()
+	url := "https://dl.k8s.io/release/v1.27.2/bin/linux/amd64/kubeadm"
+
+	if _, err := DownloadToTmpDirWithSignature(KubeBinarySignature(url), "", url); err != nil {
+		t.Fatalf("DownloadToTmpDirWithSignature() error = %v", err)
+	}
+	for _, pattern := range []string{
+		"--output /tmp/easy_openyurt_test/kubeadm.sig " + url + ".sig",
+		"--output /tmp/easy_openyurt_test/kubeadm.cert " + url + ".cert",
+		"cosign verify-blob --signature /tmp/easy_openyurt_test/kubeadm.sig --certificate /tmp/easy_openyurt_test/kubeadm.cert --certificate-identity " +
+			configs.System.KubeSignatureIdentity + " --certificate-oidc-issuer " + configs.System.KubeSignatureOidcIssuer + " /tmp/easy_openyurt_test/kubeadm",
+	} {
+		if !fakeRunner.Executed(pattern) {
+			t.Errorf("DownloadToTmpDirWithSignature() did not execute %q\n%v", pattern, fakeRunner)
+		}
+	}
+
+	// Failed verification stops the step
+	if _, err := DownloadToTmpDirWithSignature(KubeBinarySignature(url), "", url); err == nil || !strings.Contains(err.Error(), "none of the expected identities matched") {
+		t.Errorf("DownloadToTmpDirWithSignature(bad signature) error = %v", err)
+	}
+	if !fakeRunner.Executed("rm -f /tmp/easy_openyurt_test/kubeadm") {
+		t.Errorf("DownloadToTmpDirWithSignature(bad signature) should remove the file\n%v", fakeRunner)
+	}
+
+	// Skipped on demand, but still reported
+	configs.System.VerifySignatures = false
+	defer func() { configs.System.VerifySignatures = true }()
+	if _, err := DownloadToTmpDirWithSignature(KubeBinarySignature(url), "", url); err != nil {
+		t.Errorf("DownloadToTmpDirWithSignature(-verify-signatures=false) error = %v", err)
+	}
+	records := VerificationRecords()
+	if lastRecord := records[len(records)-1]; lastRecord.Url != url || strings.Join(lastRecord.Methods, ",") != "cosign signature skipped" {
+		t.Errorf("last verification record = %+v", lastRecord)
+	}
+}
@@ -0,0 +1,172 @@
+package system
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
+)
+
+// Step completed on the node
+type StepRecord struct {
+	Inputs    string    `json:"inputs"` // SHA256 of the inputs the step was completed with
+	Completed time.Time `json:"completed"`
+}
+
+// Run of a subcommand, kept in the journal until it succeeds
+type RunRecord struct {
+	Args        []string  `json:"args"`
+	Started     time.Time `json:"started"`
+	CurrentStep string    `json:"currentStep,omitempty"` // Step the run failed in, if the run is over
+}
+
+// State journal of the node
+type StateJournal struct {
+	Steps   map[string]*StepRecord `json:"steps"`             // Step name => last completion
+	Runs    map[string]*RunRecord  `json:"runs"`              // Subcommand (e.g. "system master init") => unfinished run
+	Changes []*ChangeRecord        `json:"changes,omitempty"` // Changes to the node, in order, undone by `system reset`
+}
+
+var (
+	stateJournal    *StateJournal // Journal of the current subcommand, nil if it is not recorded
+	stateSubcommand string
+	stateArgs       []string
+)
+
+// Load the state journal (empty if there is none yet)
+func LoadStateJournal() (*StateJournal, error) {
+	journal := &StateJournal{Steps: map[string]*StepRecord{}, Runs: map[string]*RunRecord{}}
+	content, err := os.ReadFile(configs.System.StatePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return journal, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(content, journal); err != nil {
+		return nil, fmt.Errorf("invalid state journal %s: %w", configs.System.StatePath, err)
+	}
+	if journal.Steps == nil {
+		journal.Steps = map[string]*StepRecord{}
+	}
+	if journal.Runs == nil {
+		journal.Runs = map[string]*RunRecord{}
+	}
+	return journal, nil
+}
+
+// Write the state journal, owned by the current user so that later steps need no sudo (not in dry-run mode)
+func saveStateJournal() error {
+	if IsDryRun() {
+		return nil
+	}
+	content, err := json.MarshalIndent(stateJournal, "", "  ")
+	if err != nil {
+		return err
+	}
+	stateDir := path.Dir(configs.System.StatePath)
+	if _, err = os.Stat(stateDir); err != nil {
+		if _, err = ExecCmd("sudo", "install", "-d", "-o", fmt.Sprint(os.Getuid()), "-g", fmt.Sprint(os.Getgid()), stateDir); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(configs.System.StatePath, append(content, '\n'), 0644)
+}
+
+// Add parameters of subcommands recorded in the state journal to flag set
+func AddStateFlags(flagSet *flag.FlagSet) {
+	flagSet.BoolVar(&configs.System.Resume, "resume", configs.System.Resume, "Resume the last failed run with its parameters (parameters given along are applied on top)")
+	flagSet.StringVar(&configs.System.StatePath, "state-file", configs.System.StatePath, "State journal of the node, recording completed steps")
+}
+
+// Parse parameters of a subcommand recorded in the state journal
+// With `-resume`, the parameters of its failed run are parsed first
+func ParseStateFlags(flagSet *flag.FlagSet, subcommand string, args []string) error {
+	flagSet.Parse(args)
+	stateArgs = nil
+	if configs.System.Resume {
+		journal, err := LoadStateJournal()
+		if err != nil {
+			return err
+		}
+		run := journal.Runs[subcommand]
+		if run == nil {
+			return fmt.Errorf("-resume: no failed run of `%s` recorded in %s", subcommand, configs.System.StatePath)
+		}
+		logs.InfoPrintf("Resuming `%s` started at %s (failed in step %q)\n", subcommand, run.Started.Format(time.RFC3339), run.CurrentStep)
+		flagSet.Parse(run.Args)
+		flagSet.Parse(args)
+	}
+	// Record the resulting parameters, except `-resume` itself
+	flagSet.Visit(func(f *flag.Flag) {
+		if f.Name != "resume" {
+			stateArgs = append(stateArgs, fmt.Sprintf("-%s=%s", f.Name, f.Value))
+		}
+	})
+	return nil
+}
+
+// Start recording the subcommand & its steps in the state journal
+func StartStateJournal(subcommand string) error {
+	journal, err := LoadStateJournal()
+	if err != nil {
+		return err
+	}
+	stateJournal, stateSubcommand = journal, subcommand
+	stateJournal.Runs[subcommand] = &RunRecord{Args: stateArgs, Started: time.Now()}
+	return saveStateJournal()
+}
+
+// Finish recording the subcommand, which succeeded
+func FinishStateJournal() error {
+	if stateJournal == nil {
+		return nil
+	}
+	delete(stateJournal.Runs, stateSubcommand)
+	err := saveStateJournal()
+	stateJournal = nil
+	return err
+}
+
+// Get the SHA256 of step inputs
+func stepInputsDigest(inputs any) string {
+	content, err := json.Marshal(inputs)
+	if err != nil {
+		// Inputs that can not be recorded always re-run the step
+		return ""
+	}
+	digest := sha256.Sum256(content)
+	return hex.EncodeToString(digest[:])
+}
+
+// Run a step of the subcommand, unless it was completed with the same inputs before
+// Steps exit on failure, so the step is recorded as current until it completes
+func RunStep(name string, inputs any, step func()) {
+	if stateJournal == nil {
+		step()
+		return
+	}
+	digest := stepInputsDigest(inputs)
+	if record := stateJournal.Steps[name]; record != nil && len(digest) > 0 && record.Inputs == digest {
+		logs.InfoPrintf("Skipping step %s, completed at %s with the same inputs\n", name, record.Completed.Format(time.RFC3339))
+		return
+	}
+	run := stateJournal.Runs[stateSubcommand]
+	run.CurrentStep = name
+	if err := saveStateJournal(); err != nil {
+		logs.WarnPrintf("Failed to record step %s in %s: %v\n", name, configs.System.StatePath, err)
+	}
+	step()
+	run.CurrentStep = ""
+	stateJournal.Steps[name] = &StepRecord{Inputs: digest, Completed: time.Now()}
+	if err := saveStateJournal(); err != nil {
+		logs.WarnPrintf("Failed to record step %s in %s: %v\n", name, configs.System.StatePath, err)
+	}
+}
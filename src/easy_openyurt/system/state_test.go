@@ -0,0 +1,125 @@
+package system
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+// Record steps in a state journal below a temporary directory
+func useStateJournal(t *testing.T, subcommand string) {
+	previousStatePath := configs.System.StatePath
+	configs.System.StatePath = t.TempDir() + "/easy_openyurt/state.json"
+	t.Cleanup(func() {
+		FinishStateJournal()
+		configs.System.StatePath = previousStatePath
+	})
+	os.MkdirAll(filepath.Dir(configs.System.StatePath), 0755)
+	if err := StartStateJournal(subcommand); err != nil {
+		t.Fatalf("StartStateJournal(%s) error = %v", subcommand, err)
+	}
+}
+
+func TestRunStep(t *testing.T) {
+	useFakeRunner(t)
+	useStateJournal(t, "system master init")
+	runs := 0
+	step := func() { runs++ }
+
+	RunStep("test/step", []any{"1.25.9", map[string]string{"docker.io": "https://mirror.gcr.io"}}, step)
+	RunStep("test/step", []any{"1.25.9", map[string]string{"docker.io": "https://mirror.gcr.io"}}, step)
+	if runs != 1 {
+		t.Errorf("RunStep(same inputs) ran %d times, want 1", runs)
+	}
+	RunStep("test/step", []any{"1.28.2", map[string]string{"docker.io": "https://mirror.gcr.io"}}, step)
+	if runs != 2 {
+		t.Errorf("RunStep(changed inputs) ran %d times, want 2", runs)
+	}
+
+	// Completed steps are kept on disk, the run until it succeeds
+	journal, err := LoadStateJournal()
+	if err != nil || journal.Steps["test/step"] == nil || journal.Runs["system master init"] == nil {
+		t.Fatalf("LoadStateJournal() = %+v, %v", journal, err)
+	}
+	if err = FinishStateJournal(); err != nil {
+		t.Fatalf("FinishStateJournal() error = %v", err)
+	}
+	journal, _ = LoadStateJournal()
+	if journal.Runs["system master init"] != nil || journal.Steps["test/step"] == nil {
+		t.Errorf("FinishStateJournal() should only drop the run: %+v", journal)
+	}
+
+	// Without a journal, steps always run
+	RunStep("test/step", []any{"1.28.2", map[string]string{"docker.io": "https://mirror.gcr.io"}}, step)
+	if runs != 3 {
+		t.Errorf("RunStep(no journal) ran %d times, want 3", runs)
+	}
+}
+
+func TestParseStateFlags(t *testing.T) {
+	useFakeRunner(t)
+	previousStatePath := configs.System.StatePath
+	configs.System.StatePath = t.TempDir() + "/state.json"
+	defer func() { configs.System.StatePath, configs.System.Resume = previousStatePath, false }()
+	newFlagSet := func(k8sVersion *string, dryRun *bool) *flag.FlagSet {
+		flagSet := flag.NewFlagSet("system master init", flag.ContinueOnError)
+		flagSet.StringVar(k8sVersion, "k8s-version", "1.25.9", "")
+		flagSet.BoolVar(dryRun, "dry-run", false, "")
+		AddStateFlags(flagSet)
+		return flagSet
+	}
+
+	var k8sVersion string
+	var dryRun bool
+	if err := ParseStateFlags(newFlagSet(&k8sVersion, &dryRun), "system master init", []string{"-resume"}); err == nil {
+		t.Errorf("ParseStateFlags(-resume) should fail without a failed run")
+	}
+
+	// A run failing in a step is left in the journal with its parameters
+	configs.System.Resume = false
+	if err := ParseStateFlags(newFlagSet(&k8sVersion, &dryRun), "system master init", []string{"-k8s-version", "1.28.2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := StartStateJournal("system master init"); err != nil {
+		t.Fatal(err)
+	}
+	stateJournal.Runs["system master init"].CurrentStep = "system/install-kubernetes"
+	saveStateJournal()
+	stateJournal = nil
+
+	k8sVersion, configs.System.Resume = "", false
+	if err := ParseStateFlags(newFlagSet(&k8sVersion, &dryRun), "system master init", []string{"-resume", "-dry-run"}); err != nil {
+		t.Fatalf("ParseStateFlags(-resume) error = %v", err)
+	}
+	if k8sVersion != "1.28.2" || !dryRun {
+		t.Errorf("ParseStateFlags(-resume) = %s, %v, want the parameters of the failed run & the given ones", k8sVersion, dryRun)
+	}
+	if strings.Join(stateArgs, " ") != "-dry-run=true -k8s-version=1.28.2" {
+		t.Errorf("ParseStateFlags(-resume) records %v", stateArgs)
+	}
+}
+
+func TestSystemInitTwice(t *testing.T) {
+	fakeRunner := useFakeSystemInit(t)
+	useStateJournal(t, "system master init")
+
+	SystemInit()
+	configs.System.KubeletVersion = "1.25.8"
+	SystemInit()
+
+	for pattern, want := range map[string]int{
+		"sudo swapoff -a":                            1, // Unchanged steps are skipped
+		"if [ ! -f /etc/fstab.old ]":                 1,
+		"sudo tee /etc/containerd/config.toml":       1,
+		"sudo apt-mark hold kubelet kubeadm kubectl": 2, // Inputs changed
+		"sudo modprobe br_netfilter":                 2, // Not journaled, drift is fixed on every run
+	} {
+		if count := fakeRunner.Count(pattern); count != want {
+			t.Errorf("SystemInit() twice executed %q %d times, want %d\n%v", pattern, count, want, fakeRunner)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package system
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
+)
+
+// io.Writer splitting written data into lines, and handing each complete line to emit as soon as it arrives
+type lineWriter struct {
+	emit    func(line string)
+	pending []byte
+}
+
+func newLineWriter(emit func(line string)) *lineWriter {
+	return &lineWriter{emit: emit}
+}
+
+func (writer *lineWriter) Write(data []byte) (int, error) {
+	writer.pending = append(writer.pending, data...)
+	for {
+		newLineIndex := bytes.IndexByte(writer.pending, '\n')
+		if newLineIndex < 0 {
+			break
+		}
+		writer.emit(strings.TrimSuffix(string(writer.pending[:newLineIndex]), "\r"))
+		writer.pending = writer.pending[newLineIndex+1:]
+	}
+	return len(data), nil
+}
+
+// Emit the last incomplete line (if any)
+func (writer *lineWriter) Flush() {
+	if len(writer.pending) > 0 {
+		writer.emit(strings.TrimSuffix(string(writer.pending), "\r"))
+		writer.pending = nil
+	}
+}
+
+// Wrap stdout & stderr writers of a command, so that its output is teed line by line to the logs (and the terminal in verbose mode) while it runs
+// The returned function must be called after the command exits to flush the last incomplete lines
+func teeCommandOutput(stdout io.Writer, stderr io.Writer) (io.Writer, io.Writer, func()) {
+	stdoutLines := newLineWriter(func(line string) {
+		if logs.CommonLog != nil {
+			logs.CommonLog.Printf("| %s\n", line)
+		}
+		if configs.System.Verbose {
+			logs.EchoOutputLine(line)
+		}
+	})
+	stderrLines := newLineWriter(func(line string) {
+		if logs.ErrorLog != nil {
+			logs.ErrorLog.Printf("| %s\n", line)
+		}
+		if configs.System.Verbose {
+			logs.EchoOutputLine(line)
+		}
+	})
+	flush := func() {
+		stdoutLines.Flush()
+		stderrLines.Flush()
+	}
+	return io.MultiWriter(stdout, stdoutLines), io.MultiWriter(stderr, stderrLines), flush
+}
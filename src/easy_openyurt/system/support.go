@@ -0,0 +1,70 @@
+package system
+
+import (
+	"fmt"
+	"strings"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
+)
+
+// Get the minor version of a Kubernetes version (1.25.9-00 => 1.25)
+func kubeMinorVersion(version string) string {
+	fields := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(fields) < 2 {
+		return version
+	}
+	return fields[0] + "." + fields[1]
+}
+
+// Whether VERSION_ID matches a version of the support matrix ("9" matches "9.2")
+func matchOSVersion(supportedVersion string, osVersion string) bool {
+	return supportedVersion == "*" || supportedVersion == osVersion || strings.HasPrefix(osVersion, supportedVersion+".")
+}
+
+// Check the current OS & Kubernetes version against the support matrix
+func CheckSupportMatrix(kubeVersion string) error {
+	osTested := false
+	for _, platform := range configs.SupportMatrix {
+		if platform.OS != configs.System.CurrentOS {
+			continue
+		}
+		for _, osVersion := range platform.OSVersions {
+			if !matchOSVersion(osVersion, configs.System.CurrentOSVersion) {
+				continue
+			}
+			osTested = true
+			for _, supportedKubeVersion := range platform.KubeVersions {
+				if supportedKubeVersion == kubeMinorVersion(kubeVersion) {
+					return nil
+				}
+			}
+		}
+	}
+	if !osTested {
+		return fmt.Errorf("%s %s is untested, tested platforms are:\n%s", configs.System.CurrentOS, configs.System.CurrentOSVersion, formatSupportMatrix())
+	}
+	return fmt.Errorf("Kubernetes %s is untested on %s %s, tested combinations are:\n%s", kubeMinorVersion(kubeVersion), configs.System.CurrentOS, configs.System.CurrentOSVersion, formatSupportMatrix())
+}
+
+func formatSupportMatrix() string {
+	matrix := new(strings.Builder)
+	for _, platform := range configs.SupportMatrix {
+		fmt.Fprintf(matrix, "  %s %s: Kubernetes %s\n", platform.OS, strings.Join(platform.OSVersions, ", "), strings.Join(platform.KubeVersions, ", "))
+	}
+	return matrix.String()
+}
+
+// Refuse untested combinations of OS & Kubernetes version, or only warn about them with `-force`
+func EnsureSupportedPlatform(kubeVersion string) {
+	err := CheckSupportMatrix(kubeVersion)
+	if err == nil {
+		return
+	}
+	if configs.System.Force {
+		logs.WarnPrintf("%s", err)
+		logs.WarnPrintf("Proceeding anyway as -force is set!\n")
+		return
+	}
+	logs.FatalPrintf("%sUse -force to proceed anyway.\n", err)
+}
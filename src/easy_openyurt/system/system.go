@@ -2,13 +2,13 @@
 package system
 
 import (
-	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"os/exec"
-	"path"
 	"strings"
+	"time"
 
 	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
 	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
@@ -31,13 +31,21 @@ func ParseSubcommandSystem(args []string) {
 
 	// Check nodeRole
 	if (nodeRole != "master") && (nodeRole != "worker") {
-		logs.InfoPrintf("Usage: %s %s <master | worker> init [parameters...]\n", os.Args[0], os.Args[1])
+		logs.InfoPrintf("Usage: %s %s <master | worker> <init | check | reset> [parameters...]\n", os.Args[0], os.Args[1])
 		logs.FatalPrintf("Invalid nodeRole: <nodeRole> -> %s\n", nodeRole)
 	}
 
 	// Check operation
-	if operation != "init" {
-		logs.InfoPrintf("Usage: %s %s %s init [parameters...]\n", os.Args[0], os.Args[1], nodeRole)
+	switch operation {
+	case "init":
+	case "check":
+		parseSubcommandSystemCheck(nodeRole, args[2:])
+		return
+	case "reset":
+		parseSubcommandSystemReset(nodeRole, args[2:])
+		return
+	default:
+		logs.InfoPrintf("Usage: %s %s %s <init | check | reset> [parameters...]\n", os.Args[0], os.Args[1], nodeRole)
 		logs.FatalPrintf("Invalid operation: <operation> -> %s\n", operation)
 	}
 
@@ -46,69 +54,190 @@ func ParseSubcommandSystem(args []string) {
 	systemFlagsName := fmt.Sprintf("%s system %s init", os.Args[0], nodeRole)
 	systemFlags := flag.NewFlagSet(systemFlagsName, flag.ExitOnError)
 	systemFlags.StringVar(&configs.System.GoVersion, "go-version", configs.System.GoVersion, "Golang version")
+	systemFlags.StringVar(&configs.System.ContainerRuntime, "runtime", configs.System.ContainerRuntime, "Container runtime (containerd | crio)")
+	systemFlags.StringVar(&configs.System.CrioVersion, "crio-version", configs.System.CrioVersion, "CRI-O version, selecting the package repository (default -k8s-version)")
 	systemFlags.StringVar(&configs.System.ContainerdVersion, "containerd-version", configs.System.ContainerdVersion, "Containerd version")
 	systemFlags.StringVar(&configs.System.RuncVersion, "runc-version", configs.System.RuncVersion, "Runc version")
 	systemFlags.StringVar(&configs.System.CniPluginsVersion, "cni-plugins-version", configs.System.CniPluginsVersion, "CNI plugins version")
-	systemFlags.StringVar(&configs.System.KubectlVersion, "kubectl-version", configs.System.KubectlVersion, "Kubectl version")
-	systemFlags.StringVar(&configs.System.KubeadmVersion, "kubeadm-version", configs.System.KubeadmVersion, "Kubeadm version")
-	systemFlags.StringVar(&configs.System.KubeletVersion, "kubelet-version", configs.System.KubeletVersion, "Kubelet version")
+	var insecureRegistries string
+	var registryMirrors string
+	systemFlags.StringVar(&configs.Containerd.ConfigFilePath, "containerd-config", configs.Containerd.ConfigFilePath, "JSON file customizing the containerd config (sandbox image, snapshotter, registries & runtimes)")
+	systemFlags.StringVar(&configs.Crio.ConfigFilePath, "crio-config", configs.Crio.ConfigFilePath, "JSON file customizing the CRI-O config (pause image & registries), with -runtime=crio")
+	systemFlags.StringVar(&configs.Kube.AlternativeImageRepo, "alternative-image-repo", configs.Kube.AlternativeImageRepo, "Alternative image repository of the sandbox (pause) image")
+	systemFlags.StringVar(&configs.Kube.PodNetworkCidr, "pod-network-cidr", configs.Kube.PodNetworkCidr, "Pod network CIDR, excluded from the proxy (the same as of `kube master init`)")
+	systemFlags.StringVar(&insecureRegistries, "insecure-registries", "", "Comma-separated registries (host[:port]) reached over plain HTTP or TLS without verification, by the chosen -runtime")
+	systemFlags.StringVar(&registryMirrors, "registry-mirrors", "", "Comma-separated registry mirrors as host=mirror (e.g. docker.io=https://mirror.gcr.io), used by the chosen -runtime")
+	systemFlags.StringVar(&configs.System.UpgradePolicy, "upgrade-policy", configs.System.UpgradePolicy, "Policy on installed Golang, containerd, runc & CNI plugins: keep any version (keep), replace older versions (upgrade) or other versions (exact)")
+	systemFlags.StringVar(&configs.Kube.K8sVersion, "k8s-version", configs.Kube.K8sVersion, "Kubernetes version, selecting the package repository")
+	systemFlags.StringVar(&configs.System.KubeInstallMethod, "k8s-install-method", configs.System.KubeInstallMethod, "Install kubeadm, kubelet, kubectl from the package repository (package) or from release binaries (binary)")
+	systemFlags.StringVar(&configs.System.CrictlVersion, "crictl-version", configs.System.CrictlVersion, "Crictl version, installed by -k8s-install-method=binary (default <Kubernetes minor version>.0)")
+	systemFlags.StringVar(&configs.System.KubectlVersion, "kubectl-version", configs.System.KubectlVersion, "Kubectl version (default -k8s-version)")
+	systemFlags.StringVar(&configs.System.KubeadmVersion, "kubeadm-version", configs.System.KubeadmVersion, "Kubeadm version (default -k8s-version)")
+	systemFlags.StringVar(&configs.System.KubeletVersion, "kubelet-version", configs.System.KubeletVersion, "Kubelet version (default -k8s-version)")
 	systemFlags.BoolVar(&help, "help", false, "Show help")
 	systemFlags.BoolVar(&help, "h", false, "Show help")
-	systemFlags.Parse(args[2:])
+	AddGlobalFlags(systemFlags)
+	AddStateFlags(systemFlags)
+	AddPathFlags(systemFlags)
+	subcommand := fmt.Sprintf("system %s init", nodeRole)
+	err := ParseStateFlags(systemFlags, subcommand, args[2:])
 	// Show help
 	if help {
 		systemFlags.Usage()
 		os.Exit(0)
 	}
+	logs.CheckErrorWithMsg(err, "Failed to resume `%s`!\n", subcommand)
+	ApplyGlobalFlags()
+	// Load the config file of the container runtime, extended by the flags
+	var runtimeSettingsErr error
+	if configs.System.ContainerRuntime == RuntimeCrio {
+		err = LoadCrioSettings()
+		logs.CheckErrorWithMsg(err, "Failed to load CRI-O settings!\n")
+		if len(insecureRegistries) > 0 {
+			configs.Crio.InsecureRegistries = append(configs.Crio.InsecureRegistries, strings.Split(insecureRegistries, ",")...)
+		}
+		runtimeSettingsErr = errors.Join(AddRegistryMirrors(configs.Crio.RegistryMirrors, registryMirrors), ValidateCrioSettings())
+		if len(configs.Containerd.ConfigFilePath) > 0 {
+			runtimeSettingsErr = errors.Join(runtimeSettingsErr, errors.New("-containerd-config: not read by CRI-O, please use -crio-config"))
+		}
+	} else {
+		err = LoadContainerdSettings()
+		logs.CheckErrorWithMsg(err, "Failed to load containerd settings!\n")
+		if len(insecureRegistries) > 0 {
+			configs.Containerd.InsecureRegistries = append(configs.Containerd.InsecureRegistries, strings.Split(insecureRegistries, ",")...)
+		}
+		runtimeSettingsErr = errors.Join(AddRegistryMirrors(configs.Containerd.RegistryMirrors, registryMirrors), ValidateContainerdSettings())
+		if len(configs.Crio.ConfigFilePath) > 0 {
+			runtimeSettingsErr = errors.Join(runtimeSettingsErr, errors.New("-crio-config: only read with -runtime=crio"))
+		}
+	}
+	// Check parameters
+	err = errors.Join(
+		runtimeSettingsErr,
+		ValidateVersion("go-version", configs.System.GoVersion),
+		ValidateVersion("containerd-version", configs.System.ContainerdVersion),
+		ValidateVersion("runc-version", configs.System.RuncVersion),
+		ValidateVersion("cni-plugins-version", configs.System.CniPluginsVersion),
+		ValidateVersion("kubectl-version", KubePackageVersion(configs.System.KubectlVersion)),
+		ValidateVersion("kubeadm-version", KubePackageVersion(configs.System.KubeadmVersion)),
+		ValidateVersion("kubelet-version", KubePackageVersion(configs.System.KubeletVersion)),
+		ValidateVersion("k8s-version", configs.Kube.K8sVersion),
+		ValidateChoice("k8s-install-method", configs.System.KubeInstallMethod, KubeInstallPackage, KubeInstallBinary),
+		ValidateChoice("upgrade-policy", configs.System.UpgradePolicy, UpgradeKeep, UpgradeUpgrade, UpgradeExact),
+		ValidateChoice("runtime", configs.System.ContainerRuntime, RuntimeContainerd, RuntimeCrio),
+		ValidatePathFlags(),
+		ValidatePackageManager(),
+		ResolveKubeVersions(IsFlagSet(systemFlags, "k8s-version")))
+	err = errors.Join(err, ValidateKubeletCgroupPatch())
+	if configs.System.ContainerRuntime == RuntimeCrio {
+		err = errors.Join(err, ValidateCrioVersion())
+		if IsBundleMode() {
+			err = errors.Join(err, errors.New("-runtime: CRI-O can not be installed from a bundle"))
+		}
+	}
+	if len(configs.Kube.AlternativeImageRepo) > 0 {
+		err = errors.Join(err, ValidateImageRepo("alternative-image-repo", configs.Kube.AlternativeImageRepo))
+	}
+	err = errors.Join(err, ValidateCidr("pod-network-cidr", configs.Kube.PodNetworkCidr))
+	logs.CheckErrorWithMsg(err, "Invalid parameters!\n")
+	EnsureSupportedPlatform(configs.Kube.K8sVersion)
+	err = StartStateJournal(subcommand)
+	logs.CheckErrorWithMsg(err, "Failed to open the state journal %s!\n", configs.System.StatePath)
 	SystemInit()
+	err = FinishStateJournal()
+	logs.CheckErrorWithMsg(err, "Failed to update the state journal %s!\n", configs.System.StatePath)
 	logs.SuccessPrintf("Init System Successfully!\n")
 }
 
-// Execute Shell Command
-func ExecShellCmd(cmd string, pars ...any) (string, error) {
-	// Allocate bytes buffer
-	bashCmd := new(bytes.Buffer)
-	cmdStdout := new(bytes.Buffer)
-	cmdStderr := new(bytes.Buffer)
-	fmt.Fprintf(bashCmd, cmd, pars...)
-	bashProcess := exec.Command("bash", "-c", bashCmd.String())
-	// Redirect stdout & stderr
-	bashProcess.Stdout = cmdStdout
-	bashProcess.Stderr = cmdStderr
-
-	// Execute command
-	err := bashProcess.Run()
-
-	// remove suffix "\n" in Stdout & Stderr
-	var trimmedStdout string
-	var trimmedStderr string
-	if cmdStdout.Len() > 0 {
-		trimmedStdout = strings.TrimSuffix(cmdStdout.String(), "\n")
-	} else {
-		trimmedStdout = ""
-	}
-	if cmdStderr.Len() > 0 {
-		trimmedStderr = strings.TrimSuffix(cmdStderr.String(), "\n")
-	} else {
-		trimmedStderr = ""
+// Parse parameters for `system master/worker reset`
+func parseSubcommandSystemReset(nodeRole string, args []string) {
+	var help bool
+	var removeComponents bool
+	resetFlagsName := fmt.Sprintf("%s system %s reset", os.Args[0], nodeRole)
+	resetFlags := flag.NewFlagSet(resetFlagsName, flag.ExitOnError)
+	resetFlags.BoolVar(&removeComponents, "remove-components", false, "Also remove the components installed by `init` (Golang, containerd, runc, CNI plugins, CRI-O, kubeadm, kubelet, kubectl)")
+	resetFlags.StringVar(&configs.System.StatePath, "state-file", configs.System.StatePath, "State journal of the node, recording the changes of `init`")
+	resetFlags.BoolVar(&help, "help", false, "Show help")
+	resetFlags.BoolVar(&help, "h", false, "Show help")
+	AddGlobalFlags(resetFlags)
+	resetFlags.Parse(args)
+	// Show help
+	if help {
+		resetFlags.Usage()
+		os.Exit(0)
 	}
+	ApplyGlobalFlags()
 
-	// Rewrite error message
-	if err != nil {
-		err = &ShellError{msg: trimmedStderr, exitCode: bashProcess.ProcessState.ExitCode()}
+	logs.InfoPrintf("Resetting system...\n")
+	err := SystemReset(removeComponents)
+	logs.CheckErrorWithMsg(err, "Failed to reset system!\n")
+	logs.SuccessPrintf("Reset System Successfully!\n")
+}
+
+// Parse parameters for `system master/worker check`
+func parseSubcommandSystemCheck(nodeRole string, args []string) {
+	var help bool
+	var format string
+	var reportPath string
+	var comparePaths string
+	checkFlagsName := fmt.Sprintf("%s system %s check", os.Args[0], nodeRole)
+	checkFlags := flag.NewFlagSet(checkFlagsName, flag.ExitOnError)
+	checkFlags.StringVar(&format, "format", "table", "Format of the report (table | json)")
+	checkFlags.StringVar(&reportPath, "report", "", "Write the report to this file instead of the terminal")
+	checkFlags.StringVar(&comparePaths, "compare", "", "Comma-separated JSON reports of other nodes, to find duplicate hostnames, MACs & product_uuids")
+	checkFlags.StringVar(&configs.Kube.K8sVersion, "k8s-version", configs.Kube.K8sVersion, "Kubernetes version, selecting the package repository to resolve")
+	checkFlags.BoolVar(&help, "help", false, "Show help")
+	checkFlags.BoolVar(&help, "h", false, "Show help")
+	checkFlags.Parse(args)
+	// Show help
+	if help {
+		checkFlags.Usage()
+		os.Exit(0)
+	}
+	// Check parameters
+	err := errors.Join(
+		ValidateChoice("format", format, "table", "json"),
+		ValidateVersion("k8s-version", configs.Kube.K8sVersion))
+	logs.CheckErrorWithMsg(err, "Invalid parameters!\n")
+	peers := map[string]*CheckReport{}
+	for _, comparePath := range strings.Split(comparePaths, ",") {
+		if len(comparePath) == 0 {
+			continue
+		}
+		peers[comparePath], err = ReadCheckReport(comparePath)
+		logs.CheckErrorWithMsg(err, "Failed to read report %s!\n", comparePath)
 	}
 
-	// For logs
-	if logs.CommonLog != nil {
-		logs.CommonLog.Printf("Executing shell command: %s\n", bashCmd.String())
-		logs.CommonLog.Printf("Stdout from shell:\n%s\n", trimmedStdout)
+	logs.InfoPrintf("Checking system...\n")
+	report := CheckSystem(nodeRole, peers)
+	writer := os.Stdout
+	if len(reportPath) > 0 {
+		writer, err = os.Create(reportPath)
+		logs.CheckErrorWithMsg(err, "Failed to create report %s!\n", reportPath)
+		defer writer.Close()
 	}
-	if logs.ErrorLog != nil {
-		logs.ErrorLog.Printf("Executing shell command: %s\n", bashCmd.String())
-		logs.ErrorLog.Printf("Stderr from shell:\n%s\n", trimmedStderr)
+	err = WriteCheckReport(writer, report, format)
+	logs.CheckErrorWithMsg(err, "Failed to write report!\n")
+	if failed := report.Count(CheckFail); failed > 0 {
+		logs.FatalPrintf("%d of %d checks failed!\n", failed, len(report.Results))
 	}
+	logs.SuccessPrintf("All checks passed (%d warnings)!\n", report.Count(CheckWarn))
+}
+
+// Execute Shell Command
+// Values interpolated into the shell command must be constant or quoted with `ShellQuote()`, prefer `ExecCmd()` otherwise
+func ExecShellCmd(cmd string, pars ...any) (string, error) {
+	return runCommand(&Command{Shell: fmt.Sprintf(cmd, pars...)})
+}
+
+// Execute command directly (without shell), so that its arguments are never interpreted by a shell
+func ExecCmd(name string, args ...string) (string, error) {
+	return runCommand(&Command{Args: append([]string{name}, args...)})
+}
 
-	return trimmedStdout, err
+// Execute command directly (without shell) with stdin data
+func ExecCmdWithInput(stdin string, name string, args ...string) (string, error) {
+	return runCommand(&Command{Args: append([]string{name}, args...), Stdin: stdin})
 }
 
 // Detect current architecture
@@ -125,15 +254,16 @@ func DetectOS() {
 	case "windows":
 		logs.FatalPrintf("Unsupported OS: %s\n", configs.System.CurrentOS)
 	default:
-		var err error
-		configs.System.CurrentOS, err = ExecShellCmd("sed -n 's/^NAME=\"\\(.*\\)\"/\\1/p' < /etc/os-release | head -1 | tr '[:upper:]' '[:lower:]'")
+		osRelease, err := ReadOsRelease()
 		logs.CheckErrorWithMsg(err, "Failed to get Linux distribution info!\n")
-		switch configs.System.CurrentOS {
-		case "ubuntu":
-		default:
-			logs.FatalPrintf("Unsupported Linux distribution: %s\n", configs.System.CurrentOS)
+		configs.System.CurrentOS = osRelease.Id
+		configs.System.CurrentOSVersion = osRelease.VersionId
+		configs.System.CurrentOSCodename = osRelease.VersionCodename
+		configs.System.CurrentOSLike = osRelease.IdLike
+		if _, err = GetPackageManager(); err != nil {
+			logs.WarnPrintf("No supported package manager on %s, dependencies have to be installed by hand and Kubernetes with -k8s-install-method=binary!\n", osRelease.PrettyName)
 		}
-		logs.InfoPrintf("Detected OS: %s\n", strings.TrimSuffix(string(configs.System.CurrentOS), "\n"))
+		logs.InfoPrintf("Detected OS: %s (%s %s)\n", osRelease.PrettyName, configs.System.CurrentOS, configs.System.CurrentOSVersion)
 	}
 }
 
@@ -151,151 +281,177 @@ func GetUserHomeDir() {
 	logs.CheckErrorWithMsg(err, "Failed to get current home directory!\n")
 }
 
+var tmpDirExitHookRegistered = false
+
 // Create temporary directory
 func CreateTmpDir() {
 	var err error
 	logs.WaitPrintf("Creating temporary directory")
 	configs.System.TmpDir, err = os.MkdirTemp("", "yurt_tmp")
+	if !tmpDirExitHookRegistered {
+		// Clean up even if the program exits on failure or interruption
+		logs.RegisterExitHook(CleanUpTmpDir)
+		tmpDirExitHookRegistered = true
+	}
+	if err == nil && IsDryRun() {
+		// Make the plan script self-contained
+		_, err = ExecCmd("mkdir", "-p", configs.System.TmpDir)
+	}
 	logs.CheckErrorWithTagAndMsg(err, "Failed to create temporary directory!\n")
 }
 
 // Clean up temporary directory
 func CleanUpTmpDir() {
+	if len(configs.System.TmpDir) == 0 {
+		return
+	}
 	logs.WaitPrintf("Cleaning up temporary directory")
+	if IsDryRun() {
+		ExecCmd("rm", "-rf", configs.System.TmpDir)
+	}
 	err := os.RemoveAll(configs.System.TmpDir)
-	logs.CheckErrorWithTagAndMsg(err, "Failed to create temporary directory!\n")
+	configs.System.TmpDir = ""
+	logs.CheckErrorWithTagAndMsg(err, "Failed to clean up temporary directory!\n")
 }
 
-// Download file to temporary directory (absolute path of downloaded file will be the first return value if successful)
-func DownloadToTmpDir(urlTemplate string, pars ...any) (string, error) {
-	url := fmt.Sprintf(urlTemplate, pars...)
-	fileName := path.Base(url)
-	filePath := configs.System.TmpDir + "/" + fileName
-	_, err := ExecShellCmd("curl -sSL --output %s %s", filePath, url)
-	return filePath, err
-}
-
-// Extract arhive file to specific directory(currently support .tar.gz file only)
-func ExtractToDir(filePath string, dirPath string, privileged bool) error {
-	var err error
-	if privileged {
-		_, err = ExecShellCmd("sudo tar -xzvf %s -C %s", filePath, dirPath)
-	} else {
-		_, err = ExecShellCmd("tar -xzvf %s -C %s", filePath, dirPath)
+// Poll condition every second until it is satisfied or the step times out, printing the elapsed time while waiting
+// In dry-run mode the condition is only evaluated once, so that the commands it runs appear in the plan
+func WaitUntil(description string, condition func() (bool, error)) error {
+	ctx, cancel := StepContext()
+	defer cancel()
+	waitCount := 1
+	for {
+		satisfied, err := condition()
+		if err != nil {
+			return err
+		}
+		if satisfied || IsDryRun() {
+			return nil
+		}
+		logs.WarnPrintf("Waiting for %s [%ds]\n", description, waitCount)
+		waitCount += 1
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up waiting for %s: %w", description, ctx.Err())
+		case <-time.After(time.Second):
+		}
 	}
-	return err
 }
 
-// Install packages on various OS
+// Install packages on various OS, named as on Ubuntu
 func InstallPackages(packagesTemplate string, pars ...any) error {
-	packages := fmt.Sprintf(packagesTemplate, pars...)
-	switch configs.System.CurrentOS {
-	case "ubuntu":
-		_, err := ExecShellCmd("sudo apt-get -qq update && sudo apt-get -qq install -y --allow-downgrades %s", packages)
-		return err
-	case "centos":
-		_, err := ExecShellCmd("sudo dnf -y -q install %s", packages)
-		return err
-	case "rocky linux":
-		_, err := ExecShellCmd("sudo dnf -y -q install %s", packages)
-		return err
-	default:
-		logs.FatalPrintf("Unsupported Linux distribution: %s\n", configs.System.CurrentOS)
-		return &ShellError{msg: "Unsupported Linux distribution", exitCode: 1}
+	packages := strings.Fields(fmt.Sprintf(packagesTemplate, pars...))
+	packageManager, err := GetPackageManager()
+	if err != nil {
+		// Installed by hand on distributions without a supported package manager
+		return checkPackageCommands(packages)
 	}
+	return packageManager.Install(packages...)
 }
 
-// Turn off unattended-upgrades
-func TurnOffAutomaticUpgrade() (string, error) {
-	switch configs.System.CurrentOS {
-	case "ubuntu":
-		_, err := os.Stat("/etc/apt/apt.conf.d/20auto-upgrades")
-		if err == nil {
-			return ExecShellCmd("sudo sed -i 's/\"1\"/\"0\"/g' /etc/apt/apt.conf.d/20auto-upgrades")
-		}
-		return "", nil
-	default:
-		return "", nil
+// Turn off automatic upgrades (unattended-upgrades, dnf-automatic, ...)
+func TurnOffAutomaticUpgrade() error {
+	packageManager, err := GetPackageManager()
+	if err != nil {
+		return err
 	}
+	return packageManager.DisableAutomaticUpgrade()
 }
 
 // Check system environment
 func CheckSystemEnvironment() {
 	// Check system environment
 	logs.InfoPrintf("Checking system environment...\n")
-	var err error
 
 	// Check Golang
-	_, err = exec.LookPath("go")
-	if err != nil {
-		logs.WarnPrintf("Golang not found! Golang(version %s) will be automatically installed!\n", configs.System.GoVersion)
-	} else {
-		logs.SuccessPrintf("Golang found!\n")
-		configs.System.GoInstalled = true
-	}
+	configs.System.GoInstalled = keepInstalledComponent("go", "Golang", configs.System.GoVersion)
 
-	// Check Containerd
-	_, err = exec.LookPath("containerd")
-	if err != nil {
-		logs.WarnPrintf("Containerd not found! containerd(version %s) will be automatically installed!\n", configs.System.ContainerdVersion)
-	} else {
-		logs.SuccessPrintf("Containerd found!\n")
-		configs.System.ContainerdInstalled = true
-	}
-
-	// Check runc
-	_, err = exec.LookPath("runc")
-	if err != nil {
-		logs.WarnPrintf("runc not found! runc(version %s) will be automatically installed!\n", configs.System.RuncVersion)
-	} else {
-		logs.SuccessPrintf("runc found!\n")
-		configs.System.RuncInstalled = true
+	// Check Containerd & runc, replaced by the CRI-O packages otherwise
+	if configs.System.ContainerRuntime == RuntimeContainerd {
+		configs.System.ContainerdInstalled = keepInstalledComponent("containerd", "Containerd", configs.System.ContainerdVersion)
+		configs.System.RuncInstalled = keepInstalledComponent("runc", "runc", configs.System.RuncVersion)
 	}
 
 	// Check CNI plugins
-	_, err = os.Stat("/opt/cni/bin")
-	if err != nil {
-		logs.WarnPrintf("CNI plugins not found! CNI plugins(version %s) will be automatically installed!\n", configs.System.CniPluginsVersion)
-	} else {
-		logs.SuccessPrintf("CNI plugins found!\n")
-		configs.System.CniPluginsInstalled = true
-	}
+	configs.System.CniPluginsInstalled = keepInstalledComponent("cni-plugins", "CNI plugins", configs.System.CniPluginsVersion)
 
 	// Add OS-specific dependencies to installation lists
-	switch configs.System.CurrentOS {
-	case "ubuntu":
-		configs.System.Dependencies = "git wget curl build-essential apt-transport-https ca-certificates"
-	case "rocky linux":
-		configs.System.Dependencies = ""
-	case "centos":
-		configs.System.Dependencies = ""
-	default:
-		logs.FatalPrintf("Unsupported Linux distribution: %s\n", configs.System.CurrentOS)
-	}
+	configs.System.Dependencies = systemDependencies()
 
 	logs.SuccessPrintf("Finish checking system environment!\n")
 }
 
+// Directory of CNI plugins
+var cniPluginsDir = "/opt/cni/bin"
+
+// Whether a component installed by `SystemInit()` is already present
+func componentInstalled(component string) bool {
+	if component == "cni-plugins" {
+		_, err := os.Stat(cniPluginsDir)
+		return err == nil
+	}
+	_, err := exec.LookPath(component)
+	return err == nil
+}
+
+// Get dependencies of `SystemInit()`, named as on Ubuntu
+func systemDependencies() string {
+	return "git wget curl build-essential apt-transport-https ca-certificates"
+}
+
 // Create logs
 func CreateLogs() {
 	logs.CreateLogs(configs.System.CurrentDir)
 }
 
-// Append directory to PATH variable for bash & zsh
-func AppendDirToPath(pathTemplate string, pars ...any) error {
-	appendedPath := fmt.Sprintf(pathTemplate, pars...)
-
-	// For bash
-	_, err := ExecShellCmd("echo 'export PATH=$PATH:%s' >> %s/.bashrc", appendedPath, configs.System.UserHomeDir)
-	if err != nil {
-		return err
+// Get artifacts needed by `SystemInit()` for the configured versions
+func BundleArtifacts() ([]*Artifact, error) {
+	components := []string{"go", "containerd", "runc", "cni-plugins"}
+	if configs.System.KubeInstallMethod == KubeInstallBinary {
+		components = append(components, "kubernetes-binaries", "crictl")
+	} else {
+		components = append(components, "kubernetes-packages")
 	}
-	// For zsh
-	_, err = exec.LookPath("zsh")
-	if err != nil {
-		_, err = ExecShellCmd("echo 'export PATH=$PATH:%s' >> %s/.zshrc", appendedPath, configs.System.UserHomeDir)
+	if cosignNeeded() {
+		components = append(components, "cosign")
+	}
+	if err := CheckArchSupport(components...); err != nil {
+		return nil, err
+	}
+	artifacts := []*Artifact{
+		{Kind: ArtifactFile,
+			Source:    fmt.Sprintf(configs.System.GoDownloadUrlTemplate, configs.System.GoVersion, configs.ArchName("go")),
+			Sha256Url: fmt.Sprintf(configs.System.GoChecksumUrlTemplate, configs.System.GoVersion, configs.ArchName("go"))},
+		{Kind: ArtifactFile,
+			Source:    fmt.Sprintf(configs.System.ContainerdDownloadUrlTemplate, configs.System.ContainerdVersion, configs.System.ContainerdVersion, configs.ArchName("containerd")),
+			Sha256Url: fmt.Sprintf(configs.System.ContainerdChecksumUrlTemplate, configs.System.ContainerdVersion, configs.System.ContainerdVersion, configs.ArchName("containerd"))},
+		{Kind: ArtifactFile, Source: configs.System.ContainerdSystemdProfileDownloadUrl},
+		{Kind: ArtifactFile,
+			Source:    fmt.Sprintf(configs.System.RuncDownloadUrlTemplate, configs.System.RuncVersion, configs.ArchName("runc")),
+			Sha256Url: fmt.Sprintf(configs.System.RuncChecksumUrlTemplate, configs.System.RuncVersion)},
+		{Kind: ArtifactFile,
+			Source:    fmt.Sprintf(configs.System.CniPluginsDownloadUrlTemplate, configs.System.CniPluginsVersion, configs.ArchName("cni-plugins"), configs.System.CniPluginsVersion),
+			Sha256Url: fmt.Sprintf(configs.System.CniPluginsChecksumUrlTemplate, configs.System.CniPluginsVersion, configs.ArchName("cni-plugins"), configs.System.CniPluginsVersion)},
 	}
-	return err
+	if configs.System.KubeInstallMethod == KubeInstallBinary {
+		artifacts = append(artifacts, kubeBinaryArtifacts()...)
+	} else {
+		artifacts = append(artifacts,
+			&Artifact{Kind: ArtifactFile, Source: KubeRepo().KeyUrl},
+			&Artifact{Kind: ArtifactPackage, Source: (&aptPackageManager{}).VersionedPackage("kubeadm", KubePackageVersion(configs.System.KubeadmVersion))},
+			&Artifact{Kind: ArtifactPackage, Source: (&aptPackageManager{}).VersionedPackage("kubelet", KubePackageVersion(configs.System.KubeletVersion))},
+			&Artifact{Kind: ArtifactPackage, Source: (&aptPackageManager{}).VersionedPackage("kubectl", KubePackageVersion(configs.System.KubectlVersion))})
+	}
+	if signature := ContainerdSignature(); signature != nil {
+		artifacts = append(artifacts, signature.artifacts()...)
+	}
+	if cosignNeeded() {
+		artifacts = append(artifacts, cosignArtifacts()...)
+	}
+	for _, dependency := range strings.Fields(systemDependencies()) {
+		artifacts = append(artifacts, &Artifact{Kind: ArtifactPackage, Source: dependency})
+	}
+	return artifacts, nil
 }
 
 // Initialize system environment
@@ -304,135 +460,244 @@ func SystemInit() {
 	// Initialize
 	var err error
 	CheckSystemEnvironment()
+	// Match the cgroup driver of the container runtime & kubelet to the node
+	err = ConfigureCgroupDriver()
+	logs.CheckErrorWithMsg(err, "Failed to detect the cgroup setup!\n")
+	// Check releases for the current architecture, before anything is modified
+	err = CheckArchSupport(systemComponents()...)
+	logs.CheckErrorWithMsg(err, "Unsupported architecture %s!\n", configs.System.CurrentArch)
 	CreateTmpDir()
 	defer CleanUpTmpDir()
-
-	// Turn off unattended-upgrades on ubuntu
-	logs.WaitPrintf("Turning off automatic upgrade")
-	_, err = TurnOffAutomaticUpgrade()
-	logs.CheckErrorWithTagAndMsg(err, "Failed to turn off automatic upgrade!\n")
+	// Only nil with -k8s-install-method=binary (see `ValidatePackageManager()`)
+	packageManager, _ := GetPackageManager()
+
+	// Turn off automatic upgrades
+	if packageManager != nil {
+		RunStep("system/turn-off-automatic-upgrade", packageManager.Name(), func() {
+			logs.WaitPrintf("Turning off automatic upgrade")
+			err := TurnOffAutomaticUpgrade()
+			logs.CheckErrorWithTagAndMsg(err, "Failed to turn off automatic upgrade!\n")
+		})
+	}
 
 	// Disable swap
-	logs.WaitPrintf("Disabling swap")
-	_, err = ExecShellCmd("sudo swapoff -a && sudo cp /etc/fstab /etc/fstab.old") // Turn off Swap && Backup fstab file
-	logs.CheckErrorWithTagAndMsg(err, "Failed to disable swap!\n")
+	RunStep("system/disable-swap", nil, func() {
+		logs.WaitPrintf("Disabling swap")
+		err := RecordFileChange("/etc/fstab")
+		logs.CheckErrorWithMsg(err, "Failed to back up fstab!\n")
+		_, err = ExecShellCmd("sudo swapoff -a && if [ ! -f /etc/fstab.old ]; then sudo cp /etc/fstab /etc/fstab.old; fi") // Turn off Swap && Backup the original fstab file
+		logs.CheckErrorWithTagAndMsg(err, "Failed to disable swap!\n")
+
+		logs.WaitPrintf("Modifying fstab")
+		// Modify fstab to disable swap permanently
+		_, err = ExecShellCmd("sudo sed -i 's/#\\s*\\(.*swap.*\\)/\\1/g' /etc/fstab && sudo sed -i 's/.*swap.*/# &/g' /etc/fstab")
+		logs.CheckErrorWithTagAndMsg(err, "Failed to dodify fstab!\n")
+	})
+
+	// Configure proxy for the package manager
+	if packageManager != nil {
+		RunStep("system/configure-package-manager-proxy", []any{packageManager.Name(), ProxyEnvironment()}, func() {
+			logs.WaitPrintf("Configuring proxy for %s", packageManager.Name())
+			err := packageManager.ConfigureProxy()
+			logs.CheckErrorWithTagAndMsg(err, "Failed to configure proxy for %s!\n", packageManager.Name())
+		})
+	}
 
-	logs.WaitPrintf("Modifying fstab")
-	// Modify fstab to disable swap permanently
-	_, err = ExecShellCmd("sudo sed -i 's/#\\s*\\(.*swap.*\\)/\\1/g' /etc/fstab && sudo sed -i 's/.*swap.*/# &/g' /etc/fstab")
-	logs.CheckErrorWithTagAndMsg(err, "Failed to dodify fstab!\n")
+	// Put SELinux into permissive mode, as required by kubeadm
+	if _, err = os.Stat("/etc/selinux/config"); err == nil {
+		RunStep("system/set-selinux-permissive", nil, func() {
+			logs.WaitPrintf("Setting SELinux to permissive mode")
+			err := RecordFileChange("/etc/selinux/config")
+			logs.CheckErrorWithMsg(err, "Failed to set SELinux to permissive mode!\n")
+			_, err = ExecShellCmd("sudo setenforce 0 || true; sudo sed -i 's/^SELINUX=enforcing$/SELINUX=permissive/' /etc/selinux/config")
+			logs.CheckErrorWithTagAndMsg(err, "Failed to set SELinux to permissive mode!\n")
+		})
+	}
 
 	// Install dependencies
-	logs.WaitPrintf("Installing dependencies")
-	err = InstallPackages(configs.System.Dependencies)
-	logs.CheckErrorWithTagAndMsg(err, "Failed to install dependencies!\n")
+	RunStep("system/install-dependencies", configs.System.Dependencies, func() {
+		logs.WaitPrintf("Installing dependencies")
+		err := InstallPackages(configs.System.Dependencies)
+		logs.CheckErrorWithTagAndMsg(err, "Failed to install dependencies!\n")
+	})
+
+	// Install cosign, verifying the signatures of Kubernetes binaries & containerd
+	if cosignNeeded() {
+		logs.WaitPrintf("Installing cosign(ver %s)", configs.System.CosignVersion)
+		err = InstallCosign()
+		logs.CheckErrorWithTagAndMsg(err, "Failed to install cosign(ver %s)! Skip signature checks with -verify-signatures=false\n", configs.System.CosignVersion)
+	}
+
+	// Golang, containerd, runc & CNI plugins are probed by `CheckSystemEnvironment()` rather than journaled,
+	// so that components removed since an earlier run are installed again
 
 	// Install Golang
 	if !configs.System.GoInstalled {
 		// Download & Extract Golang
 		logs.WaitPrintf("Downloading Golang(ver %s)", configs.System.GoVersion)
-		filePathName, err := DownloadToTmpDir(configs.System.GoDownloadUrlTemplate, configs.System.GoVersion, configs.System.CurrentArch)
+		filePathName, err := DownloadToTmpDirWithChecksum(
+			fmt.Sprintf(configs.System.GoChecksumUrlTemplate, configs.System.GoVersion, configs.ArchName("go")),
+			configs.System.GoDownloadUrlTemplate,
+			configs.System.GoVersion,
+			configs.ArchName("go"))
 		logs.CheckErrorWithTagAndMsg(err, "Failed to download Golang(ver %s)!\n", configs.System.GoVersion)
 		logs.WaitPrintf("Extracting Golang")
-		_, err = ExecShellCmd("sudo rm -rf /usr/local/go && sudo tar -C /usr/local -xzf %s", filePathName)
+		err = recordComponentInstall("go", goRootDir)
+		logs.CheckErrorWithMsg(err, "Failed to extract Golang!\n")
+		_, err = ExecCmd("sudo", "rm", "-rf", goRootDir)
+		logs.CheckErrorWithMsg(err, "Failed to extract Golang!\n")
+		err = ExtractToDir(filePathName, "/usr/local", true)
 		logs.CheckErrorWithTagAndMsg(err, "Failed to extract Golang!\n")
 
-		// For bash
-		_, err = ExecShellCmd("echo 'export PATH=$PATH:/usr/local/go/bin' >> %s/.bashrc", configs.System.UserHomeDir)
+		// Update PATH
+		err = AppendDirToPath(goRootDir + "/bin")
 		logs.CheckErrorWithMsg(err, "Failed to update PATH!\n")
-		// For zsh
-		_, err = exec.LookPath("zsh")
-		if err != nil {
-			_, err = ExecShellCmd("echo 'export PATH=$PATH:/usr/local/go/bin' >> %s/.zshrc", configs.System.UserHomeDir)
-			logs.CheckErrorWithMsg(err, "Failed to update PATH!\n")
-		}
+		warnShadowedExecutable("go", goBinaryPath)
 	}
 
 	// Install containerd
-	if !configs.System.ContainerdInstalled {
+	if configs.System.ContainerRuntime == RuntimeContainerd && !configs.System.ContainerdInstalled {
 		// Download containerd
 		logs.WaitPrintf("Downloading containerd(ver %s)", configs.System.ContainerdVersion)
-		filePathName, err := DownloadToTmpDir(
+		filePathName, err := DownloadToTmpDirWithSignature(
+			ContainerdSignature(),
+			fmt.Sprintf(configs.System.ContainerdChecksumUrlTemplate, configs.System.ContainerdVersion, configs.System.ContainerdVersion, configs.ArchName("containerd")),
 			configs.System.ContainerdDownloadUrlTemplate,
 			configs.System.ContainerdVersion,
 			configs.System.ContainerdVersion,
-			configs.System.CurrentArch)
+			configs.ArchName("containerd"))
 		logs.CheckErrorWithTagAndMsg(err, "Failed to Download containerd(ver %s)\n", configs.System.ContainerdVersion)
+		// Stop containerd being replaced, started again below
+		if componentInstalled("containerd") {
+			logs.WaitPrintf("Stopping containerd")
+			_, err = ExecShellCmd("if systemctl is-active --quiet containerd; then sudo systemctl stop containerd; fi")
+			logs.CheckErrorWithTagAndMsg(err, "Failed to stop containerd!\n")
+		}
 		// Extract containerd
 		logs.WaitPrintf("Extracting containerd")
-		_, err = ExecShellCmd("sudo tar Cxzvf /usr/local %s", filePathName)
+		err = recordComponentInstall("containerd", containerdBinaryPath)
+		logs.CheckErrorWithMsg(err, "Failed to extract containerd!\n")
+		err = ExtractToDir(filePathName, "/usr/local", true)
 		logs.CheckErrorWithTagAndMsg(err, "Failed to extract containerd!\n")
 		// Start containerd via systemd
 		logs.WaitPrintf("Downloading systemd profile for containerd")
 		filePathName, err = DownloadToTmpDir(configs.System.ContainerdSystemdProfileDownloadUrl)
 		logs.CheckErrorWithTagAndMsg(err, "Failed to download systemd profile for containerd!\n")
 		logs.WaitPrintf("Starting containerd via systemd")
-		_, err = ExecShellCmd("sudo cp %s /lib/systemd/system/ && sudo systemctl daemon-reload && sudo systemctl enable --now containerd", filePathName)
+		_, err = ExecShellCmd("sudo cp %s /lib/systemd/system/ && sudo systemctl daemon-reload", ShellQuote(filePathName))
+		logs.CheckErrorWithMsg(err, "Failed to start containerd via systemd!\n")
+		err = VerifyContainerdUnit()
+		logs.CheckErrorWithMsg(err, "Failed to start containerd via systemd!\n")
+		_, err = ExecCmd("sudo", "systemctl", "enable", "--now", "containerd")
 		logs.CheckErrorWithTagAndMsg(err, "Failed to start containerd via systemd!\n")
+		warnShadowedExecutable("containerd", containerdBinaryPath)
 	}
 
 	// Install runc
-	if !configs.System.RuncInstalled {
+	if configs.System.ContainerRuntime == RuntimeContainerd && !configs.System.RuncInstalled {
 		// Download runc
 		logs.WaitPrintf("Downloading runc(ver %s)", configs.System.RuncVersion)
-		filePathName, err := DownloadToTmpDir(
+		filePathName, err := DownloadToTmpDirWithChecksum(
+			fmt.Sprintf(configs.System.RuncChecksumUrlTemplate, configs.System.RuncVersion),
 			configs.System.RuncDownloadUrlTemplate,
 			configs.System.RuncVersion,
-			configs.System.CurrentArch)
+			configs.ArchName("runc"))
 		logs.CheckErrorWithTagAndMsg(err, "Failed to download runc(ver %s)!\n", configs.System.RuncVersion)
 		// Install runc
 		logs.WaitPrintf("Installing runc")
-		_, err = ExecShellCmd("sudo install -m 755 %s /usr/local/sbin/runc", filePathName)
+		err = recordComponentInstall("runc", "/usr/local/sbin/runc")
+		logs.CheckErrorWithMsg(err, "Failed to install runc!\n")
+		_, err = ExecCmd("sudo", "install", "-m", "755", filePathName, "/usr/local/sbin/runc")
 		logs.CheckErrorWithTagAndMsg(err, "Failed to install runc!\n")
 	}
 
 	// Install CNI plugins
 	if !configs.System.CniPluginsInstalled {
 		logs.WaitPrintf("Downloading CNI plugins(ver %s)", configs.System.CniPluginsVersion)
-		filePathName, err := DownloadToTmpDir(
+		filePathName, err := DownloadToTmpDirWithChecksum(
+			fmt.Sprintf(configs.System.CniPluginsChecksumUrlTemplate, configs.System.CniPluginsVersion, configs.ArchName("cni-plugins"), configs.System.CniPluginsVersion),
 			configs.System.CniPluginsDownloadUrlTemplate,
 			configs.System.CniPluginsVersion,
-			configs.System.CurrentArch,
+			configs.ArchName("cni-plugins"),
 			configs.System.CniPluginsVersion)
 		logs.CheckErrorWithTagAndMsg(err, "Failed to download CNI plugins(ver %s)!\n", configs.System.CniPluginsVersion)
 		logs.WaitPrintf("Extracting CNI plugins")
-		_, err = ExecShellCmd("sudo mkdir -p /opt/cni/bin && sudo tar Cxzvf /opt/cni/bin %s", filePathName)
+		err = recordArchiveInstall("cni-plugins", filePathName, cniPluginsDir)
+		logs.CheckErrorWithMsg(err, "Failed to extract CNI plugins!\n")
+		err = ExtractToDir(filePathName, cniPluginsDir, true)
 		logs.CheckErrorWithTagAndMsg(err, "Failed to extract CNI plugins!\n")
 	}
 
-	// Configure the systemd cgroup driver
-	logs.WaitPrintf("Configuring the systemd cgroup driver")
-	_, err = ExecShellCmd(
-		"containerd config default > %s && sudo mkdir -p /etc/containerd && sudo cp %s /etc/containerd/config.toml && sudo sed -i 's/SystemdCgroup = false/SystemdCgroup = true/g' /etc/containerd/config.toml && sudo systemctl restart containerd",
-		configs.System.TmpDir+"/config.toml",
-		configs.System.TmpDir+"/config.toml")
-	logs.CheckErrorWithTagAndMsg(err, "Failed to configure the systemd cgroup driver!\n")
+	if configs.System.ContainerRuntime == RuntimeContainerd {
+		// Configure containerd (proxy, cgroup driver, sandbox image, registries & runtimes)
+		RunStep("system/configure-containerd", []any{configs.Containerd, ProxyEnvironment()}, func() {
+			logs.WaitPrintf("Configuring proxy for containerd")
+			err := ConfigureServiceProxy("containerd")
+			logs.CheckErrorWithTagAndMsg(err, "Failed to configure proxy for containerd!\n")
+			logs.WaitPrintf("Configuring containerd")
+			err = ConfigureContainerd()
+			logs.CheckErrorWithTagAndMsg(err, "Failed to configure containerd!\n")
+			logs.WaitPrintf("Restarting containerd")
+			_, err = ExecCmd("sudo", "systemctl", "restart", "containerd")
+			logs.CheckErrorWithTagAndMsg(err, "Failed to restart containerd!\n")
+		})
+	}
 
-	// Enable IP forwading & br_netfilter
-	logs.WaitPrintf("Enabling IP forwading & br_netfilter")
-	_, err = ExecShellCmd("sudo modprobe br_netfilter && sudo modprobe overlay && sudo sysctl -w net.ipv4.ip_forward=1 && sudo sysctl -w net.ipv4.conf.all.forwarding=1 && sudo sysctl -w net.bridge.bridge-nf-call-iptables=1 && sudo sysctl -w net.bridge.bridge-nf-call-ip6tables=1")
-	logs.CheckErrorWithTagAndMsg(err, "Failed to enable IP forwading & br_netfilter!\n")
-	// Ensure Boot-Resistant
-	logs.WaitPrintf("Ensuring Boot-Resistant")
-	_, err = ExecShellCmd("echo 'br_netfilter' | sudo tee /etc/modules-load.d/netfilter.conf && echo 'overlay' | sudo tee -a /etc/modules-load.d/netfilter.conf && sudo sed -i 's/# *net.ipv4.ip_forward=1/net.ipv4.ip_forward=1/g' /etc/sysctl.conf && sudo sed -i 's/net.ipv4.ip_forward=0/net.ipv4.ip_forward=1/g' /etc/sysctl.conf && echo 'net.bridge.bridge-nf-call-iptables=1\nnet.bridge.bridge-nf-call-ip6tables=1\nnet.ipv4.conf.all.forwarding=1' | sudo tee /etc/sysctl.d/99-kubernetes-cri.conf")
-	logs.CheckErrorWithTagAndMsg(err, "Failed to ensure Boot-Resistant!\n")
+	// Load br_netfilter & overlay, enable IP forwarding (also after reboots)
+	// Not journaled, so that modules unloaded & sysctls changed since an earlier run are fixed again
+	logs.WaitPrintf("Loading kernel modules & applying sysctls")
+	err = ConfigureKernel()
+	logs.CheckErrorWithTagAndMsg(err, "Failed to load kernel modules & apply sysctls!\n")
+
+	// Install CRI-O (after br_netfilter & overlay are loaded)
+	if configs.System.ContainerRuntime == RuntimeCrio {
+		RunStep("system/install-crio", []any{crioMinorVersion(), CrioConfig(), CrioRegistriesConfig(), ProxyEnvironment()}, func() {
+			installCrio(packageManager)
+		})
+	}
 
 	// Install kubeadm, kubelet, kubectl
-	switch configs.System.CurrentOS {
-	case "ubuntu":
-		// Download Google Cloud public signing key and Add the Kubernetes apt repository
-		logs.WaitPrintf("Adding the Kubernetes apt repository")
-		_, err = ExecShellCmd("sudo mkdir -p /etc/apt/keyrings && sudo curl -fsSLo /etc/apt/keyrings/kubernetes-archive-keyring.gpg https://dl.k8s.io/apt/doc/apt-key.gpg && echo 'deb [signed-by=/etc/apt/keyrings/kubernetes-archive-keyring.gpg] https://apt.kubernetes.io/ kubernetes-xenial main' | sudo tee /etc/apt/sources.list.d/kubernetes.list")
-		logs.CheckErrorWithTagAndMsg(err, "Failed to add the Kubernetes apt repository!\n")
-		// Install kubeadm, kubelet, kubectl via apt
+	RunStep("system/install-kubernetes", []any{
+		configs.System.KubeInstallMethod,
+		configs.Kube.K8sVersion,
+		configs.System.KubeadmVersion,
+		configs.System.KubeletVersion,
+		configs.System.KubectlVersion,
+		configs.System.CrictlVersion,
+	}, func() {
+		if configs.System.KubeInstallMethod == KubeInstallBinary {
+			err := RecordComponentChange("kubernetes-binaries")
+			logs.CheckErrorWithMsg(err, "Failed to install kubeadm, kubelet, kubectl!\n")
+			installKubeBinaries()
+			return
+		}
+		// Add the Kubernetes package repository
+		logs.WaitPrintf("Adding the Kubernetes %s repository", packageManager.Name())
+		err := packageManager.AddRepo(KubeRepo())
+		logs.CheckErrorWithTagAndMsg(err, "Failed to add the Kubernetes %s repository!\n", packageManager.Name())
+		// Install kubeadm, kubelet, kubectl
 		logs.WaitPrintf("Installing kubeadm, kubelet, kubectl")
-		err = InstallPackages("kubeadm=%s kubelet=%s kubectl=%s", configs.System.KubeadmVersion, configs.System.KubeletVersion, configs.System.KubectlVersion)
+		err = RecordComponentChange("kubernetes-packages")
+		logs.CheckErrorWithMsg(err, "Failed to install kubeadm, kubelet, kubectl!\n")
+		err = packageManager.Install(
+			packageManager.VersionedPackage("kubeadm", KubePackageVersion(configs.System.KubeadmVersion)),
+			packageManager.VersionedPackage("kubelet", KubePackageVersion(configs.System.KubeletVersion)),
+			packageManager.VersionedPackage("kubectl", KubePackageVersion(configs.System.KubectlVersion)))
 		logs.CheckErrorWithTagAndMsg(err, "Failed to install kubeadm, kubelet, kubectl!\n")
 		// Lock kubeadm, kubelet, kubectl version
 		logs.WaitPrintf("Locking kubeadm, kubelet, kubectl version")
-		_, err = ExecShellCmd("sudo apt-mark hold kubelet kubeadm kubectl")
+		err = packageManager.Hold("kubelet", "kubeadm", "kubectl")
 		logs.CheckErrorWithTagAndMsg(err, "Failed to lock kubeadm, kubelet, kubectl version!\n")
-	default:
-		logs.FatalPrintf("Unsupported Linux distribution: %s\n", configs.System.CurrentOS)
-	}
+	})
+	// Configure kubelet (started by kubeadm later)
+	RunStep("system/configure-kubelet", []any{configs.System.CgroupDriver, ProxyEnvironment()}, func() {
+		// Record the cgroup driver of kubelet
+		logs.WaitPrintf("Recording the %s cgroup driver for kubelet", configs.System.CgroupDriver)
+		err := WriteKubeletCgroupPatch()
+		logs.CheckErrorWithTagAndMsg(err, "Failed to record the cgroup driver for kubelet!\n")
+		// Configure proxy for kubelet
+		logs.WaitPrintf("Configuring proxy for kubelet")
+		err = ConfigureServiceProxy("kubelet")
+		logs.CheckErrorWithTagAndMsg(err, "Failed to configure proxy for kubelet!\n")
+	})
 }
@@ -0,0 +1,146 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
+)
+
+// Policies on components installed before `SystemInit()`
+const (
+	UpgradeKeep    = "keep"    // Keep any installed version
+	UpgradeUpgrade = "upgrade" // Replace versions older than the requested one
+	UpgradeExact   = "exact"   // Replace versions other than the requested one
+)
+
+var componentVersionRegexp = regexp.MustCompile(`[0-9]+\.[0-9]+\.[0-9]+`)
+
+// Get the version of an installed component
+func componentVersion(component string) (string, error) {
+	var output string
+	var err error
+	switch component {
+	case "go":
+		output, err = ExecCmd("go", "version")
+	case "cni-plugins":
+		output, err = ExecCmd(cniPluginsDir+"/bridge", "--version")
+	default:
+		output, err = ExecCmd(component, "--version")
+	}
+	if err != nil {
+		return "", err
+	}
+	version := componentVersionRegexp.FindString(output)
+	if len(version) == 0 {
+		return "", fmt.Errorf("no version in %q", output)
+	}
+	return version, nil
+}
+
+// Compare versions numerically (1.6.18 > 1.6.9), ignoring "v" prefixes & pre-release suffixes
+func compareVersions(a string, b string) int {
+	fieldsA := strings.Split(strings.SplitN(strings.TrimPrefix(a, "v"), "-", 2)[0], ".")
+	fieldsB := strings.Split(strings.SplitN(strings.TrimPrefix(b, "v"), "-", 2)[0], ".")
+	for i := 0; i < len(fieldsA) || i < len(fieldsB); i++ {
+		var numberA, numberB int
+		if i < len(fieldsA) {
+			numberA, _ = strconv.Atoi(fieldsA[i])
+		}
+		if i < len(fieldsB) {
+			numberB, _ = strconv.Atoi(fieldsB[i])
+		}
+		if numberA != numberB {
+			if numberA < numberB {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// Whether an installed component is kept by `SystemInit()` (rather than (re)installed) under the upgrade policy
+func keepInstalledComponent(component string, title string, requestedVersion string) bool {
+	if !componentInstalled(component) {
+		logs.WarnPrintf("%s not found! %s(version %s) will be automatically installed!\n", title, title, requestedVersion)
+		return false
+	}
+	installedVersion, err := componentVersion(component)
+	switch {
+	case configs.System.UpgradePolicy == UpgradeKeep && (err != nil || installedVersion == requestedVersion):
+		logs.SuccessPrintf("%s found!\n", title)
+		return true
+	case configs.System.UpgradePolicy == UpgradeKeep:
+		logs.WarnPrintf("%s(version %s) found! It is kept instead of version %s (-upgrade-policy=%s)!\n", title, installedVersion, requestedVersion, UpgradeKeep)
+		return true
+	case err != nil:
+		logs.WarnPrintf("%s found, but its version is unknown (%v)! %s(version %s) will be reinstalled!\n", title, err, title, requestedVersion)
+		return false
+	case installedVersion == requestedVersion:
+		logs.SuccessPrintf("%s(version %s) found!\n", title, installedVersion)
+		return true
+	case configs.System.UpgradePolicy == UpgradeUpgrade && compareVersions(installedVersion, requestedVersion) > 0:
+		logs.WarnPrintf("%s(version %s) found! It is newer than version %s and kept (-upgrade-policy=%s)!\n", title, installedVersion, requestedVersion, UpgradeUpgrade)
+		return true
+	default:
+		logs.WarnPrintf("%s(version %s) found! It will be replaced by version %s!\n", title, installedVersion, requestedVersion)
+		return false
+	}
+}
+
+// Paths components are installed to by `SystemInit()`
+const (
+	goRootDir            = "/usr/local/go"
+	goBinaryPath         = goRootDir + "/bin/go"
+	containerdBinaryPath = "/usr/local/bin/containerd"
+)
+
+var execStartPathRegexp = regexp.MustCompile(`path=(\S+)`)
+
+// Get another executable that name resolves to on PATH before installedPath (whose directory is appended to PATH if missing, as by `AppendDirToPath()`)
+// e.g. an older copy from a distribution package in /usr/bin, "" if installedPath comes first
+func shadowingExecutable(name string, installedPath string) string {
+	installedInfo, installedErr := os.Stat(checkRootDir + installedPath)
+	for _, dir := range append(filepath.SplitList(os.Getenv("PATH")), filepath.Dir(checkRootDir+installedPath)) {
+		filePath := filepath.Join(dir, name)
+		info, err := os.Stat(filePath)
+		if err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+			continue
+		}
+		if filePath == checkRootDir+installedPath || (installedErr == nil && os.SameFile(info, installedInfo)) {
+			return ""
+		}
+		return filePath
+	}
+	return ""
+}
+
+// Warn if an installed component is shadowed on PATH, so that users would still run another version
+func warnShadowedExecutable(name string, installedPath string) {
+	if shadowingPath := shadowingExecutable(name, installedPath); len(shadowingPath) > 0 {
+		logs.WarnPrintf("%s on PATH is %s, which comes before the installed %s! Remove it or put %s first on PATH!\n", name, shadowingPath, installedPath, filepath.Dir(installedPath))
+	}
+}
+
+// Check that the containerd service starts the installed binary, rather than one configured by a unit or drop-in of another package
+func VerifyContainerdUnit() error {
+	output, err := ExecCmd("systemctl", "show", "--property", "ExecStart", "--value", "containerd")
+	if err != nil {
+		return err
+	}
+	match := execStartPathRegexp.FindStringSubmatch(output)
+	if match == nil {
+		// Nothing to compare with, e.g. in dry-run mode
+		return nil
+	}
+	if match[1] != containerdBinaryPath {
+		return fmt.Errorf("containerd.service starts %s instead of the installed %s, please remove the unit or drop-in overriding ExecStart (see `systemctl cat containerd`)", match[1], containerdBinaryPath)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package system
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+)
+
+func TestCompareVersions(t *testing.T) {
+	for _, test := range []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{"1.6.18", "1.6.9", 1},
+		{"1.4.3", "1.6.18", -1},
+		{"v1.2.0", "1.2.0", 0},
+		{"1.20", "1.20.0", 0},
+		{"1.1.4-rc.1", "1.1.4", 0},
+	} {
+		if got := compareVersions(test.a, test.b); got != test.want {
+			t.Errorf("compareVersions(%s, %s) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestKeepInstalledComponent(t *testing.T) {
+	fakeRunner := useFakeRunner(t)
+	fakeRunner.On("containerd --version", FakeResponse{Stdout: "containerd github.com/containerd/containerd v1.4.3 269548fa27e0089a8b8278fc4fc781d7f65a939b"})
+	fakeRunner.On("runc --version", FakeResponse{Stdout: "runc version 1.1.12\ncommit: v1.1.12-0-g51d5e946\nspec: 1.0.2-dev"})
+	binDir := t.TempDir()
+	for _, binary := range []string{"containerd", "runc"} {
+		os.WriteFile(binDir+"/"+binary, []byte("#!/bin/sh\n"), 0755)
+	}
+	t.Setenv("PATH", binDir)
+	defer func() { configs.System.UpgradePolicy = UpgradeKeep }()
+
+	for _, test := range []struct {
+		policy     string
+		containerd bool
+		runc       bool
+	}{
+		{UpgradeKeep, true, true},
+		{UpgradeUpgrade, false, true}, // runc 1.1.12 is newer than 1.1.4
+		{UpgradeExact, false, false},
+	} {
+		configs.System.UpgradePolicy = test.policy
+		if kept := keepInstalledComponent("containerd", "Containerd", "1.6.18"); kept != test.containerd {
+			t.Errorf("keepInstalledComponent(containerd 1.4.3, -upgrade-policy=%s) = %v", test.policy, kept)
+		}
+		if kept := keepInstalledComponent("runc", "runc", "1.1.4"); kept != test.runc {
+			t.Errorf("keepInstalledComponent(runc 1.1.12, -upgrade-policy=%s) = %v", test.policy, kept)
+		}
+		if kept := keepInstalledComponent("go", "Golang", "1.18.10"); kept {
+			t.Errorf("keepInstalledComponent(go missing, -upgrade-policy=%s) = %v", test.policy, kept)
+		}
+	}
+}
+
+func TestSystemInitUpgradesContainerd(t *testing.T) {
+	fakeRunner := useFakeSystemInit(t)
+	useStateJournal(t, "system master init")
+	fakeRunner.On("containerd --version", FakeResponse{Stdout: "containerd github.com/containerd/containerd v1.4.3 269548fa27e0089a8b8278fc4fc781d7f65a939b"})
+	binDir := checkRootDir + "/usr/local/bin"
+	os.MkdirAll(binDir, 0755)
+	os.WriteFile(binDir+"/containerd", []byte("#!/bin/sh\n"), 0755)
+	t.Setenv("PATH", binDir)
+	configs.System.UpgradePolicy = UpgradeUpgrade
+
+	SystemInit()
+
+	stop := fakeRunner.Index("sudo systemctl stop containerd")
+	download := fakeRunner.Index("containerd-1.6.18-linux-")
+	start := fakeRunner.Index("sudo systemctl enable --now containerd")
+	if stop < 0 || download < 0 || start < 0 || !(download < stop && stop < start) {
+		t.Errorf("SystemInit(-upgrade-policy=upgrade) should download containerd 1.6.18, then stop & start containerd: %d, %d, %d\n%v", download, stop, start, fakeRunner)
+	}
+	// The node had containerd before, so `system reset -remove-components` keeps it
+	journal, _ := LoadStateJournal()
+	for _, change := range journal.Changes {
+		if change.String() == "component containerd" {
+			t.Errorf("SystemInit(-upgrade-policy=upgrade) recorded the upgrade of containerd as an install")
+		}
+	}
+}
+
+func TestShadowedComponents(t *testing.T) {
+	fakeRunner := useFakeRunner(t)
+	useFakeSystemRoot(t, "systemd")
+	distroBinDir := checkRootDir + "/usr/bin"
+	os.MkdirAll(distroBinDir, 0755)
+	os.MkdirAll(checkRootDir+"/usr/local/go/bin", 0755)
+	os.WriteFile(checkRootDir+goBinaryPath, []byte("#!/bin/sh\n"), 0755)
+
+	// /usr/local/go/bin is appended to PATH, so the Golang of the distribution comes first
+	t.Setenv("PATH", distroBinDir)
+	if shadowingPath := shadowingExecutable("go", goBinaryPath); shadowingPath != "" {
+		t.Errorf("shadowingExecutable(go) = %q without another go on PATH", shadowingPath)
+	}
+	os.WriteFile(distroBinDir+"/go", []byte("#!/bin/sh\n"), 0755)
+	if shadowingPath := shadowingExecutable("go", goBinaryPath); shadowingPath != distroBinDir+"/go" {
+		t.Errorf("shadowingExecutable(go) = %q, want %s", shadowingPath, distroBinDir+"/go")
+	}
+	t.Setenv("PATH", checkRootDir+"/usr/local/go/bin:"+distroBinDir)
+	if shadowingPath := shadowingExecutable("go", goBinaryPath); shadowingPath != "" {
+		t.Errorf("shadowingExecutable(go) = %q with %s first on PATH", shadowingPath, goBinaryPath)
+	}
+
+	// The containerd service must start the installed binary
+	fakeRunner.On("systemctl show --property ExecStart --value containerd",
+		FakeResponse{Stdout: "{ path=/usr/local/bin/containerd ; argv[]=/usr/local/bin/containerd ; ignore_errors=no }"},
+		FakeResponse{Stdout: "{ path=/usr/bin/containerd ; argv[]=/usr/bin/containerd ; ignore_errors=no }"})
+	if err := VerifyContainerdUnit(); err != nil {
+		t.Errorf("VerifyContainerdUnit(/usr/local/bin/containerd) error = %v", err)
+	}
+	if err := VerifyContainerdUnit(); err == nil || !strings.Contains(err.Error(), "/usr/bin/containerd") {
+		t.Errorf("VerifyContainerdUnit(/usr/bin/containerd) = %v, should fail", err)
+	}
+}
@@ -0,0 +1,93 @@
+package system
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	versionRegexp   = regexp.MustCompile(`^v?[0-9]+(\.[0-9]+){1,3}(-[0-9A-Za-z.]+)?(\+[0-9A-Za-z.]+)?$`)
+	nodeNameRegexp  = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+	hostNameRegexp  = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9]*[A-Za-z0-9])?(\.[A-Za-z0-9]([-A-Za-z0-9]*[A-Za-z0-9])?)*$`)
+	tokenRegexp     = regexp.MustCompile(`^[a-z0-9]{6}\.[a-z0-9]{16}$`)
+	tokenHashRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+	imageRepoRegexp = regexp.MustCompile(`^[a-z0-9]+([._-][a-z0-9]+)*(:[0-9]+)?(/[a-z0-9]+([._-]+[a-z0-9]+)*)*$`)
+)
+
+// Validate version (e.g. 1.25.9, v1.2.0, 1.25.9-00)
+func ValidateVersion(flagName string, version string) error {
+	if !versionRegexp.MatchString(version) {
+		return fmt.Errorf("-%s: invalid version %q", flagName, version)
+	}
+	return nil
+}
+
+// Validate Kubernetes node name (RFC 1123 subdomain)
+func ValidateNodeName(flagName string, nodeName string) error {
+	if len(nodeName) > 253 || !nodeNameRegexp.MatchString(nodeName) {
+		return fmt.Errorf("-%s: invalid node name %q", flagName, nodeName)
+	}
+	return nil
+}
+
+// Validate IP address or host name
+func ValidateAddress(flagName string, address string) error {
+	if net.ParseIP(address) == nil && (len(address) > 253 || !hostNameRegexp.MatchString(address)) {
+		return fmt.Errorf("-%s: invalid address %q", flagName, address)
+	}
+	return nil
+}
+
+// Validate TCP port
+func ValidatePort(flagName string, port string) error {
+	portNumber, err := strconv.Atoi(port)
+	if err != nil || portNumber < 1 || portNumber > 65535 {
+		return fmt.Errorf("-%s: invalid port %q", flagName, port)
+	}
+	return nil
+}
+
+// Validate kubeadm bootstrap token ([a-z0-9]{6}.[a-z0-9]{16})
+func ValidateToken(flagName string, token string) error {
+	if !tokenRegexp.MatchString(token) {
+		return fmt.Errorf("-%s: invalid bootstrap token (format: [a-z0-9]{6}.[a-z0-9]{16})", flagName)
+	}
+	return nil
+}
+
+// Validate discovery token CA cert hash (sha256:<hex>)
+func ValidateTokenHash(flagName string, tokenHash string) error {
+	if !tokenHashRegexp.MatchString(tokenHash) {
+		return fmt.Errorf("-%s: invalid token hash %q (format: sha256:<64 hex digits>)", flagName, tokenHash)
+	}
+	return nil
+}
+
+// Validate container image repository (e.g. registry.example.com:5000/google_containers)
+func ValidateImageRepo(flagName string, imageRepo string) error {
+	if len(imageRepo) > 255 || !imageRepoRegexp.MatchString(imageRepo) {
+		return fmt.Errorf("-%s: invalid image repository %q", flagName, imageRepo)
+	}
+	return nil
+}
+
+// Validate CIDR (e.g. 192.168.0.0/16)
+func ValidateCidr(flagName string, cidr string) error {
+	if _, _, err := net.ParseCIDR(cidr); err != nil {
+		return fmt.Errorf("-%s: invalid CIDR %q", flagName, cidr)
+	}
+	return nil
+}
+
+// Validate value of a flag with a fixed set of choices
+func ValidateChoice(flagName string, value string, choices ...string) error {
+	for _, choice := range choices {
+		if value == choice {
+			return nil
+		}
+	}
+	return fmt.Errorf("-%s: invalid value %q (choices: %s)", flagName, value, strings.Join(choices, ", "))
+}
@@ -15,12 +15,20 @@ contexts:
 current-context: default-context
 kind: Config
 preferences: {}`
+	// Overrides the kubeconfig of the kubeadm drop-in (10-kubeadm.conf), so that kubelet talks to Yurthub
+	kubeletDropInTemplate = `[Service]
+Environment="KUBELET_KUBECONFIG_ARGS=--kubeconfig=/var/lib/openyurt/kubelet.conf"
+`
 )
 
 func GetKubeletConfig() string {
 	return kubeletTemplate
 }
 
+func GetKubeletDropIn() string {
+	return kubeletDropInTemplate
+}
+
 func GetNetworkAddonConfigURL() string {
 	return vHiveConfigsURL + "/calico/canal.yaml"
 }
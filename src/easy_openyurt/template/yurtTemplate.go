@@ -24,7 +24,7 @@ spec:
       type: Directory
   containers:
   - name: yurt-hub
-    image: openyurt/yurthub:latest
+    image: __yurthub_image__
     imagePullPolicy: IfNotPresent
     volumeMounts:
     - name: hub-dir
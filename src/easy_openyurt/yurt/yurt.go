@@ -2,12 +2,13 @@
 package yurt
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
 	"strings"
-	"time"
 
 	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
 	logs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/logs"
@@ -15,6 +16,9 @@ import (
 	template "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/template"
 )
 
+// Drop-in of kubelet pointing it to Yurthub, ordered after 10-kubeadm.conf
+const kubeletDropInPath = "/etc/systemd/system/kubelet.service.d/20-openyurt.conf"
+
 // Parse parameters for subcommand `yurt`
 func ParseSubcommandYurt(args []string) {
 	nodeRole := args[0]
@@ -25,6 +29,7 @@ func ParseSubcommandYurt(args []string) {
 	yurtFlags := flag.NewFlagSet(yurtFlagsName, flag.ExitOnError)
 	yurtFlags.BoolVar(&help, "help", false, "Show help")
 	yurtFlags.BoolVar(&help, "h", false, "Show help")
+	system.AddGlobalFlags(yurtFlags)
 	switch nodeRole {
 	case "master":
 		// Parse parameters for `yurt master init`
@@ -36,6 +41,7 @@ func ParseSubcommandYurt(args []string) {
 				yurtFlags.Usage()
 				os.Exit(0)
 			}
+			system.ApplyGlobalFlags()
 			YurtMasterInit()
 			logs.SuccessPrintf("Successfully init OpenYurt cluster master node!\n")
 		} else if operation == "expand" {
@@ -48,11 +54,14 @@ func ParseSubcommandYurt(args []string) {
 				yurtFlags.Usage()
 				os.Exit(0)
 			}
+			system.ApplyGlobalFlags()
 			// Check required parameters
 			if len(configs.Yurt.WorkerNodeName) == 0 {
 				yurtFlags.Usage()
 				logs.FatalPrintf("Parameter --worker-node-name needed!\n")
 			}
+			err := system.ValidateNodeName("worker-node-name", configs.Yurt.WorkerNodeName)
+			logs.CheckErrorWithMsg(err, "Invalid parameters!\n")
 			YurtMasterExpand()
 			logs.SuccessPrintf("Successfully expand OpenYurt to node [%s]!\n", configs.Yurt.WorkerNodeName)
 		} else {
@@ -68,12 +77,14 @@ func ParseSubcommandYurt(args []string) {
 		yurtFlags.StringVar(&configs.Kube.ApiserverAdvertiseAddress, "apiserver-advertise-address", configs.Kube.ApiserverAdvertiseAddress, "Kubernetes API server advertise address (**REQUIRED**)")
 		yurtFlags.StringVar(&configs.Kube.ApiserverPort, "apiserver-port", configs.Kube.ApiserverPort, "Kubernetes API server port")
 		yurtFlags.StringVar(&configs.Kube.ApiserverToken, "apiserver-token", configs.Kube.ApiserverToken, "Kubernetes API server token (**REQUIRED**)")
+		yurtFlags.StringVar(&configs.System.StatePath, "state-file", configs.System.StatePath, "State journal of the node, recording the changes undone by system worker reset")
 		yurtFlags.Parse(args[2:])
 		// Show help
 		if help {
 			yurtFlags.Usage()
 			os.Exit(0)
 		}
+		system.ApplyGlobalFlags()
 		// Check required parameters
 		if len(configs.Kube.ApiserverAdvertiseAddress) == 0 {
 			yurtFlags.Usage()
@@ -83,7 +94,17 @@ func ParseSubcommandYurt(args []string) {
 			yurtFlags.Usage()
 			logs.FatalPrintf("Parameter --apiserver-token needed!\n")
 		}
+		err := errors.Join(
+			system.ValidateAddress("apiserver-advertise-address", configs.Kube.ApiserverAdvertiseAddress),
+			system.ValidatePort("apiserver-port", configs.Kube.ApiserverPort),
+			system.ValidateToken("apiserver-token", configs.Kube.ApiserverToken))
+		logs.CheckErrorWithMsg(err, "Invalid parameters!\n")
+		// Record the kubelet drop-in, so that `system worker reset` removes it
+		err = system.StartStateJournal("yurt worker join")
+		logs.CheckErrorWithMsg(err, "Failed to open the state journal %s!\n", configs.System.StatePath)
 		YurtWorkerJoin()
+		err = system.FinishStateJournal()
+		logs.CheckErrorWithMsg(err, "Failed to update the state journal %s!\n", configs.System.StatePath)
 		logs.SuccessPrintf("Successfully joined OpenYurt cluster!\n")
 	default:
 		logs.InfoPrintf("Usage: %s %s <master | worker> <init | join | expand> [parameters...]\n", os.Args[0], os.Args[1])
@@ -116,25 +137,115 @@ func CheckYurtMasterEnvironment() {
 	}
 
 	// Add OS-specific dependencies to installation lists
-	switch configs.System.CurrentOS {
-	case "ubuntu":
-		configs.Yurt.Dependencies = "curl apt-transport-https ca-certificates build-essential git"
-	case "rocky linux":
-		configs.Yurt.Dependencies = ""
-	case "centos":
-		configs.Yurt.Dependencies = ""
-	default:
-		logs.FatalPrintf("Unsupported OS: %s\n", configs.System.CurrentOS)
-	}
+	configs.Yurt.Dependencies = yurtDependencies()
 
 	logs.SuccessPrintf("Finished checking system environment!\n")
 }
 
+// Get dependencies of `YurtMasterInit()`, named as on Ubuntu
+func yurtDependencies() string {
+	return "curl apt-transport-https ca-certificates build-essential git"
+}
+
+// Get the Helm apt repository
+func helmRepo() *system.PackageRepo {
+	return &system.PackageRepo{
+		Name:          "helm",
+		AptUrl:        configs.Yurt.HelmAptRepoUrl,
+		AptSuite:      "all",
+		AptComponents: "main",
+		KeyUrl:        configs.Yurt.HelmPublicSigningKeyDownloadUrl,
+		KeySignature:  &system.Signature{Kind: system.SignatureGpgKey, Fingerprints: configs.Yurt.HelmSigningKeyFingerprints},
+	}
+}
+
+// Get the detached signature of the Helm release tarball
+func helmSignature() *system.Signature {
+	return &system.Signature{
+		Kind:         system.SignatureGpg,
+		SignatureUrl: fmt.Sprintf(configs.Yurt.HelmSignatureUrlTemplate, configs.Yurt.HelmVersion, configs.Yurt.HelmVersion, configs.ArchName("helm")),
+		KeysUrl:      fmt.Sprintf(configs.Yurt.HelmKeysUrlTemplate, configs.Yurt.HelmVersion),
+	}
+}
+
+// Get the components downloaded by `YurtMasterInit()` from release servers
+func yurtComponents() []string {
+	var components []string
+	if packageManager, err := system.GetPackageManager(); !configs.Yurt.HelmInstalled && (err != nil || packageManager.Name() != "apt") {
+		components = append(components, "helm")
+	}
+	if !configs.Yurt.KustomizeInstalled {
+		components = append(components, "kustomize")
+	}
+	return components
+}
+
+// Get the images deployed outside of the Helm charts, pinned to the configured versions
+func yurtImages() []string {
+	return []string{
+		fmt.Sprintf(configs.Yurt.YurthubImageTemplate, configs.Yurt.YurtVersion),
+		fmt.Sprintf(configs.Yurt.RavenControllerManagerImageTemplate, configs.Yurt.RavenVersion),
+		fmt.Sprintf(configs.Yurt.RavenAgentImageTemplate, configs.Yurt.RavenVersion),
+	}
+}
+
+// Get the manifest of raven-controller-manager, generated by make with its image pinned
+func ravenControllerManagerManifest() *system.GeneratedManifest {
+	return &system.GeneratedManifest{
+		MakeArgs: []string{"generate-deploy-yaml", "IMG=" + fmt.Sprintf(configs.Yurt.RavenControllerManagerImageTemplate, configs.Yurt.RavenVersion)},
+		Output:   "_output/yamls/raven-controller-manager.yaml",
+	}
+}
+
+// Get the manifest of raven-agent, generated by make with its image pinned
+func ravenAgentManifest() *system.GeneratedManifest {
+	return &system.GeneratedManifest{
+		MakeArgs: []string{"gen-deploy-yaml", "FORWARD_NODE_IP=true", "IMG=" + fmt.Sprintf(configs.Yurt.RavenAgentImageTemplate, configs.Yurt.RavenVersion)},
+		Output:   "_output/yamls/raven-agent.yaml",
+	}
+}
+
+// Get artifacts needed by `yurt` for the configured versions
+func BundleArtifacts() ([]*system.Artifact, error) {
+	if err := system.CheckArchSupport("kustomize"); err != nil {
+		return nil, err
+	}
+	artifacts := []*system.Artifact{
+		{Kind: system.ArtifactFile, Source: configs.Yurt.HelmPublicSigningKeyDownloadUrl},
+		{Kind: system.ArtifactPackage, Source: "helm"},
+		{Kind: system.ArtifactFile,
+			Source:    fmt.Sprintf(configs.Yurt.KustomizeDownloadUrlTemplate, configs.Yurt.KustomizeVersion, configs.Yurt.KustomizeVersion, configs.ArchName("kustomize")),
+			Sha256Url: fmt.Sprintf(configs.Yurt.KustomizeChecksumUrlTemplate, configs.Yurt.KustomizeVersion)},
+		{Kind: system.ArtifactGitRepo,
+			Source: configs.Yurt.HelmChartsRepoUrl,
+			GitRef: "openyurt-" + configs.Yurt.YurtVersion,
+			Charts: []string{"charts/yurt-app-manager", "charts/openyurt"}},
+		{Kind: system.ArtifactGitRepo,
+			Source:    configs.Yurt.RavenControllerManagerRepoUrl,
+			GitRef:    "v" + configs.Yurt.RavenVersion,
+			Manifests: []*system.GeneratedManifest{ravenControllerManagerManifest()}},
+		{Kind: system.ArtifactGitRepo,
+			Source:    configs.Yurt.RavenAgentRepoUrl,
+			GitRef:    "v" + configs.Yurt.RavenVersion,
+			Manifests: []*system.GeneratedManifest{ravenAgentManifest()}},
+	}
+	for _, image := range yurtImages() {
+		artifacts = append(artifacts, &system.Artifact{Kind: system.ArtifactImage, Source: image})
+	}
+	for _, dependency := range strings.Fields(yurtDependencies()) {
+		artifacts = append(artifacts, &system.Artifact{Kind: system.ArtifactPackage, Source: dependency})
+	}
+	return artifacts, nil
+}
+
 // Initialize Openyurt on master node
 func YurtMasterInit() {
 	// Initialize
 	var err error
 	CheckYurtMasterEnvironment()
+	// Check releases for the current architecture, before anything is modified
+	err = system.CheckArchSupport(yurtComponents()...)
+	logs.CheckErrorWithMsg(err, "Unsupported architecture %s!\n", configs.System.CurrentArch)
 	system.CreateTmpDir()
 	defer system.CleanUpTmpDir()
 
@@ -143,100 +254,130 @@ func YurtMasterInit() {
 	err = system.InstallPackages(configs.Yurt.Dependencies)
 	logs.CheckErrorWithTagAndMsg(err, "Failed to install dependencies!\n")
 
+	// Import images, so that none of them is pulled
+	if system.IsBundleMode() {
+		logs.WaitPrintf("Importing images from bundle")
+		err = system.ImportBundleImages()
+		logs.CheckErrorWithTagAndMsg(err, "Failed to import images from bundle!\n")
+	}
+
 	// Treat master as cloud node
 	if configs.Yurt.MasterAsCloud {
 		logs.WarnPrintf("Master node WILL also be treated as a cloud node!\n")
-		system.ExecShellCmd("kubectl taint nodes --all node-role.kubernetes.io/master:NoSchedule-")
-		system.ExecShellCmd("kubectl taint nodes --all node-role.kubernetes.io/control-plane-")
+		system.ExecCmd("kubectl", "taint", "nodes", "--all", "node-role.kubernetes.io/master:NoSchedule-")
+		system.ExecCmd("kubectl", "taint", "nodes", "--all", "node-role.kubernetes.io/control-plane-")
 	}
 
 	// Install helm
 	if !configs.Yurt.HelmInstalled {
-		switch configs.System.CurrentOS {
-		case "ubuntu":
-			// Download public signing key && Add the Helm apt repository
-			logs.WaitPrintf("Downloading public signing key && Add the Helm apt repository")
-			// Download public signing key
-			filePathName, err := system.DownloadToTmpDir(configs.Yurt.HelmPublicSigningKeyDownloadUrl)
-			logs.CheckErrorWithMsg(err, "Failed to download public signing key && add the Helm apt repository!\n")
-			_, err = system.ExecShellCmd("sudo mkdir -p /usr/share/keyrings && cat %s | gpg --dearmor | sudo tee /usr/share/keyrings/helm.gpg > /dev/null", filePathName)
-			logs.CheckErrorWithMsg(err, "Failed to download public signing key && add the Helm apt repository!\n")
+		// From the Helm apt repository on apt, from the release tarball otherwise
+		if packageManager, err := system.GetPackageManager(); err == nil && packageManager.Name() == "apt" {
 			// Add the Helm apt repository
-			_, err = system.ExecShellCmd(`echo "deb [arch=$(dpkg --print-architecture) signed-by=/usr/share/keyrings/helm.gpg] https://baltocdn.com/helm/stable/debian/ all main" | sudo tee /etc/apt/sources.list.d/helm-stable-debian.list`)
+			logs.WaitPrintf("Downloading public signing key && Add the Helm apt repository")
+			err = packageManager.AddRepo(helmRepo())
 			logs.CheckErrorWithTagAndMsg(err, "Failed to download public signing key && add the Helm apt repository!\n")
 			// Install helm
 			logs.WaitPrintf("Installing Helm")
-			err = system.InstallPackages("helm")
+			err = packageManager.Install("helm")
+			logs.CheckErrorWithTagAndMsg(err, "Failed to install helm!\n")
+		} else {
+			// Download helm
+			logs.WaitPrintf("Downloading Helm(ver %s)", configs.Yurt.HelmVersion)
+			filePathName, err := system.DownloadToTmpDirWithSignature(
+				helmSignature(),
+				fmt.Sprintf(configs.Yurt.HelmChecksumUrlTemplate, configs.Yurt.HelmVersion, configs.ArchName("helm")),
+				configs.Yurt.HelmDownloadUrlTemplate,
+				configs.Yurt.HelmVersion,
+				configs.ArchName("helm"))
+			logs.CheckErrorWithTagAndMsg(err, "Failed to download Helm(ver %s)!\n", configs.Yurt.HelmVersion)
+			// Install helm
+			logs.WaitPrintf("Installing Helm")
+			err = system.ExtractArchive(&system.Extraction{FilePath: filePathName, DirPath: configs.System.TmpDir + "/helm", StripComponents: 1})
+			logs.CheckErrorWithMsg(err, "Failed to install helm!\n")
+			_, err = system.ExecCmd("sudo", "install", "-m", "755", configs.System.TmpDir+"/helm/helm", "/usr/local/bin/helm")
 			logs.CheckErrorWithTagAndMsg(err, "Failed to install helm!\n")
-		default:
-			logs.FatalPrintf("Unsupported Linux distribution: %s\n", configs.System.CurrentOS)
 		}
 	}
 
 	// Install kustomize
 	if !configs.Yurt.KustomizeInstalled {
-		// Download kustomize helper script
-		logs.WaitPrintf("Downloading kustomize")
-		filePathName, err := system.DownloadToTmpDir(configs.Yurt.KustomizeScriptDownloadUrl)
-		logs.CheckErrorWithMsg(err, "Failed to download kustomize!\n")
 		// Download kustomize
-		_, err = system.ExecShellCmd("chmod u+x %s && %s %s", filePathName, filePathName, configs.System.TmpDir)
+		logs.WaitPrintf("Downloading kustomize(ver %s)", configs.Yurt.KustomizeVersion)
+		filePathName, err := system.DownloadToTmpDirWithChecksum(
+			fmt.Sprintf(configs.Yurt.KustomizeChecksumUrlTemplate, configs.Yurt.KustomizeVersion),
+			configs.Yurt.KustomizeDownloadUrlTemplate,
+			configs.Yurt.KustomizeVersion,
+			configs.Yurt.KustomizeVersion,
+			configs.ArchName("kustomize"))
 		logs.CheckErrorWithTagAndMsg(err, "Failed to download kustomize!\n")
 		// Install kustomize
 		logs.WaitPrintf("Installing kustomize")
-		_, err = system.ExecShellCmd("sudo cp %s /usr/local/bin", configs.System.TmpDir+"/kustomize")
+		err = system.ExtractToDir(filePathName, configs.System.TmpDir, false)
+		logs.CheckErrorWithMsg(err, "Failed to Install kustomize!\n")
+		_, err = system.ExecCmd("sudo", "install", "-m", "755", configs.System.TmpDir+"/kustomize", "/usr/local/bin/kustomize")
 		logs.CheckErrorWithTagAndMsg(err, "Failed to Install kustomize!\n")
 	}
 
 	// Add OpenYurt repo with helm
 	logs.WaitPrintf("Adding OpenYurt repo(version %s) with helm", configs.Yurt.YurtVersion)
-	_, err = system.ExecShellCmd("git clone --quiet https://github.com/openyurtio/openyurt-helm.git %s/openyurt-helm && pushd %s/openyurt-helm && git checkout openyurt-%s && popd", configs.System.TmpDir, configs.System.TmpDir, configs.Yurt.YurtVersion)
+	err = system.GitClone(configs.Yurt.HelmChartsRepoUrl, configs.System.TmpDir+"/openyurt-helm")
+	logs.CheckErrorWithMsg(err, "Failed to add OpenYurt repo with helm!\n")
+	_, err = system.ExecCmd("git", "-C", configs.System.TmpDir+"/openyurt-helm", "checkout", "openyurt-"+configs.Yurt.YurtVersion)
 	logs.CheckErrorWithTagAndMsg(err, "Failed to add OpenYurt repo with helm!\n")
 
 	// Deploy yurt-app-manager
 	logs.WaitPrintf("Deploying yurt-app-manager")
-	_, err = system.ExecShellCmd("helm install yurt-app-manager -n kube-system %s/openyurt-helm/charts/yurt-app-manager", configs.System.TmpDir)
+	_, err = system.ExecCmd("helm", "install", "yurt-app-manager", "-n", "kube-system", configs.System.TmpDir+"/openyurt-helm/charts/yurt-app-manager")
 	logs.CheckErrorWithTagAndMsg(err, "Failed to deploy yurt-app-manager!\n")
 
 	// Wait for yurt-app-manager to be ready
 	logs.WaitPrintf("Waiting for yurt-app-manager to be ready")
-	waitCount := 1
-	for {
-		yurtAppManagerStatus, err := system.ExecShellCmd(`kubectl get pod -n kube-system | grep yurt-app-manager | sed -n "s/\s*\(\S*\)\s*\(\S*\)\s*\(\S*\).*/\2 \3/p"`)
-		logs.CheckErrorWithMsg(err, "Failed to wait for yurt-app-manager to be ready!\n")
-		if yurtAppManagerStatus == "1/1 Running" {
-			logs.SuccessPrintf("\n")
-			break
-		} else {
-			logs.WarnPrintf("Waiting for yurt-app-manager to be ready [%ds]\n", waitCount)
-			waitCount += 1
-			time.Sleep(time.Second)
+	err = system.WaitUntil("yurt-app-manager to be ready", func() (bool, error) {
+		pods, err := system.ExecCmd("kubectl", "get", "pod", "-n", "kube-system", "--no-headers")
+		for _, pod := range strings.Split(pods, "\n") {
+			// NAME READY STATUS RESTARTS AGE
+			podInfo := strings.Fields(pod)
+			if len(podInfo) >= 3 && strings.HasPrefix(podInfo[0], "yurt-app-manager") {
+				return podInfo[1] == "1/1" && podInfo[2] == "Running", err
+			}
 		}
-	}
+		return false, err
+	})
+	logs.CheckErrorWithTagAndMsg(err, "Failed to wait for yurt-app-manager to be ready!\n")
 
 	// Deploy yurt-controller-manager
 	logs.WaitPrintf("Deploying yurt-controller-manager")
-	_, err = system.ExecShellCmd("helm install openyurt %s/openyurt-helm/charts/openyurt -n kube-system", configs.System.TmpDir)
+	_, err = system.ExecCmd("helm", "install", "openyurt", configs.System.TmpDir+"/openyurt-helm/charts/openyurt", "-n", "kube-system")
 	logs.CheckErrorWithTagAndMsg(err, "Failed to deploy yurt-controller-manager!\n")
 
 	// Setup raven-controller-manager Component
 	// Clone repository
 	logs.WaitPrintf("Cloning repo: raven-controller-manager")
-	_, err = system.ExecShellCmd("git clone --quiet https://github.com/openyurtio/raven-controller-manager.git %s/raven-controller-manager", configs.System.TmpDir)
+	err = system.GitClone(configs.Yurt.RavenControllerManagerRepoUrl, configs.System.TmpDir+"/raven-controller-manager")
 	logs.CheckErrorWithTagAndMsg(err, "Failed to clone repo: raven-controller-manager!\n")
 	// Deploy raven-controller-manager
 	logs.WaitPrintf("Deploying raven-controller-manager")
-	_, err = system.ExecShellCmd("pushd %s/raven-controller-manager && git checkout v0.3.0 && make generate-deploy-yaml && kubectl apply -f _output/yamls/raven-controller-manager.yaml && popd", configs.System.TmpDir)
+	ravenControllerManagerDir := configs.System.TmpDir + "/raven-controller-manager"
+	_, err = system.ExecCmd("git", "-C", ravenControllerManagerDir, "checkout", "v"+configs.Yurt.RavenVersion)
+	logs.CheckErrorWithMsg(err, "Failed to deploy raven-controller-manager!\n")
+	manifestPath, err := system.GenerateManifest(configs.Yurt.RavenControllerManagerRepoUrl, ravenControllerManagerDir, ravenControllerManagerManifest())
+	logs.CheckErrorWithMsg(err, "Failed to deploy raven-controller-manager!\n")
+	_, err = system.ExecCmd("kubectl", "apply", "-f", manifestPath)
 	logs.CheckErrorWithTagAndMsg(err, "Failed to deploy raven-controller-manager!\n")
 
 	// Setup raven-agent Component
 	// Clone repository
 	logs.WaitPrintf("Cloning repo: raven-agent")
-	_, err = system.ExecShellCmd("git clone --quiet https://github.com/openyurtio/raven.git %s/raven-agent", configs.System.TmpDir)
+	err = system.GitClone(configs.Yurt.RavenAgentRepoUrl, configs.System.TmpDir+"/raven-agent")
 	logs.CheckErrorWithTagAndMsg(err, "Failed to clone repo: raven-agent!\n")
 	// Deploy raven-agent
 	logs.WaitPrintf("Deploying raven-agent")
-	_, err = system.ExecShellCmd("pushd %s/raven-agent && git checkout v0.3.0 && FORWARD_NODE_IP=true make deploy && popd", configs.System.TmpDir)
+	ravenAgentDir := configs.System.TmpDir + "/raven-agent"
+	_, err = system.ExecCmd("git", "-C", ravenAgentDir, "checkout", "v"+configs.Yurt.RavenVersion)
+	logs.CheckErrorWithMsg(err, "Failed to deploy raven-agent!\n")
+	manifestPath, err = system.GenerateManifest(configs.Yurt.RavenAgentRepoUrl, ravenAgentDir, ravenAgentManifest())
+	logs.CheckErrorWithMsg(err, "Failed to deploy raven-agent!\n")
+	_, err = system.ExecCmd("kubectl", "apply", "-f", manifestPath)
 	logs.CheckErrorWithTagAndMsg(err, "Failed to deploy raven-agent!\n")
 }
 
@@ -253,39 +394,37 @@ func YurtMasterExpand() {
 	} else {
 		workerAsEdge = "false"
 	}
-	_, err = system.ExecShellCmd("kubectl label node %s openyurt.io/is-edge-worker=%s --overwrite", configs.Yurt.WorkerNodeName, workerAsEdge)
+	_, err = system.ExecCmd("kubectl", "label", "node", configs.Yurt.WorkerNodeName, "openyurt.io/is-edge-worker="+workerAsEdge, "--overwrite")
 	logs.CheckErrorWithTagAndMsg(err, "Failed to label worker node!\n")
 
 	// Activate the node autonomous mode
 	logs.WaitPrintf("Activating the node autonomous mode")
-	_, err = system.ExecShellCmd("kubectl annotate node %s node.beta.openyurt.io/autonomy=true --overwrite", configs.Yurt.WorkerNodeName)
+	_, err = system.ExecCmd("kubectl", "annotate", "node", configs.Yurt.WorkerNodeName, "node.beta.openyurt.io/autonomy=true", "--overwrite")
 	logs.CheckErrorWithTagAndMsg(err, "Failed to activate the node autonomous mode!\n")
 
 	// Wait for worker node to be Ready
 	logs.WaitPrintf("Waiting for worker node to be ready")
-	waitCount := 1
-	for {
-		workerNodeStatus, err := system.ExecShellCmd(`kubectl get nodes | sed -n "/.*%s.*/p" | sed -n "s/\s*\(\S*\)\s*\(\S*\).*/\2/p"`, configs.Yurt.WorkerNodeName)
-		logs.CheckErrorWithMsg(err, "Failed to wait for worker node to be ready!\n")
-		if workerNodeStatus == "Ready" {
-			logs.SuccessPrintf("\n")
-			break
-		} else {
-			logs.WarnPrintf("Waiting for worker node to be ready [%ds]\n", waitCount)
-			waitCount += 1
-			time.Sleep(time.Second)
-		}
-	}
+	err = system.WaitUntil("worker node to be ready", func() (bool, error) {
+		workerNodeReady, err := system.ExecCmd("kubectl", "get", "node", configs.Yurt.WorkerNodeName, "-o", `jsonpath={.status.conditions[?(@.type=="Ready")].status}`)
+		return workerNodeReady == "True", err
+	})
+	logs.CheckErrorWithTagAndMsg(err, "Failed to wait for worker node to be ready!\n")
 
 	// Restart pods in the worker node
 	logs.WaitPrintf("Restarting pods in the worker node")
-	shellOutput, err := system.ExecShellCmd(template.GetRestartPodsShell(), configs.Yurt.WorkerNodeName)
+	existingPods, err := system.ExecCmd("kubectl", "get", "pod", "-A", "--no-headers",
+		"--field-selector", "spec.nodeName="+configs.Yurt.WorkerNodeName,
+		"-o", "custom-columns=NAMESPACE:.metadata.namespace,NAME:.metadata.name")
 	logs.CheckErrorWithMsg(err, "Failed to restart pods in the worker node!\n")
-	podsToBeRestarted := strings.Split(shellOutput, "\n")
+	podsToBeRestarted := strings.Split(existingPods, "\n")
 	for _, pods := range podsToBeRestarted {
-		podsInfo := strings.Split(pods, " ")
+		// Yurthub must keep running
+		podsInfo := strings.Fields(pods)
+		if len(podsInfo) != 2 || strings.Contains(podsInfo[1], "yurt-hub") {
+			continue
+		}
 		logs.WaitPrintf("Restarting pod: %s => %s", podsInfo[0], podsInfo[1])
-		_, err = system.ExecShellCmd("kubectl -n %s delete pod %s", podsInfo[0], podsInfo[1])
+		_, err = system.ExecCmd("kubectl", "-n", podsInfo[0], "delete", "pod", podsInfo[1])
 		logs.CheckErrorWithTagAndMsg(err, "Failed to restart pods in the worker node!\n")
 	}
 }
@@ -296,22 +435,37 @@ func YurtWorkerJoin() {
 	// Initialize
 	var err error
 
+	// Import images, so that Yurthub is never pulled
+	if system.IsBundleMode() {
+		logs.WaitPrintf("Importing images from bundle")
+		err = system.ImportBundleImages()
+		logs.CheckErrorWithTagAndMsg(err, "Failed to import images from bundle!\n")
+	}
+
 	// Set up Yurthub
 	logs.WaitPrintf("Setting up Yurthub")
-	_, err = system.ExecShellCmd(
-		"echo '%s' | sed -e 's|__kubernetes_master_address__|%s:%s|' -e 's|__bootstrap_token__|%s|' | sudo tee /etc/kubernetes/manifests/yurthub-ack.yaml",
-		template.GetYurtHubConfig(),
-		configs.Kube.ApiserverAdvertiseAddress,
-		configs.Kube.ApiserverPort,
-		configs.Kube.ApiserverToken)
+	yurthubManifest := strings.NewReplacer(
+		"__yurthub_image__", fmt.Sprintf(configs.Yurt.YurthubImageTemplate, configs.Yurt.YurtVersion),
+		"__kubernetes_master_address__", configs.Kube.ApiserverAdvertiseAddress+":"+configs.Kube.ApiserverPort,
+		"__bootstrap_token__", configs.Kube.ApiserverToken).Replace(template.GetYurtHubConfig())
+	_, err = system.ExecCmdWithInput(yurthubManifest, "sudo", "tee", "/etc/kubernetes/manifests/yurthub-ack.yaml")
 	logs.CheckErrorWithTagAndMsg(err, "Failed to set up Yurthub!\n")
 
 	// Configure Kubelet
 	logs.WaitPrintf("Configuring kubelet")
-	system.ExecShellCmd("sudo mkdir -p /var/lib/openyurt && echo '%s' | sudo tee /var/lib/openyurt/kubelet.conf", template.GetKubeletConfig())
+	_, err = system.ExecCmd("sudo", "mkdir", "-p", "/var/lib/openyurt")
+	logs.CheckErrorWithMsg(err, "Failed to configure kubelet!\n")
+	_, err = system.ExecCmdWithInput(template.GetKubeletConfig(), "sudo", "tee", "/var/lib/openyurt/kubelet.conf")
+	logs.CheckErrorWithMsg(err, "Failed to configure kubelet!\n")
+	// The kubeadm drop-in is in /usr/lib with packages from pkgs.k8s.io and in /etc with binaries, so override it instead of editing it
+	err = system.RecordFileChange(kubeletDropInPath)
+	logs.CheckErrorWithMsg(err, "Failed to configure kubelet!\n")
+	_, err = system.ExecCmd("sudo", "mkdir", "-p", path.Dir(kubeletDropInPath))
+	logs.CheckErrorWithMsg(err, "Failed to configure kubelet!\n")
+	_, err = system.ExecCmdWithInput(template.GetKubeletDropIn(), "sudo", "tee", kubeletDropInPath)
 	logs.CheckErrorWithMsg(err, "Failed to configure kubelet!\n")
-	system.ExecShellCmd(`sudo sed -i "s|KUBELET_KUBECONFIG_ARGS=--bootstrap-kubeconfig=\/etc\/kubernetes\/bootstrap-kubelet.conf\ --kubeconfig=\/etc\/kubernetes\/kubelet.conf|KUBELET_KUBECONFIG_ARGS=--kubeconfig=\/var\/lib\/openyurt\/kubelet.conf|g" /etc/systemd/system/kubelet.service.d/10-kubeadm.conf`)
+	_, err = system.ExecCmd("sudo", "systemctl", "daemon-reload")
 	logs.CheckErrorWithMsg(err, "Failed to configure kubelet!\n")
-	system.ExecShellCmd("sudo systemctl daemon-reload && sudo systemctl restart kubelet")
+	_, err = system.ExecCmd("sudo", "systemctl", "restart", "kubelet")
 	logs.CheckErrorWithTagAndMsg(err, "Failed to configure kubelet!\n")
 }
@@ -0,0 +1,139 @@
+package yurt
+
+import (
+	"strings"
+	"testing"
+
+	configs "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/configs"
+	system "github.com/flyinghorse0510/easy_openyurt/src/easy_openyurt/system"
+)
+
+func TestYurtMasterInit(t *testing.T) {
+	fakeRunner := system.NewFakeRunner()
+	fakeRunner.On("kubectl get pod -n kube-system",
+		system.FakeResponse{Stdout: "coredns-565d847f94-8x2xv 1/1 Running 0 5m\nyurt-app-manager-6d5d5d9c4c-abcde 0/1 ContainerCreating 0 3s"},
+		system.FakeResponse{Stdout: "coredns-565d847f94-8x2xv 1/1 Running 0 5m\nyurt-app-manager-6d5d5d9c4c-abcde 1/1 Running 0 4s"})
+	defer system.SetRunner(system.SetRunner(fakeRunner))
+	configs.System.CurrentOS = "ubuntu"
+
+	YurtMasterInit()
+
+	if fakeRunner.Count("kubectl get pod -n kube-system") != 2 {
+		t.Errorf("YurtMasterInit() should poll yurt-app-manager until it is running\n%v", fakeRunner)
+	}
+	appManager := fakeRunner.Index("helm install yurt-app-manager")
+	controllerManager := fakeRunner.Index("helm install openyurt")
+	if appManager < 0 || controllerManager < appManager {
+		t.Errorf("YurtMasterInit() should deploy yurt-app-manager before openyurt\n%v", fakeRunner)
+	}
+	if !fakeRunner.Executed("/openyurt-helm checkout openyurt-" + configs.Yurt.YurtVersion) {
+		t.Errorf("YurtMasterInit() did not check out openyurt-helm %s\n%v", configs.Yurt.YurtVersion, fakeRunner)
+	}
+	for _, pattern := range []string{
+		"/raven-controller-manager generate-deploy-yaml IMG=openyurt/raven-controller-manager:v" + configs.Yurt.RavenVersion,
+		"/raven-controller-manager/_output/yamls/raven-controller-manager.yaml",
+		"/raven-agent gen-deploy-yaml FORWARD_NODE_IP=true IMG=openyurt/raven-agent:v" + configs.Yurt.RavenVersion,
+		"/raven-agent/_output/yamls/raven-agent.yaml",
+	} {
+		if !fakeRunner.Executed(pattern) {
+			t.Errorf("YurtMasterInit() did not execute %q\n%v", pattern, fakeRunner)
+		}
+	}
+}
+
+func TestYurtMasterExpand(t *testing.T) {
+	fakeRunner := system.NewFakeRunner()
+	fakeRunner.On("kubectl get node edge-1", system.FakeResponse{Stdout: "True"})
+	fakeRunner.On("spec.nodeName=edge-1", system.FakeResponse{Stdout: "kube-system kube-proxy-abcde\nkube-system yurt-hub-edge-1\ndefault nginx-12345"})
+	defer system.SetRunner(system.SetRunner(fakeRunner))
+	configs.Yurt.WorkerNodeName = "edge-1"
+
+	YurtMasterExpand()
+
+	for _, pattern := range []string{
+		"kubectl label node edge-1 openyurt.io/is-edge-worker=true --overwrite",
+		"kubectl annotate node edge-1 node.beta.openyurt.io/autonomy=true --overwrite",
+		"kubectl -n kube-system delete pod kube-proxy-abcde",
+		"kubectl -n default delete pod nginx-12345",
+	} {
+		if !fakeRunner.Executed(pattern) {
+			t.Errorf("YurtMasterExpand() did not execute %q\n%v", pattern, fakeRunner)
+		}
+	}
+	if fakeRunner.Executed("delete pod yurt-hub") {
+		t.Errorf("YurtMasterExpand() should not restart yurt-hub\n%v", fakeRunner)
+	}
+}
+
+// Record the changes of `yurt worker join` in a journal of the test
+func useStateJournal(t *testing.T) {
+	previousStatePath := configs.System.StatePath
+	configs.System.StatePath = t.TempDir() + "/state.json"
+	t.Cleanup(func() {
+		system.FinishStateJournal()
+		configs.System.StatePath = previousStatePath
+	})
+	if err := system.StartStateJournal("yurt worker join"); err != nil {
+		t.Fatalf("StartStateJournal() error = %v", err)
+	}
+}
+
+func TestYurtWorkerJoin(t *testing.T) {
+	fakeRunner := system.NewFakeRunner()
+	defer system.SetRunner(system.SetRunner(fakeRunner))
+	useStateJournal(t)
+	configs.Kube.ApiserverAdvertiseAddress = "10.0.0.1"
+	configs.Kube.ApiserverToken = "abcdef.0123456789abcdef"
+
+	YurtWorkerJoin()
+
+	for _, pattern := range []string{
+		"- --server-addr=https://10.0.0.1:6443\n",
+		"- --join-token=abcdef.0123456789abcdef\n",
+		"image: openyurt/yurthub:v" + configs.Yurt.YurtVersion + "\n",
+		"sudo tee /etc/kubernetes/manifests/yurthub-ack.yaml",
+		"sudo systemctl restart kubelet",
+	} {
+		if !fakeRunner.Executed(pattern) {
+			t.Errorf("YurtWorkerJoin() did not execute %q\n%v", pattern, fakeRunner)
+		}
+	}
+	assertKubeletDropIn(t, fakeRunner)
+}
+
+// The kubeadm drop-in of the packages is overridden rather than edited, and the override is recorded for `system reset`
+func assertKubeletDropIn(t *testing.T, fakeRunner *system.FakeRunner) {
+	t.Helper()
+	dropIn := fakeRunner.Index("sudo tee " + kubeletDropInPath)
+	if dropIn < 0 || !strings.Contains(fakeRunner.Commands[dropIn], `Environment="KUBELET_KUBECONFIG_ARGS=--kubeconfig=/var/lib/openyurt/kubelet.conf"`) {
+		t.Errorf("YurtWorkerJoin() did not write the kubelet drop-in %s\n%v", kubeletDropInPath, fakeRunner)
+	}
+	if reload := fakeRunner.Index("sudo systemctl daemon-reload"); reload < dropIn {
+		t.Errorf("YurtWorkerJoin() should reload systemd after writing the kubelet drop-in\n%v", fakeRunner)
+	}
+	if fakeRunner.Executed("10-kubeadm.conf") {
+		t.Errorf("YurtWorkerJoin() should not edit the kubeadm drop-in\n%v", fakeRunner)
+	}
+	journal, err := system.LoadStateJournal()
+	if err != nil || len(journal.Changes) != 1 || journal.Changes[0].Path != kubeletDropInPath {
+		t.Errorf("YurtWorkerJoin() should record the kubelet drop-in in the state journal: %+v, %v", journal, err)
+	}
+}
+
+// CRI-O is installed from pkgs.k8s.io, whose packages put the kubeadm drop-in in /usr/lib
+func TestYurtWorkerJoinWithCrio(t *testing.T) {
+	fakeRunner := system.NewFakeRunner()
+	defer system.SetRunner(system.SetRunner(fakeRunner))
+	useStateJournal(t)
+	configs.System.ContainerRuntime = system.RuntimeCrio
+	defer func() { configs.System.ContainerRuntime = system.RuntimeContainerd }()
+	configs.Kube.ApiserverAdvertiseAddress = "10.0.0.1"
+	configs.Kube.ApiserverToken = "abcdef.0123456789abcdef"
+
+	YurtWorkerJoin()
+
+	assertKubeletDropIn(t, fakeRunner)
+	if restart := fakeRunner.Index("sudo systemctl restart kubelet"); restart < fakeRunner.Index("sudo tee "+kubeletDropInPath) {
+		t.Errorf("YurtWorkerJoin(-runtime=crio) should restart kubelet with the drop-in\n%v", fakeRunner)
+	}
+}